@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/planner/derivation"
+	"text/tabwriter"
+	"fmt"
+	"os"
+)
+
+// budgetCmd represents the budget command
+var budgetCmd = &cobra.Command{
+	Use:   "budget",
+	Short: "Show budget ledger",
+	Long: "Show the monthly budget and the spend expected by the selected policies in each calendar month",
+	Run: budget,
+}
+
+func init() {
+	budgetCmd.Flags().String("month", "", "Calendar month, e.g. 2018-11")
+	budgetCmd.Flags().String("config-file", "config.yml", "Configuration file path")
+}
+
+func budget(cmd *cobra.Command, args []string) {
+	month := cmd.Flag("month").Value.String()
+	configFile := cmd.Flag("config-file").Value.String()
+	systemConfiguration,err := util.ReadConfigFile(configFile)
+	check(err, "Configuration file could not be read")
+	storage.SetUpStorage(systemConfiguration.Storage)
+	budgetLedgerDAO := storage.GetBudgetLedgerDAO(systemConfiguration.MainServiceName)
+
+	var entries []types.BudgetEntry
+	if month == "" {
+		entries,err = budgetLedgerDAO.FindAll()
+	} else {
+		entries,err = budgetLedgerDAO.FindByMonth(month)
+	}
+	check(err, "Budget ledger could not be retrieved")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MONTH\tBUDGET\tEXPECTED SPEND\tREMAINING")
+	for _,b := range derivation.MonthlyBudgets(systemConfiguration.PricingModel.Budget, entries) {
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%.2f\n", b.Month, b.Budget, b.ExpectedSpend, b.Remaining)
+	}
+	w.Flush()
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/server"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// compareCmd represents the catalogs comparison command
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare providers and regions",
+	Long: "Derive the policies with the VM profiles of each catalog of the configuration and compare the selected policies side by side. Nothing is stored nor scheduled",
+	Run: compare,
+}
+
+func init() {
+	compareCmd.Flags().String("config-file", "config.yml", "Configuration file path")
+	compareCmd.Flags().Bool("json", false, "Write the selected policies into the file output.json")
+}
+
+func compare(cmd *cobra.Command, args []string) {
+	configFile := cmd.Flag("config-file").Value.String()
+	sysConfiguration,err := util.ReadConfigFile(configFile)
+	check(err, "Configuration file could not be read")
+	storage.SetUpStorage(sysConfiguration.Storage)
+
+	timeStart := sysConfiguration.ScalingHorizon.StartTime
+	timeEnd := sysConfiguration.ScalingHorizon.EndTime
+	catalogPolicies, err := server.CompareCatalogs(timeStart, timeEnd, sysConfiguration)
+	if err != nil {
+		log.Errorf("An error has occurred and the catalogs have been not compared. Details: %s", err)
+		return
+	}
+	printCatalogPolicies(catalogPolicies)
+	if cmd.Flag("json").Value.String() == "true" {
+		writeToFile(catalogPolicies)
+	}
+}
+
+//Print the policy selected for each catalog with its metrics
+func printCatalogPolicies(catalogPolicies []types.CatalogPolicy) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CSP\tREGION\tALGORITHM\tCOST\tEXPECTED COST\tOVER PROVISION\tUNDER PROVISION\tSCALING ACTIONS\tVM ACTIONS\tVM TYPES")
+	for _,c := range catalogPolicies {
+		if c.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.CSP, c.Region, "error: " + c.Error)
+			continue
+		}
+		m := c.Policy.Metrics
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.4f\t%.4f\t%.2f\t%.2f\t%d\t%d\t%s\n",
+			c.CSP, c.Region, c.Policy.Algorithm, m.Cost, m.ExpectedCost, m.OverProvision, m.UnderProvision,
+			m.NumberScalingActions, m.NumberVMScalingActions, strings.Join(policyVMTypes(c.Policy), ","))
+	}
+	w.Flush()
+}
+
+//VM types used by the scaling actions of a policy
+func policyVMTypes(policy types.Policy) []string {
+	vmTypes := []string{}
+	found := make(map[string]bool)
+	for _,sa := range policy.ScalingActions {
+		for vmType := range sa.DesiredState.VMs {
+			if !found[vmType] {
+				found[vmType] = true
+				vmTypes = append(vmTypes, vmType)
+			}
+		}
+	}
+	sort.Strings(vmTypes)
+	return vmTypes
+}
@@ -30,6 +30,7 @@ func delete(cmd *cobra.Command, args []string) {
 	if force {
 		configFile := cmd.Flag("config-file").Value.String()
 		systemConfiguration,_ := util.ReadConfigFile(configFile)
+		db.SetUpStorage(systemConfiguration.Storage)
 		policyDAO := db.GetPolicyDAO(systemConfiguration.MainServiceName)
 		err := policyDAO.DeleteById(id)
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/Cloud-Pie/SPDT/server"
 	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/storage"
 )
 
 // deriveCmd represents the derive policy command
@@ -15,18 +16,36 @@ var deriveCmd = &cobra.Command{
 	Run: derive,
 }
 
+var dryRun bool
+
 func init() {
 	deriveCmd.Flags().String("config-file", "config.yml", "Configuration file path")
-	deriveCmd.Flags().String("vm-prices-file","vm_profiles.json", "VM prices file path")
+	deriveCmd.Flags().String("vm-prices-file","", "VM prices file path, it overrides the prices of vm_profiles.json")
+	deriveCmd.Flags().BoolVar(&dryRun,"dry-run", false, "Derive the policies in memory without storing or scheduling them")
 }
 
 func derive (cmd *cobra.Command, args []string) {
 	configFile := cmd.Flag("config-file").Value.String()
 	sysConfiguration,_ := util.ReadConfigFile(configFile)
+	if pricesFile := cmd.Flag("vm-prices-file").Value.String(); pricesFile != "" {
+		sysConfiguration.PricingModel.PricesFile = pricesFile
+	}
 	timeStart := sysConfiguration.ScalingHorizon.StartTime
 	timeEnd := sysConfiguration.ScalingHorizon.EndTime
+	if dryRun {
+		storage.SetUpStorage(util.StorageConfiguration{Type:util.STORAGE_MEMORY})
+		policies, err := server.DryRunPolicyDerivation(timeStart,timeEnd,sysConfiguration)
+		if err != nil {
+			log.Errorf("An error has occurred and policies have been not derived. Details: %s", err)
+		}
+		if len(policies) > 0 {
+			writeToFile(policies)
+		}
+		return
+	}
+	storage.SetUpStorage(sysConfiguration.Storage)
 	_, err := server.StartPolicyDerivation(timeStart,timeEnd,sysConfiguration)
 	if err != nil {
 		log.Error("An error has occurred and policies have been not derived. Please try again. Details: %s", err)
 	}
-}
\ No newline at end of file
+}
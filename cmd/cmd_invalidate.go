@@ -4,6 +4,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/Cloud-Pie/SPDT/planner/updatesHandler"
 	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/storage"
 	"time"
 	"github.com/Cloud-Pie/SPDT/server"
 )
@@ -38,6 +39,7 @@ func invalidate(cmd *cobra.Command, args []string) {
 		check(err, "Time end window no valid")
 		configFile := cmd.Flag("config-file").Value.String()
 		systemConfiguration,_ := util.ReadConfigFile(configFile)
+		storage.SetUpStorage(systemConfiguration.Storage)
 
 		invalidated := updatesHandler.InvalidateOldPolicies(systemConfiguration, timeStart, timeEnd )
 		if invalidated {
@@ -35,6 +35,7 @@ func retrieve (cmd *cobra.Command, args []string) {
 	end := cmd.Flag("end-time").Value.String()
 	configFile := cmd.Flag("config-file").Value.String()
 	systemConfiguration,_ := util.ReadConfigFile(configFile)
+	db.SetUpStorage(systemConfiguration.Storage)
 	policyDAO := db.GetPolicyDAO(systemConfiguration.MainServiceName)
 
 	if id != "" {
@@ -37,6 +37,9 @@ func Execute() {
 	RootCmd.AddCommand(policiesCmd)
 	RootCmd.AddCommand(invalidateCmd)
 	RootCmd.AddCommand(updateProfilesCmd)
+	RootCmd.AddCommand(simulateCmd)
+	RootCmd.AddCommand(budgetCmd)
+	RootCmd.AddCommand(compareCmd)
 
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/server"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// simulateCmd represents the offline derivation command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Derive policies offline",
+	Long: "Derive and evaluate the policies for a forecast, performance profiles and current state read from files. Nothing is stored nor scheduled",
+	Run: simulate,
+}
+
+func init() {
+	simulateCmd.Flags().String("config-file", "config.yml", "Configuration file path")
+	simulateCmd.Flags().String("forecast", "forecast.json", "Forecast file path")
+	simulateCmd.Flags().String("profiles", "profiles.json", "Performance profiles file path")
+	simulateCmd.Flags().String("current-state", "state.json", "Current state file path")
+}
+
+func simulate(cmd *cobra.Command, args []string) {
+	configFile := cmd.Flag("config-file").Value.String()
+	forecastFile := cmd.Flag("forecast").Value.String()
+	profilesFile := cmd.Flag("profiles").Value.String()
+	currentStateFile := cmd.Flag("current-state").Value.String()
+	sysConfiguration,_ := util.ReadConfigFile(configFile)
+
+	storage.SetUpStorage(util.StorageConfiguration{Type:util.STORAGE_MEMORY})
+	policies, err := server.SimulatePolicyDerivation(forecastFile, profilesFile, currentStateFile, sysConfiguration)
+	if err != nil {
+		log.Errorf("An error has occurred and policies have been not derived. Details: %s", err)
+	}
+	if len(policies) > 0 {
+		printPolicies(policies)
+	}
+}
+
+//Print the candidate policies with their metrics
+func printPolicies(policies []types.Policy) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tALGORITHM\tSTATUS\tCOST\tEXPECTED COST\tOVER PROVISION\tUNDER PROVISION\tSCALING ACTIONS\tVM ACTIONS\tCONTAINER ACTIONS\tAVG TRANSITION(s)\tAVG SHADOW(s)\tAVG BETWEEN SCALING(s)\tDERIVATION(s)")
+	for _,p := range policies {
+		m := p.Metrics
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.4f\t%.4f\t%.2f\t%.2f\t%d\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			p.ID.Hex(), p.Algorithm, p.Status, m.Cost, m.ExpectedCost, m.OverProvision, m.UnderProvision, m.NumberScalingActions,
+			m.NumberVMScalingActions, m.NumberContainerScalingActions, m.AvgTransitionTime, m.AvgShadowTime,
+			m.AvgElapsedTime, m.DerivationDuration)
+	}
+	w.Flush()
+}
@@ -23,6 +23,7 @@ func updateProfiles(cmd *cobra.Command, args []string) {
 
 	configFile := cmd.Flag("config-file").Value.String()
 	systemConfiguration,_ := util.ReadConfigFile(configFile)
+	storage.SetUpStorage(systemConfiguration.Storage)
 	profilesDAO := storage.GetPerformanceProfileDAO(systemConfiguration.MainServiceName)
 	err := profilesDAO.DeleteAll()
 	check(err, "Error removing old profiles.")
@@ -33,7 +34,7 @@ func updateProfiles(cmd *cobra.Command, args []string) {
 
 	err = server.FetchApplicationProfile(systemConfiguration)
 	check(err, "No application profiles found.")
-	vmProfiles,err2 := server.ReadVMProfiles()
+	vmProfiles,err2 := server.ReadVMProfiles(systemConfiguration)
 	check(err2, "No VM profiles found.")
 	err2 = server.FetchVMBootingProfiles(systemConfiguration,vmProfiles)
 	check(err2, "No VM booting times found.")
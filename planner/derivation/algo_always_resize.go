@@ -48,8 +48,8 @@ func (p AlwaysResizePolicy) CreatePolicies(processedForecast types.ProcessedFore
 	@VMScale with the suggested number of VMs for that type
 */
 func (p AlwaysResizePolicy) FindSuitableVMs(numberReplicas int, limits types.Limit) (types.VMScale,error) {
-	vmSet,err := buildHomogeneousVMSet(numberReplicas,limits, p.mapVMProfiles)
-	/*hetVMSet,_ := buildHeterogeneousVMSet(numberReplicas, limits, p.mapVMProfiles)
+	vmSet,err := buildHomogeneousVMSet(numberReplicas,limits, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+	/*hetVMSet,_ := buildHeterogeneousVMSet(numberReplicas, limits, p.mapVMProfiles, p.sysConfiguration.PricingModel)
 	costi := hetVMSet.Cost(p.mapVMProfiles)
 	costj := vmSet.Cost(p.mapVMProfiles)
 	if costi < costj {
@@ -71,11 +71,16 @@ func (p AlwaysResizePolicy)deriveCandidatePolicy(criticalIntervals []types.Criti
 		StartTimeDerivation: time.Now(),
 	}
 	scalingSteps := []types.ScalingAction{}
+	methods := scalingMethods{}
 
 	for _, it := range criticalIntervals {
-		totalLoad := it.Requests
+		totalLoad := loadToServe(it.Requests, p.sysConfiguration.PolicySettings)
 		performanceProfile, _ := selectProfileUnderVMLimits(totalLoad, vmLimits)
 		vmSet, _ := p.FindSuitableVMs(performanceProfile.MSCSetting.Replicas, performanceProfile.Limits)
+		var method string
+		vmSet, method = vmSetForScalingMethod(p.sysConfiguration.PolicySettings.ScalingMethod, vmSet, performanceProfile.MSCSetting.Replicas, performanceProfile.Limits,
+			p.currentState.VMs, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+		methods.add(method)
 		newNumPods := performanceProfile.MSCSetting.Replicas
 		stateLoadCapacity := performanceProfile.MSCSetting.MSCPerSecond
 		totalServicesBootingTime := performanceProfile.MSCSetting.BootTimeSec
@@ -95,15 +100,17 @@ func (p AlwaysResizePolicy)deriveCandidatePolicy(criticalIntervals []types.Criti
 		timeStart := it.TimeStart
 		timeEnd := it.TimeEnd
 		stateLoadCapacity = adjustGranularity(systemConfiguration.ForecastComponent.Granularity, stateLoadCapacity)
-		setScalingSteps(&scalingSteps, p.currentState, state, timeStart, timeEnd, totalServicesBootingTime, stateLoadCapacity)
+		setScalingSteps(&scalingSteps, p.currentState, state, timeStart, timeEnd, totalServicesBootingTime, stateLoadCapacity, p.sysConfiguration.PolicySettings)
 		p.currentState = state
 	}
 
 	//Add new policy
 	parameters := make(map[string]string)
-	parameters[types.METHOD] = util.SCALE_METHOD_HORIZONTAL
+	parameters[types.METHOD] = methods.method(p.sysConfiguration.PolicySettings.ScalingMethod)
 	parameters[types.ISHETEREOGENEOUS] = strconv.FormatBool(true)
 	parameters[types.ISRESIZEPODS] = strconv.FormatBool(true)
+	parameters[types.ISUNDERPROVISION] = strconv.FormatBool(p.sysConfiguration.PolicySettings.UnderprovisioningAllowed)
+	parameters[types.MAXUNDERPROVISION] = strconv.FormatFloat(p.sysConfiguration.PolicySettings.MaxUnderprovision, 'f', 2, 64)
 	numConfigurations := len(scalingSteps)
 	newPolicy.ScalingActions = scalingSteps
 	newPolicy.Algorithm = p.algorithm
@@ -74,13 +74,18 @@ func (p BestResourcePairPolicy) deriveCandidatePolicy(criticalIntervals []types.
 	newPolicy.Metrics = types.PolicyMetrics {
 		StartTimeDerivation:time.Now(),
 	}
+	methods := scalingMethods{}
 
 	for _, it := range criticalIntervals {
-		servicePerformanceProfile,_ := estimatePodsConfiguration(it.Requests, podLimits)
+		servicePerformanceProfile,_ := estimatePodsConfiguration(loadToServe(it.Requests, p.sysConfiguration.PolicySettings), podLimits)
 		vmSet,err := p.FindSuitableVMs(servicePerformanceProfile.MSCSetting.Replicas, servicePerformanceProfile.Limits, vmType)
 		if err !=  nil {
 			vmTypeSuitable = false
 		}
+		var method string
+		vmSet, method = vmSetForScalingMethod(p.sysConfiguration.PolicySettings.ScalingMethod, vmSet, servicePerformanceProfile.MSCSetting.Replicas,
+			servicePerformanceProfile.Limits, p.currentState.VMs, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+		methods.add(method)
 		newNumPods := servicePerformanceProfile.MSCSetting.Replicas
 		stateLoadCapacity := servicePerformanceProfile.MSCSetting.MSCPerSecond
 		totalServicesBootingTime := servicePerformanceProfile.MSCSetting.BootTimeSec
@@ -99,7 +104,7 @@ func (p BestResourcePairPolicy) deriveCandidatePolicy(criticalIntervals []types.
 		timeStart := it.TimeStart
 		timeEnd := it.TimeEnd
 		stateLoadCapacity = adjustGranularity(systemConfiguration.ForecastComponent.Granularity, stateLoadCapacity)
-		setScalingSteps(&scalingActions,p.currentState, state,timeStart,timeEnd, totalServicesBootingTime, stateLoadCapacity)
+		setScalingSteps(&scalingActions,p.currentState, state,timeStart,timeEnd, totalServicesBootingTime, stateLoadCapacity, p.sysConfiguration.PolicySettings)
 		p.currentState = state
 	}
 
@@ -107,9 +112,11 @@ func (p BestResourcePairPolicy) deriveCandidatePolicy(criticalIntervals []types.
 	if vmTypeSuitable && numScalingSteps > 0 {
 		//Add new policy
 		parameters := make(map[string]string)
-		parameters[types.METHOD] = util.SCALE_METHOD_HORIZONTAL
+		parameters[types.METHOD] = methods.method(p.sysConfiguration.PolicySettings.ScalingMethod)
 		parameters[types.ISHETEREOGENEOUS] = strconv.FormatBool(false)
 		parameters[types.ISRESIZEPODS] = strconv.FormatBool(true)
+		parameters[types.ISUNDERPROVISION] = strconv.FormatBool(p.sysConfiguration.PolicySettings.UnderprovisioningAllowed)
+		parameters[types.MAXUNDERPROVISION] = strconv.FormatFloat(p.sysConfiguration.PolicySettings.MaxUnderprovision, 'f', 2, 64)
 		newPolicy.ScalingActions = scalingActions
 		newPolicy.Algorithm = p.algorithm
 		newPolicy.ID = bson.NewObjectId()
@@ -137,6 +144,7 @@ func (p BestResourcePairPolicy) findBestPair(forecastedValues []types.CriticalIn
 			max = v.Requests
 		}
 	}
+	max = loadToServe(max, p.sysConfiguration.PolicySettings)
 	biggestVMType := p.sortedVMProfiles[len(p.sortedVMProfiles)-1]
 	allLimits,_ := storage.GetPerformanceProfileDAO(p.sysConfiguration.MainServiceName).FindAllUnderLimits(biggestVMType.CPUCores, biggestVMType.Memory)
 
@@ -149,20 +157,17 @@ func (p BestResourcePairPolicy) findBestPair(forecastedValues []types.CriticalIn
 			servicePerformanceProfile,_ := estimatePodsConfiguration(max, vl.Limit)
 			replicas := servicePerformanceProfile.MSCSetting.Replicas
 			vmSetCandidate,_ := p.FindSuitableVMs(replicas,vl.Limit, vmType)
-			vmSetCost := 0.0
 			if len(vmSetCandidate) > 0 {
-				for _,v := range vmSetCandidate {
-					vmSetCost += p.mapVMProfiles[vmType].Pricing.Price * float64(v)
-				}
-				if vmSetCost < bestCost {
+				candidateCost := vmSetCost(vmSetCandidate, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+				if candidateCost < bestCost {
 					bestLimit = vl.Limit
 					bestVMProfile = p.mapVMProfiles[vmType]
-					bestCost = vmSetCost
+					bestCost = candidateCost
 					numberReplicas = replicas
-				} else if vmSetCost == bestCost && replicas < numberReplicas{
+				} else if candidateCost == bestCost && replicas < numberReplicas{
 					bestLimit = vl.Limit
 					bestVMProfile = p.mapVMProfiles[vmType]
-					bestCost = vmSetCost
+					bestCost = candidateCost
 					numberReplicas = replicas
 				}
 			}
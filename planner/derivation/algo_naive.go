@@ -40,12 +40,15 @@ func (p NaivePolicy) CreatePolicies(processedForecast types.ProcessedForecast) [
 	}
 
 	scalingActions := []types.ScalingAction{}
+	methods := scalingMethods{}
 	for _, it := range processedForecast.CriticalIntervals {
 		var resourceLimits types.Limit
 		//Select the performance profile that fits better
-		containerConfigOver,_ := estimatePodsConfiguration(it.Requests, currentPodLimits)
+		containerConfigOver,_ := estimatePodsConfiguration(loadToServe(it.Requests, p.sysConfiguration.PolicySettings), currentPodLimits)
 		newNumPods := containerConfigOver.MSCSetting.Replicas
 		vmSet := p.FindSuitableVMs(newNumPods, containerConfigOver.Limits)
+		vmSet, method := vmSetForScalingMethod(p.sysConfiguration.PolicySettings.ScalingMethod, vmSet, newNumPods, containerConfigOver.Limits, p.currentState.VMs, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+		methods.add(method)
 		stateLoadCapacity := containerConfigOver.MSCSetting.MSCPerSecond
 		totalServicesBootingTime := containerConfigOver.MSCSetting.BootTimeSec
 		resourceLimits = containerConfigOver.Limits
@@ -65,14 +68,16 @@ func (p NaivePolicy) CreatePolicies(processedForecast types.ProcessedForecast) [
 		timeStart := it.TimeStart
 		timeEnd := it.TimeEnd
 		stateLoadCapacity = adjustGranularity(systemConfiguration.ForecastComponent.Granularity, stateLoadCapacity)
-		setScalingSteps(&scalingActions, p.currentState, state, timeStart, timeEnd, totalServicesBootingTime, stateLoadCapacity)
+		setScalingSteps(&scalingActions, p.currentState, state, timeStart, timeEnd, totalServicesBootingTime, stateLoadCapacity, p.sysConfiguration.PolicySettings)
 		p.currentState = state
 	}
 
 	parameters := make(map[string]string)
-	parameters[types.METHOD] = util.SCALE_METHOD_HORIZONTAL
+	parameters[types.METHOD] = methods.method(p.sysConfiguration.PolicySettings.ScalingMethod)
 	parameters[types.ISHETEREOGENEOUS] = strconv.FormatBool(false)
 	parameters[types.ISRESIZEPODS] = strconv.FormatBool(false)
+	parameters[types.ISUNDERPROVISION] = strconv.FormatBool(p.sysConfiguration.PolicySettings.UnderprovisioningAllowed)
+	parameters[types.MAXUNDERPROVISION] = strconv.FormatFloat(p.sysConfiguration.PolicySettings.MaxUnderprovision, 'f', 2, 64)
 	//Add new policy
 	numConfigurations := len(scalingActions)
 	newPolicy.ScalingActions = scalingActions
@@ -5,7 +5,6 @@ import (
 	"time"
 	"gopkg.in/mgo.v2/bson"
 	"strconv"
-	"fmt"
 	"sort"
 	"github.com/Cloud-Pie/SPDT/util"
 )
@@ -35,6 +34,7 @@ func (p DeltaLoadPolicy) CreatePolicies(processedForecast types.ProcessedForecas
 	newPolicy.Metrics = types.PolicyMetrics {
 		StartTimeDerivation:time.Now(),
 	}
+	methods := scalingMethods{}
 
 	for _, it := range processedForecast.CriticalIntervals {
 		var vmSet types.VMScale
@@ -44,7 +44,7 @@ func (p DeltaLoadPolicy) CreatePolicies(processedForecast types.ProcessedForecas
 		var stateLoadCapacity float64
 
 		//Current configuration
-		totalLoad := it.Requests
+		totalLoad := loadToServe(it.Requests, p.sysConfiguration.PolicySettings)
 		serviceToScale := p.currentState.Services[p.sysConfiguration.MainServiceName]
 		currentPodLimits := types.Limit{ MemoryGB:serviceToScale.Memory, CPUCores:serviceToScale.CPU }
 		currentNumPods := serviceToScale.Scale
@@ -84,6 +84,8 @@ func (p DeltaLoadPolicy) CreatePolicies(processedForecast types.ProcessedForecas
 				vmSet = p.releaseVMs(p.currentState.VMs, newNumPods, currentPodLimits)
 			}
 		}
+		vmSet, method := vmSetForScalingMethod(p.sysConfiguration.PolicySettings.ScalingMethod, vmSet, newNumPods, podLimits, p.currentState.VMs, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+		methods.add(method)
 
 		services :=  make(map[string]types.ServiceInfo)
 		services[ p.sysConfiguration.MainServiceName] = types.ServiceInfo {
@@ -98,15 +100,17 @@ func (p DeltaLoadPolicy) CreatePolicies(processedForecast types.ProcessedForecas
 		timeStart := it.TimeStart
 		timeEnd := it.TimeEnd
 		stateLoadCapacity = adjustGranularity(systemConfiguration.ForecastComponent.Granularity, stateLoadCapacity)
-		setScalingSteps(&scalingActions,p.currentState,state,timeStart,timeEnd, totalServicesBootingTime, stateLoadCapacity)
+		setScalingSteps(&scalingActions,p.currentState,state,timeStart,timeEnd, totalServicesBootingTime, stateLoadCapacity, p.sysConfiguration.PolicySettings)
 		p.currentState = state
 	}
 
 	//Add new policy
 	parameters := make(map[string]string)
-	parameters[types.METHOD] = util.SCALE_METHOD_HORIZONTAL
+	parameters[types.METHOD] = methods.method(p.sysConfiguration.PolicySettings.ScalingMethod)
 	parameters[types.ISHETEREOGENEOUS] = strconv.FormatBool(true)
 	parameters[types.ISRESIZEPODS] = strconv.FormatBool(false)
+	parameters[types.ISUNDERPROVISION] = strconv.FormatBool(p.sysConfiguration.PolicySettings.UnderprovisioningAllowed)
+	parameters[types.MAXUNDERPROVISION] = strconv.FormatFloat(p.sysConfiguration.PolicySettings.MaxUnderprovision, 'f', 2, 64)
 	numConfigurations := len(scalingActions)
 	newPolicy.ScalingActions = scalingActions
 	newPolicy.Algorithm = p.algorithm
@@ -130,8 +134,8 @@ func (p DeltaLoadPolicy) CreatePolicies(processedForecast types.ProcessedForecas
 	@VMScale with the suggested number of VMs for that type
 */
 func (p DeltaLoadPolicy) FindSuitableVMs(numberReplicas int, limits types.Limit) types.VMScale {
-	vmSet, _ := buildHomogeneousVMSet(numberReplicas,limits, p.mapVMProfiles)
-	/*hetVMSet,_ := buildHeterogeneousVMSet(numberReplicas, limits, p.mapVMProfiles)
+	vmSet, _ := buildHomogeneousVMSet(numberReplicas,limits, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+	/*hetVMSet,_ := buildHeterogeneousVMSet(numberReplicas, limits, p.mapVMProfiles, p.sysConfiguration.PricingModel)
 	costi := hetVMSet.Cost(p.mapVMProfiles)
 	costj := vmSet.Cost(p.mapVMProfiles)
 	if costi < costj {
@@ -142,18 +146,6 @@ func (p DeltaLoadPolicy) FindSuitableVMs(numberReplicas int, limits types.Limit)
 }
 
 
-func Drucken (n *Node, level int) {
-	fmt.Printf("%d - %s --%d\n", level,n.vmType, n.NReplicas)
-	for k,v := range n.vmScale {
-		fmt.Printf("%s : %d; ", k,v)
-	}
-	fmt.Printf("\n")
-	for _,v := range n.children {
-		Drucken(v,level+1)
-	}
-}
-
-
 /*
 	Remove VMs from the current set of VMs, the resources that hosts the defined number of container replicas
 	under provisioning is not allowed.
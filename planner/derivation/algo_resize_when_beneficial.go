@@ -38,6 +38,7 @@ func (p ResizeWhenBeneficialPolicy) CreatePolicies(processedForecast types.Proce
 		StartTimeDerivation:time.Now(),
 	}
 	configurations := []types.ScalingAction{}
+	methods := scalingMethods{}
 	biggestVM := p.sortedVMProfiles[len(p.sortedVMProfiles)-1]
 	vmLimits := types.Limit{ MemoryGB:biggestVM.Memory, CPUCores:biggestVM.CPUCores}
 
@@ -45,7 +46,7 @@ func (p ResizeWhenBeneficialPolicy) CreatePolicies(processedForecast types.Proce
 		resourcesConfiguration := types.ContainersConfig{}
 
 		//Load in terms of number of requests
-		totalLoad := it.Requests
+		totalLoad := loadToServe(it.Requests, p.sysConfiguration.PolicySettings)
 		serviceToScale := p.currentState.Services[p.sysConfiguration.MainServiceName]
 		currentPodLimits := types.Limit{ MemoryGB:serviceToScale.Memory, CPUCores:serviceToScale.CPU }
 		currentNumPods := serviceToScale.Scale
@@ -83,6 +84,10 @@ func (p ResizeWhenBeneficialPolicy) CreatePolicies(processedForecast types.Proce
 				}
 			}
 		}
+		var method string
+		resourcesConfiguration.VMSet, method = vmSetForScalingMethod(p.sysConfiguration.PolicySettings.ScalingMethod, resourcesConfiguration.VMSet,
+			resourcesConfiguration.MSCSetting.Replicas, resourcesConfiguration.Limits, p.currentState.VMs, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+		methods.add(method)
 		services := make(map[string]types.ServiceInfo)
 		services[p.sysConfiguration.MainServiceName] = types.ServiceInfo {
 			Scale:  resourcesConfiguration.MSCSetting.Replicas,
@@ -101,16 +106,18 @@ func (p ResizeWhenBeneficialPolicy) CreatePolicies(processedForecast types.Proce
 		totalServicesBootingTime := resourcesConfiguration.MSCSetting.BootTimeSec
 		stateLoadCapacity := resourcesConfiguration.MSCSetting.MSCPerSecond
 		stateLoadCapacity = adjustGranularity(systemConfiguration.ForecastComponent.Granularity, stateLoadCapacity)
-		setScalingSteps(&configurations,p.currentState, state,timeStart,timeEnd, totalServicesBootingTime,stateLoadCapacity)
+		setScalingSteps(&configurations,p.currentState, state,timeStart,timeEnd, totalServicesBootingTime,stateLoadCapacity, p.sysConfiguration.PolicySettings)
 		//Update current state
 		p.currentState = state
 	}
 
 	//Add new policy
 	parameters := make(map[string]string)
-	parameters[types.METHOD] = util.SCALE_METHOD_HORIZONTAL
+	parameters[types.METHOD] = methods.method(p.sysConfiguration.PolicySettings.ScalingMethod)
 	parameters[types.ISHETEREOGENEOUS] = strconv.FormatBool(true)
 	parameters[types.ISRESIZEPODS] = strconv.FormatBool(true)
+	parameters[types.ISUNDERPROVISION] = strconv.FormatBool(p.sysConfiguration.PolicySettings.UnderprovisioningAllowed)
+	parameters[types.MAXUNDERPROVISION] = strconv.FormatFloat(p.sysConfiguration.PolicySettings.MaxUnderprovision, 'f', 2, 64)
 	numConfigurations := len(configurations)
 	newPolicy.ScalingActions = configurations
 	newPolicy.Algorithm = p.algorithm
@@ -133,8 +140,8 @@ func (p ResizeWhenBeneficialPolicy) CreatePolicies(processedForecast types.Proce
 	@VMScale with the suggested number of VMs
 */
 func (p ResizeWhenBeneficialPolicy) FindSuitableVMs(numberReplicas int, resourceLimits types.Limit) types.VMScale {
-	vmSet, _ := buildHomogeneousVMSet(numberReplicas,resourceLimits, p.mapVMProfiles)
-	/*hetVMSet,_ := buildHeterogeneousVMSet(numberReplicas, resourceLimits, p.mapVMProfiles)
+	vmSet, _ := buildHomogeneousVMSet(numberReplicas,resourceLimits, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+	/*hetVMSet,_ := buildHeterogeneousVMSet(numberReplicas, resourceLimits, p.mapVMProfiles, p.sysConfiguration.PricingModel)
 	costi := hetVMSet.Cost(p.mapVMProfiles)
 	costj := vmSet.Cost(p.mapVMProfiles)
 	if costi < costj {
@@ -196,7 +203,7 @@ func(p ResizeWhenBeneficialPolicy) calculateReconfigurationCost(newSet types.VMS
 	_, deletedVMS := DeltaVMSet(p.currentState.VMs, newSet)
 	reconfigTime := computeVMTerminationTime(deletedVMS, p.sysConfiguration)
 
-	return deletedVMS.Cost(p.mapVMProfiles) * float64(reconfigTime)
+	return vmSetCost(deletedVMS, p.mapVMProfiles, p.sysConfiguration.PricingModel) * float64(reconfigTime)
 }
 
 
@@ -212,8 +219,8 @@ func(p ResizeWhenBeneficialPolicy) calculateReconfigurationCost(newSet types.VMS
 	@bool = flag to indicate whether reconfiguration should be performed
 */
 func(p ResizeWhenBeneficialPolicy) shouldRepackVMSet(currentOption types.ContainersConfig, candidateOption types.ContainersConfig, indexTimeInterval int, timeIntervals[]types.CriticalInterval) (types.ContainersConfig, bool) {
-	currentCost := currentOption.VMSet.Cost(p.mapVMProfiles)
-	candidateCost := candidateOption.VMSet.Cost(p.mapVMProfiles)
+	currentCost := vmSetCost(currentOption.VMSet, p.mapVMProfiles, p.sysConfiguration.PricingModel)
+	candidateCost := vmSetCost(candidateOption.VMSet, p.mapVMProfiles, p.sysConfiguration.PricingModel)
 
 	if candidateCost <= currentCost {
 		//By default the transition policy would be to shut down VMs after launch new ones
@@ -225,7 +232,7 @@ func(p ResizeWhenBeneficialPolicy) shouldRepackVMSet(currentOption types.Contain
 		//Compute duration for new set
 		candidateLoadCapacity := candidateOption.MSCSetting.MSCPerSecond
 		for idx < lenInterval {
-			if timeIntervals[idx].Requests > candidateLoadCapacity {
+			if loadToServe(timeIntervals[idx].Requests, p.sysConfiguration.PolicySettings) > candidateLoadCapacity {
 				timeEnd = timeIntervals[idx].TimeStart
 				break
 			}
@@ -238,7 +245,7 @@ func(p ResizeWhenBeneficialPolicy) shouldRepackVMSet(currentOption types.Contain
 		jdx := indexTimeInterval
 		currentLoadCapacity := currentOption.MSCSetting.MSCPerSecond
 		for jdx < lenInterval {
-			if timeIntervals[jdx].Requests > currentLoadCapacity{
+			if loadToServe(timeIntervals[jdx].Requests, p.sysConfiguration.PolicySettings) > currentLoadCapacity{
 				timeEnd = timeIntervals[jdx].TimeStart
 				break
 			}
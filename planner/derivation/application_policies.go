@@ -0,0 +1,453 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/planner/execution"
+	"gopkg.in/mgo.v2/bson"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Derive scaling policies for all the services of the application
+	in:
+		@sortedVMProfiles []VmProfile
+		@sysConfiguration SystemConfiguration
+		@forecasts map[string]types.Forecast - forecast of each service
+	out:
+		@[]types.Policy
+*/
+func ApplicationPolicies(sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemConfiguration, forecasts map[string]types.Forecast) ([]types.Policy, error) {
+	log.Info("Request current state" )
+	currentState,err := execution.CurrentState(sysConfiguration)
+
+	if err != nil {
+		log.Errorf("Error to get current state %s", err.Error() )
+	} else {
+		log.Info("Finish request for current state" )
+	}
+	policies, err2 := ApplicationPoliciesFromState(currentState, sortedVMProfiles, sysConfiguration, forecasts)
+	if err2 != nil {
+		return policies, err2
+	}
+	return policies, err
+}
+
+/* Derive scaling policies for all the services of the application starting from a given current state.
+	The policies of each service are derived independently and then merged per algorithm into
+	joint states, where a single VM set hosts the replicas of all the services
+	in:
+		@currentState types.State
+		@sortedVMProfiles []VmProfile
+		@sysConfiguration SystemConfiguration
+		@forecasts map[string]types.Forecast - forecast of each service
+	out:
+		@[]types.Policy
+*/
+func ApplicationPoliciesFromState(currentState types.State, sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemConfiguration,
+	forecasts map[string]types.Forecast) ([]types.Policy, error) {
+	var policies []types.Policy
+	serviceNames := sysConfiguration.ServiceNames()
+
+	policiesByService := make(map[string][]types.Policy)
+	for _,name := range serviceNames {
+		forecast, ok := forecasts[name]
+		if !ok {
+			return policies, errors.New("Forecast not available for service "+ name)
+		}
+		serviceConfiguration := sysConfiguration
+		serviceConfiguration.MainServiceName = name
+		if len(serviceNames) > 1 {
+			//The budget limits the application policy, not the policy of each service
+			serviceConfiguration.PricingModel.Budget = 0
+		}
+		servicePolicies, err := PoliciesFromState(currentState, sortedVMProfiles, serviceConfiguration, forecast)
+		if err != nil {
+			return policies, err
+		}
+		policiesByService[name] = servicePolicies
+	}
+	if len(serviceNames) == 1 {
+		return policiesByService[serviceNames[0]], nil
+	}
+
+	sysConfiguration.PolicySettings.ScalingMethod = scalingMethod(sysConfiguration.PolicySettings.ScalingMethod)
+	systemConfiguration = sysConfiguration
+	mapVMProfiles := VMListToMap(sortedVMProfiles)
+	deployedState := currentState
+	currentState.VMs = currentState.VMs.OnDemandVMSet()
+
+	spentBudget := make(map[string]float64)
+	if sysConfiguration.PricingModel.Budget > 0 {
+		spentBudget = ledgerSpend(sysConfiguration.MainServiceName)
+	}
+
+	//Policies of the same algorithm are merged in the order they were derived
+	for i,p := range policiesByService[serviceNames[0]] {
+		servicePolicies := []types.Policy{}
+		for _,name := range serviceNames {
+			if i >= len(policiesByService[name]) || policiesByService[name][i].Algorithm != p.Algorithm {
+				return policies, errors.New("Policies of algorithm "+ p.Algorithm +" not derived for service "+ name)
+			}
+			servicePolicies = append(servicePolicies, policiesByService[name][i])
+		}
+		policy := mergeServicePolicies(servicePolicies, serviceNames, currentState, mapVMProfiles, sysConfiguration)
+		if sysConfiguration.PolicySettings.SpotInstancesAllowed {
+			mixSpotInstances(&policy, deployedState, mapVMProfiles, sysConfiguration.PolicySettings)
+		} else if len(policy.ScalingActions) > 0 {
+			policy.ScalingActions[0].InitialState = deployedState
+		}
+		capPolicyToBudget(&policy, deployedState, mapVMProfiles, sysConfiguration, spentBudget)
+		setServicesMetrics(&policy, forecasts, sysConfiguration)
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+/* Merge the policies derived for each service into one policy for the whole application
+	in:
+		@servicePolicies []types.Policy - policy of each service, in the same order as serviceNames
+		@serviceNames []string
+		@currentState types.State
+		@mapVMProfiles map[string]types.VmProfile
+		@sysConfiguration util.SystemConfiguration
+	out:
+		@types.Policy
+*/
+func mergeServicePolicies(servicePolicies []types.Policy, serviceNames []string, currentState types.State,
+	mapVMProfiles map[string]types.VmProfile, sysConfiguration util.SystemConfiguration) types.Policy {
+	newPolicy := types.Policy{}
+	newPolicy.Metrics = types.PolicyMetrics {
+		StartTimeDerivation:time.Now(),
+	}
+
+	//Every time a service changes its desired state, the application state changes
+	boundaries := []time.Time{}
+	var windowEnd time.Time
+	for _,p := range servicePolicies {
+		for _,a := range p.ScalingActions {
+			boundaries = append(boundaries, a.TimeStart)
+		}
+		if p.TimeWindowEnd.After(windowEnd) {
+			windowEnd = p.TimeWindowEnd
+		}
+	}
+	boundaries = append(boundaries, windowEnd)
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+	timeBoundaries := []time.Time{}
+	for _,t := range boundaries {
+		if len(timeBoundaries) == 0 || !t.Equal(timeBoundaries[len(timeBoundaries)-1]) {
+			timeBoundaries = append(timeBoundaries, t)
+		}
+	}
+
+	mainServiceName := sysConfiguration.MainServiceName
+	method := sysConfiguration.PolicySettings.ScalingMethod
+	previousState := currentState
+	scalingActions := []types.ScalingAction{}
+	methods := scalingMethods{}
+	for i := 0; i < len(timeBoundaries)-1; i++ {
+		timeStart := timeBoundaries[i]
+		timeEnd := timeBoundaries[i+1]
+		services := make(types.Service)
+		stateLoadCapacity := 0.0
+		for j,name := range serviceNames {
+			action := scalingActionAt(servicePolicies[j].ScalingActions, timeStart)
+			services[name] = action.DesiredState.Services[name]
+			if name == mainServiceName {
+				stateLoadCapacity = action.Metrics.RequestsCapacity
+			}
+		}
+		totalServicesBootingTime := servicesBootingTime(services)
+		vmSet, appliedMethod := applicationVMSet(method, services, previousState.VMs, currentState.VMs, mapVMProfiles, sysConfiguration.PricingModel)
+		methods.add(appliedMethod)
+		state := types.State{
+			Services: services,
+			VMs:      vmSet,
+		}
+		setScalingSteps(&scalingActions, previousState, state, timeStart, timeEnd, totalServicesBootingTime, stateLoadCapacity, sysConfiguration.PolicySettings)
+		previousState = state
+	}
+
+	parameters := make(map[string]string)
+	for k,v := range servicePolicies[0].Parameters {
+		parameters[k] = v
+	}
+	parameters[types.SERVICES] = strings.Join(serviceNames, ",")
+	parameters[types.METHOD] = methods.method(method)
+	numConfigurations := len(scalingActions)
+	newPolicy.ScalingActions = scalingActions
+	newPolicy.Algorithm = servicePolicies[0].Algorithm
+	newPolicy.ID = bson.NewObjectId()
+	newPolicy.Status = types.DISCARTED //State by default
+	newPolicy.Parameters = parameters
+	newPolicy.Metrics.NumberScalingActions = numConfigurations
+	newPolicy.Metrics.FinishTimeDerivation = time.Now()
+	newPolicy.Metrics.DerivationDuration = newPolicy.Metrics.FinishTimeDerivation.Sub(newPolicy.Metrics.StartTimeDerivation).Seconds()
+	if numConfigurations > 0 {
+		newPolicy.TimeWindowStart = scalingActions[0].TimeStart
+		newPolicy.TimeWindowEnd = scalingActions[numConfigurations-1].TimeEnd
+	}
+	return newPolicy
+}
+
+/* Scaling action of a service policy in place at a given time.
+	Before the first action it is the first one and after the last action the last one
+*/
+func scalingActionAt(scalingActions []types.ScalingAction, t time.Time) types.ScalingAction {
+	action := scalingActions[0]
+	for _,a := range scalingActions {
+		if a.TimeStart.After(t) {
+			break
+		}
+		action = a
+	}
+	return action
+}
+
+//Requests per unit of the forecast granularity that each service serves with its replicas
+func servicesCapacity(services types.Service, sysConfiguration util.SystemConfiguration) map[string]float64 {
+	capacity := make(map[string]float64)
+	for name,serviceInfo := range services {
+		limits := types.Limit{CPUCores:serviceInfo.CPU, MemoryGB:serviceInfo.Memory}
+		mscSetting := serviceLoadCapacity(sysConfiguration, name, serviceInfo.Scale, limits)
+		capacity[name] = adjustGranularity(sysConfiguration.ForecastComponent.Granularity, mscSetting.MSCPerSecond)
+	}
+	return capacity
+}
+
+/* Record the capacity of the replicas of each service in the scaling actions of a policy and
+	the over and under provisioning of each service with its forecast
+	in:
+		@policy *types.Policy
+		@forecasts map[string]types.Forecast - forecast of each service
+		@sysConfiguration util.SystemConfiguration
+*/
+func setServicesMetrics(policy *types.Policy, forecasts map[string]types.Forecast, sysConfiguration util.SystemConfiguration) {
+	for i := range policy.ScalingActions {
+		policy.ScalingActions[i].Metrics.ServicesCapacity = servicesCapacity(policy.ScalingActions[i].DesiredState.Services, sysConfiguration)
+	}
+	policy.Metrics.ServicesOverProvision = make(map[string]float64)
+	policy.Metrics.ServicesUnderProvision = make(map[string]float64)
+	for name,forecast := range forecasts {
+		overProvision, underProvision := serviceProvision(policy.ScalingActions, forecast.ForecastedValues, name)
+		policy.Metrics.ServicesOverProvision[name] = overProvision
+		policy.Metrics.ServicesUnderProvision[name] = underProvision
+	}
+}
+
+/* Average percentage of over and under provisioning of a service, first over the forecasted values
+	of each scaling action and then over the scaling actions
+	in:
+		@scalingActions []types.ScalingAction - scaling actions with the capacity of each service
+		@forecast []types.ForecastedValue
+		@serviceName string
+	out:
+		@float64 - over provisioning
+		@float64 - under provisioning
+*/
+func serviceProvision(scalingActions []types.ScalingAction, forecast []types.ForecastedValue, serviceName string) (float64, float64) {
+	if len(scalingActions) == 0 {
+		return 0, 0
+	}
+	totalOver := 0.0
+	totalUnder := 0.0
+	index := 0
+	for _,a := range scalingActions {
+		over := 0.0
+		under := 0.0
+		numSamplesOver := 0.0
+		numSamplesUnder := 0.0
+		for index < len(forecast) && a.TimeEnd.After(forecast[index].TimeStamp) {
+			deltaLoad := a.Metrics.ServicesCapacity[serviceName] - forecast[index].Requests
+			if deltaLoad > 0 {
+				over += deltaLoad*100.0/ forecast[index].Requests
+				numSamplesOver++
+			} else if deltaLoad < 0 {
+				under += -1*deltaLoad*100.0/ forecast[index].Requests
+				numSamplesUnder++
+			}
+			index++
+		}
+		if numSamplesOver > 0 {
+			totalOver += over / numSamplesOver
+		}
+		if numSamplesUnder > 0 {
+			totalUnder += under / numSamplesUnder
+		}
+	}
+	numberScalingActions := float64(len(scalingActions))
+	return util.RoundN(totalOver / numberScalingActions, 2.0), util.RoundN(totalUnder / numberScalingActions, 2.0)
+}
+
+//Time to boot the replicas of all the services, they boot in parallel
+func servicesBootingTime(services types.Service) float64 {
+	bootTime := 0.0
+	for name,serviceInfo := range services {
+		limits := types.Limit{CPUCores:serviceInfo.CPU, MemoryGB:serviceInfo.Memory}
+		mscSetting := serviceLoadCapacity(systemConfiguration, name, serviceInfo.Scale, limits)
+		bootTime = math.Max(bootTime, mscSetting.BootTimeSec)
+	}
+	return bootTime
+}
+
+/* VM set that hosts the replicas of all the services. The previous VM set is kept if it can host them
+	and a new one is not cheaper
+	in:
+		@method string - vm scaling method
+		@services types.Service - replicas and limits of each service
+		@previousVMSet types.VMScale - VM set of the previous state
+		@currentVMSet types.VMScale - VM set currently deployed
+		@mapVMProfiles map[string]types.VmProfile
+		@pricingModel util.PricingModel
+	out:
+		@VMScale
+		@string - method applied, empty if the previous VM set is kept
+*/
+func applicationVMSet(method string, services types.Service, previousVMSet types.VMScale, currentVMSet types.VMScale,
+	mapVMProfiles map[string]types.VmProfile, pricingModel util.PricingModel) (types.VMScale, string) {
+	vmSet,err := buildApplicationVMSet(services, 0, mapVMProfiles, pricingModel)
+	appliedMethod := util.SCALE_METHOD_HORIZONTAL
+	if method != util.SCALE_METHOD_HORIZONTAL {
+		verticalVMSet,errVertical := buildApplicationVMSet(services, currentVMSet.TotalVMs(), mapVMProfiles, pricingModel)
+		if errVertical != nil {
+			log.Warningf("No VM type can host the services in %d VMs, the number of VMs is changed", currentVMSet.TotalVMs())
+		} else if err != nil || method == util.SCALE_METHOD_VERTICAL || vmSetCost(verticalVMSet, mapVMProfiles, pricingModel) <= vmSetCost(vmSet, mapVMProfiles, pricingModel) {
+			vmSet,err = verticalVMSet,nil
+			appliedMethod = util.SCALE_METHOD_VERTICAL
+		}
+	}
+	if canHostServices(services, previousVMSet, mapVMProfiles) && (err != nil || vmSetCost(previousVMSet, mapVMProfiles, pricingModel) <= vmSetCost(vmSet, mapVMProfiles, pricingModel)) {
+		return previousVMSet, ""
+	}
+	if err != nil {
+		log.Errorf("No VM type can host the services %s", err.Error())
+	}
+	return vmSet, appliedMethod
+}
+
+/* Build the cheapest homogeneous VM set able to host the replicas of all the services
+	in:
+		@services types.Service - replicas and limits of each service
+		@numberVMs int - fixed number of VMs, 0 if any number is allowed
+		@mapVMProfiles map[string]types.VmProfile
+		@pricingModel util.PricingModel
+	out:
+		@VMScale
+		@error
+*/
+func buildApplicationVMSet(services types.Service, numberVMs int, mapVMProfiles map[string]types.VmProfile,
+	pricingModel util.PricingModel) (types.VMScale,error) {
+	bestType := ""
+	bestNumber := 0
+	bestCost := math.Inf(1)
+	for vmType,profile := range mapVMProfiles {
+		n := numberVMsToHostServices(services, profile)
+		if n == 0 || (numberVMs > 0 && n > numberVMs) {
+			continue
+		}
+		if numberVMs > 0 {
+			n = numberVMs
+		}
+		cost := vmSetCost(types.VMScale{vmType:n}, mapVMProfiles, pricingModel)
+		if cost < bestCost || (cost == bestCost && vmType < bestType) {
+			bestType = vmType
+			bestNumber = n
+			bestCost = cost
+		}
+	}
+	if bestType == "" {
+		return types.VMScale{},errors.New("No VM Candidate")
+	}
+	return types.VMScale{bestType:bestNumber},nil
+}
+
+//Resources left in a VM to host replicas
+type vmResources struct {
+	cpuCores float64
+	memGB    float64
+}
+
+//Resources of a VM available for replicas, Kubernetes reserves aprox 6% of cores and 25% of Mem
+func availableResources(vmProfile types.VmProfile) vmResources {
+	return vmResources{
+		cpuCores: vmProfile.CPUCores * (1-util.PERCENTAGE_REQUIRED_k8S_INSTALLATION_CPU),
+		memGB: vmProfile.Memory * (1-util.PERCENTAGE_REQUIRED_k8S_INSTALLATION_MEM),
+	}
+}
+
+//Replicas of all the services, the biggest first
+func servicesReplicas(services types.Service) []types.Limit {
+	replicas := []types.Limit{}
+	for _,s := range services {
+		for i := 0; i < s.Scale; i++ {
+			replicas = append(replicas, types.Limit{CPUCores:s.CPU, MemoryGB:s.Memory})
+		}
+	}
+	sort.Slice(replicas, func(i, j int) bool {
+		if replicas[i].CPUCores == replicas[j].CPUCores {
+			return replicas[i].MemoryGB > replicas[j].MemoryGB
+		}
+		return replicas[i].CPUCores > replicas[j].CPUCores
+	})
+	return replicas
+}
+
+//Place a replica in the first VM with enough resources left
+func firstFit(vms []vmResources, replica types.Limit) bool {
+	for i := range vms {
+		if vms[i].cpuCores >= replica.CPUCores && vms[i].memGB >= replica.MemoryGB {
+			vms[i].cpuCores -= replica.CPUCores
+			vms[i].memGB -= replica.MemoryGB
+			return true
+		}
+	}
+	return false
+}
+
+/* Number of VMs of a type needed to host the replicas of all the services, packed first fit decreasing
+	out:
+		@int - number of VMs, 0 if a replica does not fit in the VM type
+*/
+func numberVMsToHostServices(services types.Service, vmProfile types.VmProfile) int {
+	vms := []vmResources{}
+	for _,replica := range servicesReplicas(services) {
+		if !firstFit(vms, replica) {
+			vm := availableResources(vmProfile)
+			if vm.cpuCores < replica.CPUCores || vm.memGB < replica.MemoryGB {
+				return 0
+			}
+			vms = append(vms, vm)
+			firstFit(vms[len(vms)-1:], replica)
+		}
+	}
+	return len(vms)
+}
+
+//Check if a VM set has enough resources to host the replicas of all the services
+func canHostServices(services types.Service, vmSet types.VMScale, mapVMProfiles map[string]types.VmProfile) bool {
+	vms := []vmResources{}
+	for vmType,n := range vmSet {
+		if _,ok := mapVMProfiles[types.OnDemandVMType(vmType)]; !ok {
+			return false
+		}
+		profile := types.VMProfileByType(mapVMProfiles, vmType)
+		for i := 0; i < n; i++ {
+			vms = append(vms, availableResources(profile))
+		}
+	}
+	sort.Slice(vms, func(i, j int) bool {
+		return vms[i].cpuCores > vms[j].cpuCores
+	})
+	for _,replica := range servicesReplicas(services) {
+		if !firstFit(vms, replica) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,305 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/* Cap the VM sets of a policy so that its spend does not exceed the remaining monthly budget. The spend of each month is
+	the cost of the VMs billed as the cost of the policy plus the spend committed for the reserved instances.
+	The capped scaling actions keep fewer replicas, the load they cannot serve is intentional under provisioning
+	in:
+		@policy *types.Policy
+		@deployedState types.State - current state
+		@mapVMProfiles map[string]types.VmProfile
+		@sysConfiguration util.SystemConfiguration
+		@ledgerSpend map[string]float64 - spend of each month already expected by the policies of earlier windows
+*/
+func capPolicyToBudget(policy *types.Policy, deployedState types.State, mapVMProfiles map[string]types.VmProfile,
+	sysConfiguration util.SystemConfiguration, ledgerSpend map[string]float64) {
+	monthlyBudget := sysConfiguration.PricingModel.Budget
+	if monthlyBudget <= 0 || len(policy.ScalingActions) == 0 {
+		return
+	}
+	pricingModel := sysConfiguration.PricingModel
+	numberActions := len(policy.ScalingActions)
+	timesEnd := make([]time.Time, numberActions)
+	for i := range policy.ScalingActions {
+		timesEnd[i] = policy.TimeWindowEnd
+		if i < numberActions - 1 {
+			timesEnd[i] = policy.ScalingActions[i+1].TimeStart
+		}
+	}
+	//The reserved instances are paid in each month whether they are used or not
+	committedBudget := make(map[string]float64)
+	for k,v := range ledgerSpend {
+		committedBudget[k] = v
+	}
+	for _,period := range monthPeriods(policy.TimeWindowStart, policy.TimeWindowEnd) {
+		committedBudget[period.month] += committedSpend(pricingModel, period.timeStart, period.timeEnd)
+	}
+
+	budgetLimited := false
+	scalingActions := []types.ScalingAction{}
+	previousState := deployedState
+	for i,a := range policy.ScalingActions {
+		//Budget kept to run at least one VM in the following scaling actions of each month
+		minimumBudget := make(map[string]float64)
+		for j := i + 1; j < numberActions; j++ {
+			next := policy.ScalingActions[j]
+			for _,period := range monthPeriods(next.TimeStart, timesEnd[j]) {
+				minimumBudget[period.month] += cheapestVMCost(next.DesiredState.VMs, mapVMProfiles, pricingModel) *
+					period.timeEnd.Sub(period.timeStart).Hours()
+			}
+		}
+
+		state := a.DesiredState
+		stateLoadCapacity := a.Metrics.RequestsCapacity
+		capped := false
+		candidateActions := withScalingStep(scalingActions, previousState, state, a.TimeStart, timesEnd[i], stateLoadCapacity, sysConfiguration.PolicySettings)
+		for exceedsBudget(candidateActions, monthlyBudget, committedBudget, minimumBudget, mapVMProfiles, pricingModel) &&
+			state.VMs.TotalVMs() > 1 && vmSetCost(state.VMs, mapVMProfiles, pricingModel) > 0 {
+			//Release the VM that saves more
+			state = budgetState(state, vmSetCost(state.VMs, mapVMProfiles, pricingModel) - BUDGET_EPSILON, mapVMProfiles, pricingModel)
+			capacity := servicesCapacity(state.Services, sysConfiguration)
+			stateLoadCapacity = capacity[sysConfiguration.MainServiceName]
+			candidateActions = withScalingStep(scalingActions, previousState, state, a.TimeStart, timesEnd[i], stateLoadCapacity, sysConfiguration.PolicySettings)
+			candidateActions[len(candidateActions)-1].Metrics.ServicesCapacity = capacity
+			capped = true
+		}
+		scalingActions = candidateActions
+		if capped {
+			budgetLimited = true
+			last := len(scalingActions) - 1
+			scalingActions[last].Metrics.BudgetLimited = true
+		}
+		previousState = state
+	}
+	policy.Parameters[types.ISBUDGETLIMITED] = strconv.FormatBool(budgetLimited)
+	if !budgetLimited {
+		return
+	}
+	log.Warningf("Policy of algorithm %s limited by the monthly budget %.2f", policy.Algorithm, monthlyBudget)
+	policy.ScalingActions = scalingActions
+	policy.Metrics.NumberScalingActions = len(scalingActions)
+	policy.TimeWindowStart = scalingActions[0].TimeStart
+	policy.TimeWindowEnd = scalingActions[len(scalingActions)-1].TimeEnd
+}
+
+//Cost below which a VM set fits in an hourly budget
+const BUDGET_EPSILON = 1e-9
+
+//Scaling actions with the scaling step to a new state, without changing the scaling actions given
+func withScalingStep(scalingActions []types.ScalingAction, currentState types.State, newState types.State,
+	timeStart time.Time, timeEnd time.Time, stateLoadCapacity float64, policySettings util.PolicySettings) []types.ScalingAction {
+	candidateActions := make([]types.ScalingAction, len(scalingActions))
+	copy(candidateActions, scalingActions)
+	setScalingSteps(&candidateActions, currentState, newState, timeStart, timeEnd, servicesBootingTime(newState.Services), stateLoadCapacity, policySettings)
+	return candidateActions
+}
+
+/* Check if the spend of scaling actions exceeds the budget of a month. The VMs are billed as the cost of the policy
+	in each month in which they run, with the reserved VMs already included in the committed budget
+	in:
+		@scalingActions []types.ScalingAction
+		@monthlyBudget float64
+		@committedBudget map[string]float64 - spend of each month committed before the scaling actions
+		@minimumBudget map[string]float64 - budget of each month kept for the following scaling actions
+		@mapVMProfiles map[string]types.VmProfile
+		@pricingModel util.PricingModel
+	out:
+		@bool
+*/
+func exceedsBudget(scalingActions []types.ScalingAction, monthlyBudget float64, committedBudget map[string]float64,
+	minimumBudget map[string]float64, mapVMProfiles map[string]types.VmProfile, pricingModel util.PricingModel) bool {
+	monthlySpend := make(map[string]float64)
+	for _,monthlyCosts := range vmsMonthlyBilledCost(scalingActions, marginalPricingModel(pricingModel), mapVMProfiles) {
+		for month,c := range monthlyCosts {
+			monthlySpend[month] += c
+		}
+	}
+	for month,spend := range monthlySpend {
+		if spend + committedBudget[month] + minimumBudget[month] > monthlyBudget {
+			return true
+		}
+	}
+	return false
+}
+
+//Pricing model with the reserved instances already paid, so the reserved VMs are billed without cost
+func marginalPricingModel(pricingModel util.PricingModel) util.PricingModel {
+	reservedInstances := make([]util.ReservedInstance, len(pricingModel.ReservedInstances))
+	for i,r := range pricingModel.ReservedInstances {
+		r.Price = 0
+		r.UpfrontPrice = 0
+		reservedInstances[i] = r
+	}
+	pricingModel.ReservedInstances = reservedInstances
+	return pricingModel
+}
+
+/* Remove VMs from a state until its marginal cost per hour fits in the budget, keeping at least one VM.
+	The replicas of the services are reduced until the remaining VMs can host them
+	in:
+		@state types.State
+		@hourlyBudget float64
+		@mapVMProfiles map[string]types.VmProfile
+		@pricingModel util.PricingModel
+	out:
+		@types.State
+*/
+func budgetState(state types.State, hourlyBudget float64, mapVMProfiles map[string]types.VmProfile,
+	pricingModel util.PricingModel) types.State {
+	vmSet := copyMap(state.VMs)
+	for types.VMScale(vmSet).TotalVMs() > 1 && vmSetCost(vmSet, mapVMProfiles, pricingModel) > hourlyBudget {
+		//Release the VM that saves more
+		var vmType string
+		saving := -1.0
+		cost := vmSetCost(vmSet, mapVMProfiles, pricingModel)
+		for k,v := range vmSet {
+			if v == 0 {
+				continue
+			}
+			vmSet[k]--
+			s := cost - vmSetCost(vmSet, mapVMProfiles, pricingModel)
+			vmSet[k]++
+			if s > saving || (s == saving && k < vmType) {
+				vmType = k
+				saving = s
+			}
+		}
+		vmSet[vmType]--
+	}
+	cleanKeys(vmSet)
+
+	services := make(types.Service)
+	for name,serviceInfo := range state.Services {
+		services[name] = serviceInfo
+	}
+	for !canHostServices(services, vmSet, mapVMProfiles) {
+		//Remove a replica of the service with more replicas
+		var serviceName string
+		for name,serviceInfo := range services {
+			if serviceInfo.Scale > 1 && (serviceName == "" || serviceInfo.Scale > services[serviceName].Scale ||
+				(serviceInfo.Scale == services[serviceName].Scale && name < serviceName)) {
+				serviceName = name
+			}
+		}
+		if serviceName == "" {
+			break
+		}
+		serviceInfo := services[serviceName]
+		serviceInfo.Scale--
+		services[serviceName] = serviceInfo
+	}
+	return types.State{Services:services, VMs:vmSet}
+}
+
+//Marginal cost per hour of the cheapest VM of a VM set
+func cheapestVMCost(vmSet types.VMScale, mapVMProfiles map[string]types.VmProfile, pricingModel util.PricingModel) float64 {
+	cost := -1.0
+	for k,v := range vmSet {
+		if v == 0 {
+			continue
+		}
+		if c := vmSetCost(types.VMScale{k:1}, mapVMProfiles, pricingModel); cost < 0 || c < cost {
+			cost = c
+		}
+	}
+	return math.Max(0, cost)
+}
+
+
+/* Entries of the budget ledger with the expected spend of a policy in each calendar month, with the VMs billed in each
+	month in which they run as the derivation bills them. The time window of each entry spans the scaling actions of its month
+	in:
+		@policy types.Policy
+		@pricingModel util.PricingModel
+		@mapVMProfiles map[string]types.VmProfile
+	out:
+		@[]types.BudgetEntry - sorted by month
+*/
+func BudgetEntries(policy types.Policy, pricingModel util.PricingModel, mapVMProfiles map[string]types.VmProfile) []types.BudgetEntry {
+	entries := []types.BudgetEntry{}
+	index := make(map[string]int)
+	monthlyCosts := vmsMonthlyBilledCost(policy.ScalingActions, pricingModel, mapVMProfiles)
+	for i,a := range policy.ScalingActions {
+		for _,period := range monthPeriods(a.TimeStart, a.TimeEnd) {
+			if _,ok := index[period.month]; !ok {
+				index[period.month] = len(entries)
+				entries = append(entries, types.BudgetEntry{
+					ID:              bson.NewObjectId(),
+					PolicyID:        policy.ID,
+					Month:           period.month,
+					TimeWindowStart: period.timeStart,
+					TimeWindowEnd:   period.timeEnd,
+				})
+			}
+			entry := &entries[index[period.month]]
+			entry.ExpectedSpend += monthlyCosts[i][period.month]
+			if period.timeEnd.After(entry.TimeWindowEnd) {
+				entry.TimeWindowEnd = period.timeEnd
+			}
+		}
+	}
+	return entries
+}
+
+//Spend of each month recorded in the budget ledger of a service
+func ledgerSpend(serviceName string) map[string]float64 {
+	spentBudget := make(map[string]float64)
+	entries, err := storage.GetBudgetLedgerDAO(serviceName).FindAll()
+	if err != nil {
+		log.Warningf("Budget ledger not available, the full budget is used. Error %s", err.Error())
+		return spentBudget
+	}
+	for _,e := range entries {
+		spentBudget[e.Month] += e.ExpectedSpend
+	}
+	return spentBudget
+}
+
+/* Summary of the budget ledger per calendar month
+	in:
+		@monthlyBudget float64
+		@entries []types.BudgetEntry
+	out:
+		@[]types.MonthlyBudget - sorted by month
+*/
+func MonthlyBudgets(monthlyBudget float64, entries []types.BudgetEntry) []types.MonthlyBudget {
+	spentBudget := make(map[string]float64)
+	for _,e := range entries {
+		spentBudget[e.Month] += e.ExpectedSpend
+	}
+	months := []string{}
+	for k := range spentBudget {
+		months = append(months, k)
+	}
+	sort.Strings(months)
+	budgets := []types.MonthlyBudget{}
+	for _,m := range months {
+		budgets = append(budgets, types.MonthlyBudget{
+			Month:         m,
+			Budget:        monthlyBudget,
+			ExpectedSpend: util.RoundN(spentBudget[m], 2.0),
+			Remaining:     util.RoundN(monthlyBudget - spentBudget[m], 2.0),
+		})
+	}
+	return budgets
+}
+
+//Time of the first scaling action limited by the budget, zero if the policy is not limited
+func budgetLimitTime(policy types.Policy) time.Time {
+	for _,a := range policy.ScalingActions {
+		if a.Metrics.BudgetLimited {
+			return a.TimeStart
+		}
+	}
+	return time.Time{}
+}
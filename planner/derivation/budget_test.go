@@ -0,0 +1,167 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPoliciesCappedToBudget(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 20)
+	defer reset()
+	mapVMProfiles := VMListToMap(vmProfiles)
+
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxCost := 0.0
+	for _,p := range policies {
+		if p.Parameters[types.ISBUDGETLIMITED] != "false" {
+			t.Error("Policy of algorithm ", p.Algorithm, " not expected to be limited by the budget")
+		}
+		if cost := runningCost(p, mapVMProfiles); cost > maxCost {
+			maxCost = cost
+		}
+	}
+
+	sysConfiguration.PricingModel.Budget = maxCost / 2
+	policies, err = PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := false
+	for _,p := range policies {
+		//Policies keep at least one VM
+		if cost := runningCost(p, mapVMProfiles); cost > sysConfiguration.PricingModel.Budget + 0.01 && maxVMs(p) > 1 {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected cost under: ", sysConfiguration.PricingModel.Budget, "got: ", cost)
+		}
+		if p.Parameters[types.ISBUDGETLIMITED] == "true" {
+			limited = true
+			if budgetLimitTime(p).IsZero() {
+				t.Error("Policy of algorithm ", p.Algorithm, " expected scaling actions limited by the budget")
+			}
+		}
+	}
+	if !limited {
+		t.Error("Expected policies limited by the budget: ", sysConfiguration.PricingModel.Budget)
+	}
+	if _, err = SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBudgetState(t *testing.T) {
+	mapVMProfiles := reservationProfiles()
+	state := types.State{
+		Services: types.Service{"s": {Scale:8, CPU:1, Memory:1}},
+		VMs: types.VMScale{"a":2, "b":1},
+	}
+	capped := budgetState(state, 2, mapVMProfiles, util.PricingModel{})
+	if !capped.VMs.Equal(types.VMScale{"a":2}) || capped.Services["s"].Scale != 2 {
+		t.Error("Expected: ", types.VMScale{"a":2}, 2, "got: ", capped.VMs, capped.Services["s"].Scale)
+	}
+	capped = budgetState(state, 0, mapVMProfiles, util.PricingModel{})
+	if capped.VMs.TotalVMs() != 1 || capped.Services["s"].Scale < 1 {
+		t.Error("Expected at least one VM and one replica, got: ", capped.VMs, capped.Services["s"].Scale)
+	}
+}
+
+func maxVMs(policy types.Policy) int {
+	n := 0
+	for _,a := range policy.ScalingActions {
+		if a.DesiredState.VMs.TotalVMs() > n {
+			n = a.DesiredState.VMs.TotalVMs()
+		}
+	}
+	return n
+}
+
+//Cost of the VMs of a policy during its time window, without billing rounding
+func runningCost(policy types.Policy, mapVMProfiles map[string]types.VmProfile) float64 {
+	cost := 0.0
+	for i,a := range policy.ScalingActions {
+		timeEnd := policy.TimeWindowEnd
+		if i < len(policy.ScalingActions) - 1 {
+			timeEnd = policy.ScalingActions[i+1].TimeStart
+		}
+		cost += vmSetHourlyCost(a.DesiredState.VMs, mapVMProfiles, nil) * timeEnd.Sub(a.TimeStart).Hours()
+	}
+	return cost
+}
+
+func TestPoliciesUseRemainingBudgetOfLedger(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 20)
+	defer reset()
+
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapVMProfiles := VMListToMap(vmProfiles)
+	expectedSpend := 0.0
+	for _,c := range vmsBilledCost(policy.ScalingActions, sysConfiguration.PricingModel, mapVMProfiles) {
+		expectedSpend += c
+	}
+	entries := BudgetEntries(policy, sysConfiguration.PricingModel, mapVMProfiles)
+	if len(entries) != 1 || entries[0].Month != "2018-11" || math.Abs(entries[0].ExpectedSpend - expectedSpend) > 1e-9 {
+		t.Fatal("Expected the spend: ", expectedSpend, "in month 2018-11, got: ", entries)
+	}
+
+	//An earlier window of the month spent almost all the budget
+	budgetLedgerDAO := storage.GetBudgetLedgerDAO(sysConfiguration.MainServiceName)
+	budgetLedgerDAO.Insert(types.BudgetEntry{Month:"2018-11", ExpectedSpend:sysConfiguration.PricingModel.Budget - policy.Metrics.Cost / 2})
+	policies, err = PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := false
+	for _,p := range policies {
+		limited = limited || p.Parameters[types.ISBUDGETLIMITED] == "true"
+	}
+	if !limited {
+		t.Error("Expected policies limited by the remaining budget")
+	}
+
+	budgets := MonthlyBudgets(sysConfiguration.PricingModel.Budget, append(entries, types.BudgetEntry{Month:"2018-12", ExpectedSpend:3}))
+	if len(budgets) != 2 || budgets[0].Month != "2018-11" || budgets[1].Remaining != sysConfiguration.PricingModel.Budget - 3 {
+		t.Error("Unexpected monthly budgets: ", budgets)
+	}
+}
+
+func TestSelectPolicyOverBudget(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 20)
+	defer reset()
+
+	//A single VM costs more than the budget
+	sysConfiguration.PricingModel.Budget = 0.001
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast)
+	if err == nil || policy.Status == types.SELECTED || policy.Parameters[types.ISOVERBUDGET] != "true" {
+		t.Error("Expected the policy capped to the budget marked over budget, got: ", policy.Status, policy.Parameters[types.ISOVERBUDGET], err)
+	}
+}
+
+func TestBudgetEntriesAcrossMonths(t *testing.T) {
+	start := time.Date(2018, 11, 30, 12, 0, 0, 0, time.UTC)
+	december := time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)
+	policy := types.Policy{ScalingActions:[]types.ScalingAction{
+		{TimeStart:start, TimeEnd:start.Add(24 * time.Hour), DesiredState:types.State{VMs:types.VMScale{"a":1}}},
+	}}
+	//The VM runs 12 hours in each month
+	entries := BudgetEntries(policy, util.PricingModel{BillingUnit:util.HOUR}, reservationProfiles())
+	if len(entries) != 2 || entries[0].Month != "2018-11" || entries[0].ExpectedSpend != 12 || !entries[0].TimeWindowEnd.Equal(december) ||
+		entries[1].Month != "2018-12" || entries[1].ExpectedSpend != 12 || !entries[1].TimeWindowStart.Equal(december) {
+		t.Error("Expected the spend split between November and December, got: ", entries)
+	}
+}
@@ -0,0 +1,109 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"errors"
+	"sort"
+	"sync"
+)
+
+//Booting times of the catalogs being derived, by provider and region. They are not stored
+var catalogBootingProfiles = make(map[string]*storage.VMBootingProfileMemoryDAO)
+var catalogBootingProfilesMux sync.Mutex
+
+func catalogKey(csp string, region string) string {
+	return csp + "/" + region
+}
+
+//Booting times of the VM types of the provider and region of a configuration
+func bootingProfileDAO(sysConfiguration util.SystemConfiguration) storage.VMBootingProfileStorage {
+	catalogBootingProfilesMux.Lock()
+	defer catalogBootingProfilesMux.Unlock()
+	if dao,ok := catalogBootingProfiles[catalogKey(sysConfiguration.CSP, sysConfiguration.Region)]; ok {
+		return dao
+	}
+	return storage.GetVMBootingProfileDAO()
+}
+
+/* Derive and select the policy of the application with the VM profiles of a catalog.
+	The current state is translated to the catalog if its VM types are not offered there
+	in:
+		@currentState types.State
+		@catalog types.Catalog
+		@sysConfiguration util.SystemConfiguration - configuration for the provider and region of the catalog
+		@forecasts map[string]types.Forecast - forecast of each service
+	out:
+		@types.CatalogPolicy
+*/
+func CatalogPolicy(currentState types.State, catalog types.Catalog, sysConfiguration util.SystemConfiguration,
+	forecasts map[string]types.Forecast) types.CatalogPolicy {
+	catalogPolicy := types.CatalogPolicy{CSP:catalog.CSP, Region:catalog.Region}
+	//The booting times of the catalog are only kept during its derivation
+	key := catalogKey(catalog.CSP, catalog.Region)
+	catalogBootingProfilesMux.Lock()
+	catalogBootingProfiles[key] = &storage.VMBootingProfileMemoryDAO{VMBootingProfiles:catalog.BootingProfiles}
+	catalogBootingProfilesMux.Unlock()
+	defer func() {
+		catalogBootingProfilesMux.Lock()
+		delete(catalogBootingProfiles, key)
+		catalogBootingProfilesMux.Unlock()
+	}()
+	state, err := catalogState(currentState, catalog.VMProfiles)
+	if err != nil {
+		catalogPolicy.Error = err.Error()
+		return catalogPolicy
+	}
+	policies, err := ApplicationPoliciesFromState(state, catalog.VMProfiles, sysConfiguration, forecasts)
+	if err != nil {
+		catalogPolicy.Error = err.Error()
+		return catalogPolicy
+	}
+	selectedPolicy, err := SelectPolicy(&policies, sysConfiguration, catalog.VMProfiles, forecasts[sysConfiguration.MainServiceName])
+	if err != nil {
+		catalogPolicy.Error = err.Error()
+		return catalogPolicy
+	}
+	catalogPolicy.Policy = selectedPolicy
+	return catalogPolicy
+}
+
+/* State of the catalog from which the derivation starts. If the catalog does not offer the current VM types,
+	the services are hosted by the cheapest homogeneous VM set of the catalog
+	in:
+		@currentState types.State
+		@sortedVMProfiles []types.VmProfile - VM profiles of the catalog
+	out:
+		@types.State
+		@error - if no VM type of the catalog can host the services
+*/
+func catalogState(currentState types.State, sortedVMProfiles []types.VmProfile) (types.State, error) {
+	mapVMProfiles := VMListToMap(sortedVMProfiles)
+	if available,_ := validateVMProfilesAvailable(currentState.VMs, mapVMProfiles); available {
+		return currentState, nil
+	}
+	var vmSet types.VMScale
+	cost := 0.0
+	for _,profile := range sortedVMProfiles {
+		numberVMs := numberVMsToHostServices(currentState.Services, profile)
+		if numberVMs > 0 && (vmSet == nil || float64(numberVMs) * profile.Pricing.Price < cost) {
+			vmSet = types.VMScale{profile.Type:numberVMs}
+			cost = float64(numberVMs) * profile.Pricing.Price
+		}
+	}
+	if vmSet == nil {
+		return currentState, errors.New("No VM type of the catalog can host the services")
+	}
+	return types.State{Services:currentState.Services, VMs:vmSet}, nil
+}
+
+//Sort the policies of the catalogs by cost, the catalogs without policy go last
+func SortCatalogPolicies(catalogPolicies []types.CatalogPolicy) {
+	sort.SliceStable(catalogPolicies, func(i, j int) bool {
+		if (catalogPolicies[i].Error == "") != (catalogPolicies[j].Error == "") {
+			return catalogPolicies[i].Error == ""
+		}
+		return catalogPolicies[i].Policy.Metrics.Cost < catalogPolicies[j].Policy.Metrics.Cost
+	})
+}
@@ -0,0 +1,83 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCatalogPolicies(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+	forecasts := map[string]types.Forecast{sysConfiguration.MainServiceName:forecast}
+
+	//Catalog of another provider with the same VMs at twice the price
+	otherVMProfiles := []types.VmProfile{}
+	for _,p := range vmProfiles {
+		p.Type = "other." + p.Type
+		p.Pricing.Price *= 2
+		otherVMProfiles = append(otherVMProfiles, p)
+	}
+	state, err := catalogState(currentState, otherVMProfiles)
+	if err != nil || !canHostServices(state.Services, state.VMs, VMListToMap(otherVMProfiles)) ||
+		!state.Services["primeapp"].Equal(currentState.Services["primeapp"]) {
+		t.Error("Expected the current services hosted by VMs of the catalog, got: ", state, err)
+	}
+
+	catalogPolicies := []types.CatalogPolicy{
+		CatalogPolicy(currentState, types.Catalog{CSP:"other", VMProfiles:otherVMProfiles}, sysConfiguration, forecasts),
+		CatalogPolicy(currentState, types.Catalog{CSP:"empty"}, sysConfiguration, forecasts),
+		CatalogPolicy(currentState, types.Catalog{CSP:"AWS", VMProfiles:vmProfiles}, sysConfiguration, forecasts),
+	}
+	SortCatalogPolicies(catalogPolicies)
+
+	expected := []string{"AWS", "other", "empty"}
+	for i,c := range catalogPolicies {
+		if c.CSP != expected[i] {
+			t.Fatal("Expected catalogs: ", expected, "got: ", c.CSP, "at ", i)
+		}
+	}
+	if catalogPolicies[0].Error != "" || catalogPolicies[1].Error != "" || catalogPolicies[2].Error == "" {
+		t.Error("Expected an error only for the empty catalog, got: ", catalogPolicies[0].Error, catalogPolicies[1].Error, catalogPolicies[2].Error)
+	}
+	if catalogPolicies[0].Policy.Metrics.Cost >= catalogPolicies[1].Policy.Metrics.Cost {
+		t.Error("Expected a cheaper policy for AWS, got: ", catalogPolicies[0].Policy.Metrics.Cost, catalogPolicies[1].Policy.Metrics.Cost)
+	}
+	for _,sa := range catalogPolicies[1].Policy.ScalingActions {
+		for vmType := range sa.DesiredState.VMs {
+			if !strings.HasPrefix(vmType, "other.") {
+				t.Error("Expected VM types of the catalog, got: ", vmType)
+			}
+		}
+	}
+}
+
+func TestCatalogBootingProfiles(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+	forecasts := map[string]types.Forecast{sysConfiguration.MainServiceName:forecast}
+	bootingProfiles := []types.InstancesBootShutdownTime{{VMType:"t2.micro", InstancesValues:[]types.BootShutDownTime{
+		{NumInstances:1, BootTime:123, ShutDownTime:45},
+	}}}
+
+	catalogConfiguration := sysConfiguration
+	catalogConfiguration.CSP = "other"
+	catalogBootingProfiles[catalogKey("other", "")] = &storage.VMBootingProfileMemoryDAO{VMBootingProfiles:bootingProfiles}
+	if bootTime := computeVMBootingTime(types.VMScale{"t2.micro":1}, catalogConfiguration); bootTime != 123 {
+		t.Error("Expected the booting time of the catalog: ", 123, "got: ", bootTime)
+	}
+	delete(catalogBootingProfiles, catalogKey("other", ""))
+
+	stored,_ := storage.GetVMBootingProfileDAO().FindAll()
+	catalogPolicy := CatalogPolicy(currentState, types.Catalog{CSP:"other", VMProfiles:vmProfiles, BootingProfiles:bootingProfiles},
+		catalogConfiguration, forecasts)
+	if catalogPolicy.Error != "" {
+		t.Fatal(catalogPolicy.Error)
+	}
+	storedAfter,_ := storage.GetVMBootingProfileDAO().FindAll()
+	if !reflect.DeepEqual(stored, storedAfter) || len(catalogBootingProfiles) != 0 {
+		t.Error("Expected the booting times of the catalog not to be kept, got: ", storedAfter, catalogBootingProfiles)
+	}
+}
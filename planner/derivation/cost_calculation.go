@@ -5,62 +5,352 @@ import (
 	"time"
 	"math"
 	"github.com/Cloud-Pie/SPDT/util"
+	"sort"
+	"strconv"
 )
 
 
 //Compute the total cost for a given policy
-//It takes into account the billing unit according to the pricing model
-func ComputePolicyCost(policy types.Policy, billingUnit string, mapVMProfiles map[string] types.VmProfile) float64 {
+//It takes into account the billing rules and the reserved instances according to the pricing model
+func ComputePolicyCost(policy types.Policy, pricingModel util.PricingModel, mapVMProfiles map[string] types.VmProfile) float64 {
 	totalCost := 0.0
-	for cfi,cf := range policy.ScalingActions {
-		configurationCost := computeConfigurationCost(cf, billingUnit, mapVMProfiles)
+	for cfi,configurationCost := range vmsBilledCost(policy.ScalingActions, pricingModel, mapVMProfiles) {
 		policy.ScalingActions[cfi].Metrics.Cost = math.Ceil(configurationCost*100)/100
 		totalCost += configurationCost
 	}
 	return totalCost
 }
 
-//Compute cost for a configuration of resources
-func computeConfigurationCost(cf types.ScalingAction, unit string, mapVMProfiles map[string] types.VmProfile) float64 {
-	configurationCost := 0.0
-	deltaTime := BilledTime(cf.TimeStart,cf.TimeEnd,unit)
-	for k,v := range cf.DesiredState.VMs {
-		configurationCost += mapVMProfiles [k].Pricing.Price * float64(v) * deltaTime
+//Time that a VM runs between its launch and its release
+type vmRun struct {
+	vmType    string
+	slot      int	//Position of the VM among the VMs of its type
+	first     int	//Index of the scaling action where the VM is launched
+	last      int	//Index of the last scaling action where the VM runs
+	timeStart time.Time
+	timeEnd   time.Time
+}
+
+/* Find the runs of each VM across the scaling actions. The VMs of a type are released in the reverse order of their launch,
+	so the VM in the position n of its type runs while the set has more than n VMs of that type
+	in:
+		@scalingActions []types.ScalingAction
+	out:
+		@[]vmRun
+*/
+func vmRuns(scalingActions []types.ScalingAction) []vmRun {
+	maxVMs := make(map[string]int)
+	for _,a := range scalingActions {
+		for k,v := range a.DesiredState.VMs {
+			if v > maxVMs[k] {
+				maxVMs[k] = v
+			}
+		}
+	}
+	vmTypes := []string{}
+	for k := range maxVMs {
+		vmTypes = append(vmTypes, k)
+	}
+	sort.Strings(vmTypes)
+
+	runs := []vmRun{}
+	for _,k := range vmTypes {
+		for slot := 0; slot < maxVMs[k]; slot++ {
+			first := -1
+			for i,a := range scalingActions {
+				running := a.DesiredState.VMs[k] > slot
+				if running && first < 0 {
+					first = i
+				}
+				if first >= 0 && (!running || i == len(scalingActions)-1) {
+					last := i
+					if !running {
+						last = i - 1
+					}
+					runs = append(runs, vmRun{vmType:k, slot:slot, first:first, last:last,
+						timeStart:scalingActions[first].TimeStart, timeEnd:scalingActions[last].TimeEnd})
+					first = -1
+				}
+			}
+		}
+	}
+	return runs
+}
+
+/* Cost of the VMs of a policy, billing each VM from its launch to its release. The reserved VMs are charged at their
+	committed rate, the others according to the billing unit with their monthly cap
+	in:
+		@scalingActions []types.ScalingAction
+		@pricingModel util.PricingModel
+		@mapVMProfiles map[string]types.VmProfile
+	out:
+		@[]float64 - cost of each scaling action, the cost of a VM is shared among the actions proportionally to their duration
+*/
+func vmsBilledCost(scalingActions []types.ScalingAction, pricingModel util.PricingModel, mapVMProfiles map[string] types.VmProfile) []float64 {
+	costs := make([]float64, len(scalingActions))
+	for i,monthlyCosts := range vmsMonthlyBilledCost(scalingActions, pricingModel, mapVMProfiles) {
+		for _,c := range monthlyCosts {
+			costs[i] += c
+		}
+	}
+	return costs
+}
+
+/* Cost of the VMs of a policy billed in each calendar month, as billed by vmsBilledCost
+	in:
+		@scalingActions []types.ScalingAction
+		@pricingModel util.PricingModel
+		@mapVMProfiles map[string]types.VmProfile
+	out:
+		@[]map[string]float64 - cost of each scaling action in each month in which its VMs are billed
+*/
+func vmsMonthlyBilledCost(scalingActions []types.ScalingAction, pricingModel util.PricingModel, mapVMProfiles map[string] types.VmProfile) []map[string]float64 {
+	costs := make([]map[string]float64, len(scalingActions))
+	for i := range costs {
+		costs[i] = make(map[string]float64)
+	}
+	reservedInstances := reservedInstancesByType(pricingModel)
+	monthlyBilledHours := make(map[string]float64)
+	for _,run := range vmRuns(scalingActions) {
+		price := types.VMProfileByType(mapVMProfiles, run.vmType).Pricing.Price
+		runHours := run.timeEnd.Sub(run.timeStart).Hours()
+		billedHours := runHours
+		reserved, ok := reservedInstances[run.vmType]
+		isReserved := ok && !types.IsSpotVMType(run.vmType) && run.slot < reserved.Number
+		if isReserved {
+			price = reserved.HourlyRate()
+		} else {
+			billedHours = BilledTime(run.timeStart, run.timeEnd, pricingModel)
+		}
+
+		//The hours billed are split among the months proportionally to the time the VM runs in each one
+		for _,period := range monthPeriods(run.timeStart, run.timeEnd) {
+			periodBilledHours := billedHours
+			if runHours > 0 {
+				periodBilledHours = billedHours * period.timeEnd.Sub(period.timeStart).Hours() / runHours
+			}
+			if !isReserved && pricingModel.MonthlyCapHours > 0 {
+				month := run.vmType + "/" + strconv.Itoa(run.slot) + "/" + period.month
+				periodBilledHours = math.Min(periodBilledHours, math.Max(0, pricingModel.MonthlyCapHours - monthlyBilledHours[month]))
+				monthlyBilledHours[month] += periodBilledHours
+			}
+
+			actionsHours := 0.0
+			for i := run.first; i <= run.last; i++ {
+				actionsHours += overlapHours(scalingActions[i].TimeStart, scalingActions[i].TimeEnd, period.timeStart, period.timeEnd)
+			}
+			for i := run.first; i <= run.last; i++ {
+				share := 1.0 / float64(run.last - run.first + 1)
+				if actionsHours > 0 {
+					share = overlapHours(scalingActions[i].TimeStart, scalingActions[i].TimeEnd, period.timeStart, period.timeEnd) / actionsHours
+				}
+				costs[i][period.month] += price * periodBilledHours * share
+			}
+		}
+	}
+	return costs
+}
+
+//Part of a time window within a calendar month
+type monthPeriod struct {
+	month     string
+	timeStart time.Time
+	timeEnd   time.Time
+}
+
+//Split a time window at the start of each calendar month, a window without duration is in the month it starts
+func monthPeriods(timeStart time.Time, timeEnd time.Time) []monthPeriod {
+	periods := []monthPeriod{}
+	for {
+		periodEnd := time.Date(timeStart.Year(), timeStart.Month()+1, 1, 0, 0, 0, 0, timeStart.Location())
+		if !periodEnd.Before(timeEnd) {
+			periodEnd = timeEnd
+		}
+		periods = append(periods, monthPeriod{month:timeStart.Format(util.BUDGET_MONTH_FORMAT), timeStart:timeStart, timeEnd:periodEnd})
+		if !periodEnd.Before(timeEnd) {
+			return periods
+		}
+		timeStart = periodEnd
 	}
-	return  configurationCost
 }
 
-//Calculate detlta time for a time window
-func BilledTime(timeStart time.Time, timeEnd time.Time, unit string) float64 {
-	var delta float64
-	delta = timeEnd.Sub(timeStart).Hours()
-	switch unit {
+//Hours in which two time windows overlap
+func overlapHours(timeStart1 time.Time, timeEnd1 time.Time, timeStart2 time.Time, timeEnd2 time.Time) float64 {
+	timeStart := timeStart1
+	if timeStart2.After(timeStart) {
+		timeStart = timeStart2
+	}
+	timeEnd := timeEnd1
+	if timeEnd2.Before(timeEnd) {
+		timeEnd = timeEnd2
+	}
+	return math.Max(0, timeEnd.Sub(timeStart).Hours())
+}
+
+//Reserved instances of each VM type
+func reservedInstancesByType(pricingModel util.PricingModel) map[string]util.ReservedInstance {
+	reservedInstances := make(map[string]util.ReservedInstance)
+	for _,r := range pricingModel.ReservedInstances {
+		if reserved,ok := reservedInstances[r.VMType]; ok {
+			//Reservations of the same type are charged at their average rate
+			number := reserved.Number + r.Number
+			if number > 0 {
+				reserved.Price = (reserved.HourlyRate()*float64(reserved.Number) + r.HourlyRate()*float64(r.Number)) / float64(number)
+			}
+			reserved.UpfrontPrice = 0
+			reserved.Number = number
+			r = reserved
+		}
+		reservedInstances[r.VMType] = r
+	}
+	return reservedInstances
+}
+
+/* Cost per hour of a VM set. The reserved VMs of each type are charged at their committed rate
+	and the rest at the on-demand or spot price
+	in:
+		@vmSet types.VMScale
+		@mapVMProfiles map[string]types.VmProfile
+		@reservedInstances map[string]util.ReservedInstance
+	out:
+		@float64
+*/
+func vmSetHourlyCost(vmSet types.VMScale, mapVMProfiles map[string] types.VmProfile, reservedInstances map[string]util.ReservedInstance) float64 {
+	cost := 0.0
+	for k,v := range vmSet {
+		price := types.VMProfileByType(mapVMProfiles, k).Pricing.Price
+		reserved, ok := reservedInstances[k]
+		if ok && !types.IsSpotVMType(k) {
+			numberReserved := int(math.Min(float64(v), float64(reserved.Number)))
+			cost += reserved.HourlyRate() * float64(numberReserved) + price * float64(v - numberReserved)
+		} else {
+			cost += price * float64(v)
+		}
+	}
+	return cost
+}
+
+/* Marginal cost per hour of a VM set, used to compare VM sets. The reserved instances are paid whether they are
+	used or not, so the VMs of each type up to its reserved number cost nothing and the rest are charged
+	at the on-demand or spot price
+	in:
+		@vmSet types.VMScale
+		@mapVMProfiles map[string]types.VmProfile
+		@pricingModel util.PricingModel
+	out:
+		@float64
+*/
+func vmSetCost(vmSet types.VMScale, mapVMProfiles map[string] types.VmProfile, pricingModel util.PricingModel) float64 {
+	reservedInstances := reservedInstancesByType(pricingModel)
+	cost := 0.0
+	for k,v := range vmSet {
+		price := types.VMProfileByType(mapVMProfiles, k).Pricing.Price
+		if reserved, ok := reservedInstances[k]; ok && !types.IsSpotVMType(k) {
+			cost += price * math.Max(0, float64(v - reserved.Number))
+		} else {
+			cost += price * float64(v)
+		}
+	}
+	return cost
+}
+
+//Cost committed for all the reserved instances during a time window, whether they are used or not
+func committedSpend(pricingModel util.PricingModel, timeStart time.Time, timeEnd time.Time) float64 {
+	hours := timeEnd.Sub(timeStart).Hours()
+	spend := 0.0
+	for _,r := range pricingModel.ReservedInstances {
+		spend += r.HourlyRate() * float64(r.Number) * hours
+	}
+	return spend
+}
+
+//Cost of the reserved VMs used by a policy during a time window
+func reservedCost(policy types.Policy, pricingModel util.PricingModel, timeStart time.Time, timeEnd time.Time) float64 {
+	reservedInstances := reservedInstancesByType(pricingModel)
+	cost := 0.0
+	for _,cf := range policy.ScalingActions {
+		hours := overlapHours(cf.TimeStart, cf.TimeEnd, timeStart, timeEnd)
+		for k,v := range cf.DesiredState.VMs {
+			if reserved,ok := reservedInstances[k]; ok && !types.IsSpotVMType(k) {
+				cost += reserved.HourlyRate() * math.Min(float64(v), float64(reserved.Number)) * hours
+			}
+		}
+	}
+	return cost
+}
+
+/* Calculate the hours billed for a VM running during a time window
+	in:
+		@timeStart time.Time
+		@timeEnd time.Time
+		@pricingModel util.PricingModel - billing unit and minimum time billed per second
+	out:
+		@float64 - billed hours
+*/
+func BilledTime(timeStart time.Time, timeEnd time.Time, pricingModel util.PricingModel) float64 {
+	delta := timeEnd.Sub(timeStart)
+	switch pricingModel.BillingUnit {
 	case util.SECOND :
-		if delta < (0.01666666666) {return 0.01666666666} else {return delta}		//It charges at least 60 seconds
+		//It charges each second, with a minimum
+		minimumSeconds := float64(pricingModel.MinimumBilledSeconds)
+		if minimumSeconds <= 0 {
+			minimumSeconds = util.DEFAULT_MINIMUM_BILLED_SECONDS
+		}
+		return math.Max(math.Ceil(delta.Seconds()), minimumSeconds) / 3600
+	case util.MINUTE:
+		//It charges each started minute, at least 1 minute
+		return math.Max(math.Ceil(delta.Minutes()), 1) / 60
 	case util.HOUR:
-		return math.Ceil(delta)									//It charges at least 1 hour
+		return math.Max(math.Ceil(delta.Hours()), 1)									//It charges at least 1 hour
+	case util.MONTH:
+		//It charges each started month
+		return math.Ceil(delta.Hours() / util.HOURS_PER_MONTH) * util.HOURS_PER_MONTH
 	}
-	return delta
+	return delta.Hours()
 }
 
 
 
-func isEnoughBudget(monthlyBudget float64, policy types.Policy) (bool,time.Time) {
-	avgHoursPerMonth := 720.0
-	timeWindow := policy.TimeWindowEnd.Sub(policy.TimeWindowStart).Hours()
-	numberMonths := math.Ceil(timeWindow/avgHoursPerMonth)
-	var timeBudgetLimit time.Time
-	if policy.Metrics.Cost <= monthlyBudget * numberMonths {
-		return true, policy.TimeWindowEnd
-	} else {
-		spentBudget := 0.0
-		for _,c := range policy.ScalingActions {
-			spentBudget+= c.Metrics.Cost
-			if (spentBudget >= monthlyBudget) {
-				timeBudgetLimit = c.TimeStart
+/* Check if the monthly budget covers the cost of a policy plus the spend committed for the reserved instances it does not use
+	and the spend already expected for each month by the policies of earlier windows. The VMs are billed in each month
+	in which they run
+	in:
+		@pricingModel util.PricingModel
+		@policy types.Policy
+		@spentBudget map[string]float64 - spend recorded in the budget ledger for each month
+		@mapVMProfiles map[string]types.VmProfile
+	out:
+		@bool - the budget is enough
+		@time.Time - time until the budget is enough
+*/
+func isEnoughBudget(pricingModel util.PricingModel, policy types.Policy, spentBudget map[string]float64,
+	mapVMProfiles map[string]types.VmProfile) (bool,time.Time) {
+	monthlyBudget := pricingModel.Budget
+	monthlySpend := make(map[string]float64)
+	for k,v := range spentBudget {
+		monthlySpend[k] = v
+	}
+	//The committed spend is charged in the month it is committed
+	periods := monthPeriods(policy.TimeWindowStart, policy.TimeWindowEnd)
+	for _,period := range periods {
+		monthlySpend[period.month] += math.Max(0, committedSpend(pricingModel, period.timeStart, period.timeEnd) -
+			reservedCost(policy, pricingModel, period.timeStart, period.timeEnd))
+	}
+	monthlyCosts := vmsMonthlyBilledCost(policy.ScalingActions, pricingModel, mapVMProfiles)
+	for i,c := range policy.ScalingActions {
+		for month,cost := range monthlyCosts[i] {
+			monthlySpend[month] += cost
+		}
+		for _,period := range monthPeriods(c.TimeStart, c.TimeEnd) {
+			if monthlySpend[period.month] > monthlyBudget {
+				return false, period.timeStart
 			}
 		}
 	}
-
-	return false, timeBudgetLimit
+	for _,period := range periods {
+		if monthlySpend[period.month] > monthlyBudget {
+			return false, period.timeStart
+		}
+	}
+	return true, policy.TimeWindowEnd
 }
@@ -0,0 +1,193 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"testing"
+	"time"
+)
+
+func reservationProfiles() map[string]types.VmProfile {
+	return map[string]types.VmProfile{
+		"a": {Type:"a", CPUCores:2, Memory:4, Pricing:types.Pricing{Price:1}},
+		"b": {Type:"b", CPUCores:4, Memory:8, Pricing:types.Pricing{Price:2.5}},
+	}
+}
+
+func TestVMSetHourlyCostWithReservedInstances(t *testing.T) {
+	mapVMProfiles := reservationProfiles()
+	pricingModel := util.PricingModel{ReservedInstances:[]util.ReservedInstance{
+		{VMType:"a", Number:2, Price:0.4},
+	}}
+	cost := vmSetHourlyCost(types.VMScale{"a":3, "b":1}, mapVMProfiles, reservedInstancesByType(pricingModel))
+	if cost != 0.4*2 + 1 + 2.5 {
+		t.Error("Expected cost: ", 0.4*2 + 1 + 2.5, "got: ", cost)
+	}
+
+	upfront := util.ReservedInstance{VMType:"a", Number:1, Price:0.4, UpfrontPrice:864, TermMonths:12}
+	if rate := upfront.HourlyRate(); rate != 0.5 {
+		t.Error("Expected hourly rate: ", 0.5, "got: ", rate)
+	}
+}
+
+func TestHomogeneousVMSetFillsReservedInstances(t *testing.T) {
+	mapVMProfiles := reservationProfiles()
+	limits := types.Limit{CPUCores:1, MemoryGB:1}
+
+	vmSet,_ := buildHomogeneousVMSet(3, limits, mapVMProfiles, util.PricingModel{})
+	if !vmSet.Equal(types.VMScale{"b":1}) {
+		t.Error("Without reservations expected: ", types.VMScale{"b":1}, "got: ", vmSet)
+	}
+	//The reserved VMs are paid anyway, even at a committed rate above the on-demand price
+	pricingModel := util.PricingModel{ReservedInstances:[]util.ReservedInstance{
+		{VMType:"a", Number:3, Price:1.2},
+	}}
+	if cost := vmSetCost(types.VMScale{"a":4, "b":1}, mapVMProfiles, pricingModel); cost != 1 + 2.5 {
+		t.Error("Expected the marginal cost: ", 1 + 2.5, "got: ", cost)
+	}
+	vmSet,_ = buildHomogeneousVMSet(3, limits, mapVMProfiles, pricingModel)
+	if !vmSet.Equal(types.VMScale{"a":3}) {
+		t.Error("With reservations expected: ", types.VMScale{"a":3}, "got: ", vmSet)
+	}
+	vmSet,_ = buildHeterogeneousVMSet(4, limits, mapVMProfiles, pricingModel)
+	if !vmSet.Equal(types.VMScale{"a":4}) {
+		t.Error("With reservations expected: ", types.VMScale{"a":4}, "got: ", vmSet)
+	}
+}
+
+func TestIsEnoughBudgetWithCommittedSpend(t *testing.T) {
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	mapVMProfiles := reservationProfiles()
+	//The VM b costs 10 and the idle reserved instances commit 8
+	policy := types.Policy{
+		TimeWindowStart:start,
+		TimeWindowEnd:end,
+		ScalingActions:[]types.ScalingAction{{
+			TimeStart:start, TimeEnd:end,
+			DesiredState:types.State{VMs:types.VMScale{"b":1}},
+		}},
+	}
+	pricingModel := util.PricingModel{Budget:17, BillingUnit:util.HOUR, ReservedInstances:[]util.ReservedInstance{
+		{VMType:"a", Number:2, Price:1},
+	}}
+	if enough,_ := isEnoughBudget(pricingModel, policy, nil, mapVMProfiles); enough {
+		t.Error("Expected the idle reserved instances to exceed the budget: ", pricingModel.Budget)
+	}
+	pricingModel.Budget = 20
+	if enough,_ := isEnoughBudget(pricingModel, policy, nil, mapVMProfiles); !enough {
+		t.Error("Expected the budget: ", pricingModel.Budget, " to cover the policy and the committed spend")
+	}
+	spentBudget := map[string]float64{"2018-11":5}
+	if enough,_ := isEnoughBudget(pricingModel, policy, spentBudget, mapVMProfiles); enough {
+		t.Error("Expected the spend of earlier windows: ", spentBudget, " to exceed the budget: ", pricingModel.Budget)
+	}
+	spentBudget = map[string]float64{"2018-10":5}
+	if enough,_ := isEnoughBudget(pricingModel, policy, spentBudget, mapVMProfiles); !enough {
+		t.Error("Expected the budget: ", pricingModel.Budget, " to cover the policy and the committed spend")
+	}
+}
+
+func TestBilledTime(t *testing.T) {
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	expected := []struct {
+		unit     string
+		duration time.Duration
+		hours    float64
+	}{
+		{util.SECOND, 30 * time.Second, 60.0 / 3600},
+		{util.SECOND, 90 * time.Second, 90.0 / 3600},
+		{util.MINUTE, 30 * time.Second, 1.0 / 60},
+		{util.MINUTE, 90 * time.Second, 2.0 / 60},
+		{util.HOUR, 90 * time.Minute, 2},
+		{util.HOUR, 0, 1},
+		{util.MONTH, 10 * time.Hour, util.HOURS_PER_MONTH},
+	}
+	for _,e := range expected {
+		hours := BilledTime(start, start.Add(e.duration), util.PricingModel{BillingUnit:e.unit})
+		if hours != e.hours {
+			t.Error("For unit: ", e.unit, "and duration: ", e.duration, "expected: ", e.hours, "got: ", hours)
+		}
+	}
+	pricingModel := util.PricingModel{BillingUnit:util.SECOND, MinimumBilledSeconds:120}
+	if hours := BilledTime(start, start.Add(90 * time.Second), pricingModel); hours != 120.0 / 3600 {
+		t.Error("With minimum of 120 seconds expected: ", 120.0 / 3600, "got: ", hours)
+	}
+}
+
+func TestVMsBilledFromLaunchToRelease(t *testing.T) {
+	mapVMProfiles := reservationProfiles()
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	//A VM kept during two actions of 30 minutes is billed one hour, the second VM only during the second action
+	scalingActions := []types.ScalingAction{
+		{TimeStart:start, TimeEnd:start.Add(30 * time.Minute), DesiredState:types.State{VMs:types.VMScale{"a":1}}},
+		{TimeStart:start.Add(30 * time.Minute), TimeEnd:start.Add(60 * time.Minute), DesiredState:types.State{VMs:types.VMScale{"a":2}}},
+	}
+	costs := vmsBilledCost(scalingActions, util.PricingModel{BillingUnit:util.HOUR}, mapVMProfiles)
+	if costs[0] != 0.5 || costs[1] != 1.5 {
+		t.Error("Expected costs: ", []float64{0.5, 1.5}, "got: ", costs)
+	}
+
+	scalingActions = []types.ScalingAction{
+		{TimeStart:start, TimeEnd:start.Add(30 * 24 * time.Hour), DesiredState:types.State{VMs:types.VMScale{"a":1}}},
+	}
+	pricingModel := util.PricingModel{BillingUnit:util.HOUR, MonthlyCapHours:500}
+	if costs = vmsBilledCost(scalingActions, pricingModel, mapVMProfiles); costs[0] != 500 {
+		t.Error("With monthly cap of 500 hours expected cost: ", 500, "got: ", costs)
+	}
+
+	//A VM running from November 20 to December 20 is capped in each month, 264 hours in November and 456 in December
+	november := time.Date(2018, 11, 20, 0, 0, 0, 0, time.UTC)
+	december := time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)
+	scalingActions = []types.ScalingAction{
+		{TimeStart:november, TimeEnd:december, DesiredState:types.State{VMs:types.VMScale{"a":1}}},
+		{TimeStart:december, TimeEnd:december.Add(19 * 24 * time.Hour), DesiredState:types.State{VMs:types.VMScale{"a":1}}},
+	}
+	pricingModel.MonthlyCapHours = 300
+	if costs = vmsBilledCost(scalingActions, pricingModel, mapVMProfiles); math.Abs(costs[0] - 264) > 1e-9 || math.Abs(costs[1] - 300) > 1e-9 {
+		t.Error("With monthly cap of 300 hours expected costs: ", []float64{264, 300}, "got: ", costs)
+	}
+}
+
+func TestIsEnoughBudgetAcrossMonths(t *testing.T) {
+	start := time.Date(2018, 11, 30, 12, 0, 0, 0, time.UTC)
+	december := time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)
+	end := december.Add(12 * time.Hour)
+	policy := types.Policy{
+		TimeWindowStart:start,
+		TimeWindowEnd:end,
+		ScalingActions:[]types.ScalingAction{{TimeStart:start, TimeEnd:end, DesiredState:types.State{VMs:types.VMScale{"b":1}}}},
+	}
+	//The VM b costs 30 and the idle reserved instances commit 24 in each month
+	pricingModel := util.PricingModel{Budget:60, BillingUnit:util.HOUR, ReservedInstances:[]util.ReservedInstance{
+		{VMType:"a", Number:2, Price:1},
+	}}
+	mapVMProfiles := reservationProfiles()
+	enough, limitTime := isEnoughBudget(pricingModel, policy, map[string]float64{"2018-12":10}, mapVMProfiles)
+	if enough || !limitTime.Equal(december) {
+		t.Error("Expected the budget exceeded in December, got: ", enough, limitTime)
+	}
+	if enough,_ = isEnoughBudget(pricingModel, policy, nil, mapVMProfiles); !enough {
+		t.Error("Expected the cost and the committed spend split between November and December within the budget: ", pricingModel.Budget)
+	}
+}
+
+func TestExceedsBudgetAcrossMonths(t *testing.T) {
+	start := time.Date(2018, 11, 30, 12, 0, 0, 0, time.UTC)
+	scalingActions := []types.ScalingAction{
+		{TimeStart:start, TimeEnd:start.Add(24 * time.Hour), DesiredState:types.State{VMs:types.VMScale{"a":1}}},
+	}
+	pricingModel := util.PricingModel{BillingUnit:util.HOUR}
+	monthlyCosts := vmsMonthlyBilledCost(scalingActions, pricingModel, reservationProfiles())
+	if monthlyCosts[0]["2018-11"] != 12 || monthlyCosts[0]["2018-12"] != 12 {
+		t.Error("Expected the cost split between November and December, got: ", monthlyCosts)
+	}
+	//The VM costs 12 in each month
+	if exceedsBudget(scalingActions, 15, nil, nil, reservationProfiles(), pricingModel) {
+		t.Error("Expected the cost split between November and December within the budget")
+	}
+	if !exceedsBudget(scalingActions, 15, map[string]float64{"2018-12":4}, nil, reservationProfiles(), pricingModel) {
+		t.Error("Expected the budget of December exceeded")
+	}
+}
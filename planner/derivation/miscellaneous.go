@@ -10,23 +10,6 @@ type MSCProfile struct {
 	MSC            float64
 }
 
-/*
-	Node that represents a candidate option to scale
-*/
-type Node struct {
-	NReplicas	int
-	vmType	string
-	children []*Node
-	vmScale types.VMScale
-}
-
-/*
-	Tree structure used to create different combinations of VM types
- */
-type Tree struct {
-	Root *Node
-}
-
 /* Compute the maximum capacity regarding the number of replicas hosted in each VM type
 	in:
 		@limits
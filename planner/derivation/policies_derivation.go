@@ -13,7 +13,6 @@ import (
 	"errors"
 	"github.com/cnf/structhash"
 	"strings"
-	"fmt"
 	"github.com/Cloud-Pie/SPDT/planner/forecast_processing"
 )
 
@@ -38,18 +37,36 @@ type PolicyDerivation interface {
 		@[]types.Policy
 */
 func Policies(sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemConfiguration, forecast types.Forecast) ([]types.Policy, error) {
-	var policies []types.Policy
-	systemConfiguration = sysConfiguration
-	mapVMProfiles := VMListToMap(sortedVMProfiles)
-
 	log.Info("Request current state" )
-	currentState,err := execution.RetrieveCurrentState(sysConfiguration.SchedulerComponent.Endpoint + util.ENDPOINT_CURRENT_STATE)
+	currentState,err := execution.CurrentState(sysConfiguration)
 
 	if err != nil {
 		log.Error("Error to get current state %s", err.Error() )
 	} else {
 		log.Info("Finish request for current state" )
 	}
+	policies, err2 := PoliciesFromState(currentState, sortedVMProfiles, sysConfiguration, forecast)
+	if err2 != nil {
+		return policies, err2
+	}
+	return policies, err
+}
+
+/* Derive scaling policies starting from a given current state
+	in:
+		@currentState types.State
+		@sortedVMProfiles []VmProfile
+		@sysConfiguration SystemConfiguration
+		@forecast types.Forecast
+	out:
+		@[]types.Policy
+*/
+func PoliciesFromState(currentState types.State, sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemConfiguration, forecast types.Forecast) ([]types.Policy, error) {
+	var policies []types.Policy
+	sysConfiguration.PolicySettings.ScalingMethod = scalingMethod(sysConfiguration.PolicySettings.ScalingMethod)
+	systemConfiguration = sysConfiguration
+	mapVMProfiles := VMListToMap(sortedVMProfiles)
+
 	if currentState.Services[systemConfiguration.MainServiceName].Scale == 0 {
 		return policies, errors.New("Service "+ systemConfiguration.MainServiceName +" is not deployed")
 	}
@@ -57,8 +74,11 @@ func Policies(sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemCo
 		return policies, errors.New("Information not available for VM Type "+vmType )
 	}
 
-	granularity := systemConfiguration.ForecastComponent.Granularity
-	processedForecast := forecast_processing.ScalingIntervals(forecast, granularity)
+	quantile := forecast_processing.SizingQuantile(sysConfiguration.PolicySettings.SizingQuantile)
+	processedForecast := forecast_processing.ScalingIntervals(forecast, quantile, systemConfiguration.ForecastComponent)
+	//The algorithms derive on-demand VM sets, spot VMs are mixed in afterwards
+	deployedState := currentState
+	currentState.VMs = currentState.VMs.OnDemandVMSet()
 	initialState = currentState
 
 
@@ -115,7 +135,20 @@ func Policies(sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemCo
 		policies6 := tree.CreatePolicies(processedForecast)
 		policies = append(policies, policies6...)
 	}
-	return policies, err
+	spentBudget := make(map[string]float64)
+	if sysConfiguration.PricingModel.Budget > 0 {
+		spentBudget = ledgerSpend(sysConfiguration.MainServiceName)
+	}
+	for i := range policies {
+		policies[i].Parameters[types.SIZINGQUANTILE] = quantile
+		if sysConfiguration.PolicySettings.SpotInstancesAllowed {
+			mixSpotInstances(&policies[i], deployedState, mapVMProfiles, sysConfiguration.PolicySettings)
+		} else if len(policies[i].ScalingActions) > 0 {
+			policies[i].ScalingActions[0].InitialState = deployedState
+		}
+		capPolicyToBudget(&policies[i], deployedState, mapVMProfiles, sysConfiguration, spentBudget)
+	}
+	return policies, nil
 }
 
 /* Compute the booting time that will take a set of VMS
@@ -128,12 +161,15 @@ func Policies(sortedVMProfiles []types.VmProfile, sysConfiguration util.SystemCo
 func computeVMBootingTime(vmsScale types.VMScale, sysConfiguration util.SystemConfiguration) float64 {
 	bootTime := 0.0
 	//Check in db if already data is stored
-	vmBootingProfileDAO := storage.GetVMBootingProfileDAO()
+	vmBootingProfileDAO := bootingProfileDAO(sysConfiguration)
 
-	//Call API
-	for vmType, n := range vmsScale {
+	//Call API, spot VMs boot and shutdown as VMs of their type
+	for vmType, n := range vmsScale.OnDemandVMSet() {
 		times, err := vmBootingProfileDAO.BootingShutdownTime(vmType, n)
-		if err != nil {
+		if err != nil && sysConfiguration.PerformanceProfilesComponent.Endpoint == "" {
+			times.BootTime = util.DEFAULT_VM_BOOT_TIME
+			times.ShutDownTime = util.DEFAULT_VM_SHUTDOWN_TIME
+		} else if err != nil {
 			url := sysConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_VM_TIMES
 			csp := sysConfiguration.CSP
 			region := sysConfiguration.Region
@@ -164,12 +200,15 @@ func computeVMBootingTime(vmsScale types.VMScale, sysConfiguration util.SystemCo
 func computeVMTerminationTime(vmsScale types.VMScale, sysConfiguration util.SystemConfiguration) float64 {
 	terminationTime := 0.0
 	//Check in db if already data is stored
-	vmBootingProfileDAO := storage.GetVMBootingProfileDAO()
+	vmBootingProfileDAO := bootingProfileDAO(sysConfiguration)
 
-	//Call API
-	for vmType, n := range vmsScale {
+	//Call API, spot VMs boot and shutdown as VMs of their type
+	for vmType, n := range vmsScale.OnDemandVMSet() {
 		times, err := vmBootingProfileDAO.BootingShutdownTime(vmType, n)
-		if err != nil {
+		if err != nil && sysConfiguration.PerformanceProfilesComponent.Endpoint == "" {
+			times.BootTime = util.DEFAULT_VM_BOOT_TIME
+			times.ShutDownTime = util.DEFAULT_VM_SHUTDOWN_TIME
+		} else if err != nil {
 			url := sysConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_VM_TIMES
 			csp := sysConfiguration.CSP
 			region := sysConfiguration.Region
@@ -219,7 +258,10 @@ func estimatePodsConfiguration(requests float64, limits types.Limit) (types.Cont
 	var err error
 	serviceProfileDAO := storage.GetPerformanceProfileDAO(systemConfiguration.MainServiceName)
 
-	performanceProfileBase,_ := serviceProfileDAO.FindByLimitsAndReplicas(limits.CPUCores, limits.MemoryGB, 1)
+	performanceProfileBase,err := serviceProfileDAO.FindByLimitsAndReplicas(limits.CPUCores, limits.MemoryGB, 1)
+	if err != nil {
+		return containerConfig, err
+	}
 	estimatedReplicas := int(math.Ceil(requests / performanceProfileBase.MSCSettings[0].MSCPerSecond))
 	performanceProfileCandidate,err1 := serviceProfileDAO.FindByLimitsAndReplicas(limits.CPUCores, limits.MemoryGB, estimatedReplicas)
 
@@ -227,6 +269,10 @@ func estimatePodsConfiguration(requests float64, limits types.Limit) (types.Cont
 		containerConfig.MSCSetting.Replicas = performanceProfileCandidate.MSCSettings[0].Replicas
 		containerConfig.MSCSetting.MSCPerSecond = performanceProfileCandidate.MSCSettings[0].MSCPerSecond
 		containerConfig.Limits = limits
+	} else if systemConfiguration.PerformanceProfilesComponent.Endpoint == "" {
+		//Offline: extrapolate the capacity of one replica
+		containerConfig.MSCSetting = extrapolateMSCSetting(performanceProfileBase.MSCSettings[0], estimatedReplicas)
+		containerConfig.Limits = limits
 	} else {
 		url := systemConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_SERVICE_PROFILE_BY_MSC
 		appName := systemConfiguration.AppName
@@ -308,17 +354,35 @@ func selectProfileUnderVMLimits(requests float64,  limits types.Limit) (types.Co
 		@float64	- Max number of request for this containers configuration
 */
 func getStateLoadCapacity(numberReplicas int, limits types.Limit) types.MSCSimpleSetting {
-	serviceProfileDAO := storage.GetPerformanceProfileDAO(systemConfiguration.MainServiceName)
+	return serviceLoadCapacity(systemConfiguration, systemConfiguration.MainServiceName, numberReplicas, limits)
+}
+
+/* Capacity of a number of replicas of any service of the application
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@serviceName string
+		@numberReplicas	int - number of replicas
+		@limits types.Limits - limits constraints(cpu cores and memory gb) per replica
+	out:
+		@MSCSimpleSetting
+*/
+func serviceLoadCapacity(sysConfiguration util.SystemConfiguration, serviceName string, numberReplicas int, limits types.Limit) types.MSCSimpleSetting {
+	serviceProfileDAO := storage.GetPerformanceProfileDAO(serviceName)
 	profile,_ := serviceProfileDAO.FindByLimitsAndReplicas(limits.CPUCores, limits.MemoryGB, numberReplicas)
 	newMSCSetting := types.MSCSimpleSetting{}
 	if len(profile.MSCSettings) > 0 {
 		return profile.MSCSettings[0]
+	} else if sysConfiguration.PerformanceProfilesComponent.Endpoint == "" {
+		//Offline: extrapolate the capacity of one replica
+		profileBase,err := serviceProfileDAO.FindByLimitsAndReplicas(limits.CPUCores, limits.MemoryGB, 1)
+		if err == nil {
+			newMSCSetting = extrapolateMSCSetting(profileBase.MSCSettings[0], numberReplicas)
+		}
 	}else {
-		url := systemConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_SERVICE_PROFILE_BY_REPLICAS
-		appName := systemConfiguration.AppName
-		appType := systemConfiguration.AppType
-		mainServiceName := systemConfiguration.MainServiceName
-		mscCompleteSetting,_ := performance_profiles.GetPredictedMSCByReplicas(url,appName,appType,mainServiceName,numberReplicas,limits.CPUCores, limits.MemoryGB)
+		url := sysConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_SERVICE_PROFILE_BY_REPLICAS
+		appName := sysConfiguration.AppName
+		appType := sysConfiguration.AppType
+		mscCompleteSetting,_ := performance_profiles.GetPredictedMSCByReplicas(url,appName,appType,serviceName,numberReplicas,limits.CPUCores, limits.MemoryGB)
 		newMSCSetting = types.MSCSimpleSetting{
 			MSCPerSecond:mscCompleteSetting.MSCPerSecond.RegBruteForce,
 			BootTimeSec:mscCompleteSetting.BootTimeMs,
@@ -344,10 +408,78 @@ func getStateLoadCapacity(numberReplicas int, limits types.Limit) types.MSCSimpl
 	return newMSCSetting
 }
 
+/* Number of requests that a configuration should serve. If under provisioning is allowed,
+	only (1 - max percentage) of the forecasted requests need to be covered
+	in:
+		@requests	float64 - forecasted requests
+		@policySettings util.PolicySettings
+	out:
+		@float64	- requests to serve
+*/
+func loadToServe(requests float64, policySettings util.PolicySettings) float64 {
+	maxUnderprovision := policySettings.MaxUnderprovision
+	if policySettings.UnderprovisioningAllowed && maxUnderprovision > 0 && maxUnderprovision < 100 {
+		return requests * (1 - maxUnderprovision/100.0)
+	}
+	return requests
+}
+
+/* Estimate the capacity of a number of replicas when the performance profiles component is not available.
+	The capacity of one replica is extrapolated linearly
+	in:
+		@baseSetting types.MSCSimpleSetting - MSC setting of one replica
+		@numberReplicas	int - number of replicas
+	out:
+		@MSCSimpleSetting	- Estimated setting for the number of replicas
+*/
+func extrapolateMSCSetting(baseSetting types.MSCSimpleSetting, numberReplicas int) types.MSCSimpleSetting {
+	bootTime := baseSetting.BootTimeSec
+	if bootTime == 0 {
+		bootTime = util.DEFAULT_POD_BOOT_TIME
+	}
+	return types.MSCSimpleSetting{
+		Replicas:numberReplicas,
+		MSCPerSecond:baseSetting.MSCPerSecond * float64(numberReplicas),
+		BootTimeSec:bootTime,
+		StandDevBootTimeSec:baseSetting.StandDevBootTimeSec,
+	}
+}
+
 /* Utility method to set up each scaling configuration
+	in:
+		@scalingSteps *[]types.ScalingAction
+		@currentState types.State
+		@newState types.State
+		@timeStart time.Time
+		@timeEnd time.Time
+		@totalServicesBootingTime float64
+		@stateLoadCapacity float64
+		@policySettings util.PolicySettings - minimum hold and gap between scaling actions
 */
-func setScalingSteps(scalingSteps *[]types.ScalingAction, currentState types.State,newState types.State, timeStart time.Time, timeEnd time.Time, totalServicesBootingTime float64, stateLoadCapacity float64) {
+func setScalingSteps(scalingSteps *[]types.ScalingAction, currentState types.State,newState types.State, timeStart time.Time, timeEnd time.Time,
+	totalServicesBootingTime float64, stateLoadCapacity float64, policySettings util.PolicySettings) {
 	nScalingSteps := len(*scalingSteps)
+	for {
+		if nScalingSteps >= 1 && !currentState.Equal((*scalingSteps)[nScalingSteps-1].DesiredState) {
+			//A previous state was skipped, the scaling starts from the state kept
+			currentState = (*scalingSteps)[nScalingSteps-1].DesiredState
+		}
+		if nScalingSteps == 0 || newState.Equal((*scalingSteps)[nScalingSteps-1].DesiredState) ||
+			!violatesScalingConstraints(*scalingSteps, currentState, newState, timeStart, policySettings) {
+			break
+		}
+		previousStep := (*scalingSteps)[nScalingSteps-1]
+		if stateLoadCapacity < previousStep.Metrics.RequestsCapacity {
+			//Scale in is skipped, the previous state is kept until the end of the interval
+			(*scalingSteps)[nScalingSteps-1].TimeEnd = timeEnd
+			return
+		}
+		//Scale out is not delayed, it replaces the previous scaling action
+		*scalingSteps = (*scalingSteps)[:nScalingSteps-1]
+		nScalingSteps--
+		currentState = previousStep.InitialState
+		timeStart = previousStep.TimeStart
+	}
 	if nScalingSteps >= 1 && newState.Equal((*scalingSteps)[nScalingSteps-1].DesiredState) {
 		(*scalingSteps)[nScalingSteps-1].TimeEnd = timeEnd
 	} else {
@@ -393,86 +525,271 @@ func setScalingSteps(scalingSteps *[]types.ScalingAction, currentState types.Sta
 	}
 }
 
-/* Build Heterogeneous cluster to deploy a number of replicas, each one with the defined constraint limits
+/* Check if a new scaling action starts before the minimum hold of the previous one
+	or before the minimum gap since the last scaling action that changed the VMs
+	in:
+		@scalingSteps []types.ScalingAction - scaling actions derived so far
+		@currentState types.State
+		@newState types.State
+		@timeStart time.Time - start of the new scaling action
+		@policySettings util.PolicySettings
+	out:
+		@bool - true if the new scaling action violates a constraint
+*/
+func violatesScalingConstraints(scalingSteps []types.ScalingAction, currentState types.State, newState types.State,
+	timeStart time.Time, policySettings util.PolicySettings) bool {
+	previousStep := scalingSteps[len(scalingSteps)-1]
+	if timeStart.Sub(previousStep.TimeStart).Seconds() < policySettings.MinimumHold {
+		return true
+	}
+	if vmAdded, vmRemoved := DeltaVMSet(currentState.VMs, newState.VMs); len(vmAdded) == 0 && len(vmRemoved) == 0 {
+		return false
+	}
+	for i := len(scalingSteps) - 1; i >= 0; i-- {
+		vmAdded, vmRemoved := DeltaVMSet(scalingSteps[i].InitialState.VMs, scalingSteps[i].DesiredState.VMs)
+		if len(vmAdded) > 0 || len(vmRemoved) > 0 {
+			return timeStart.Sub(scalingSteps[i].TimeStart).Seconds() < policySettings.MinimumVMScalingGap
+		}
+	}
+	return false
+}
+
+/* Build the heterogeneous VM set with minimal cost to deploy a number of replicas, each one with the defined constraint limits.
+	The VM types are combined with branch and bound, using the cheapest homogeneous set as initial bound.
+	The search is bounded by MAX_VM_SET_SEARCH_TIME, then the best set found so far is used
 	in:
 		@numberReplicas	int - number of replicas
 		@limits bool types.Limits - limits constraints(cpu cores and memory gb) per replica
 		@mapVMProfiles - map with the profiles of VMs available
+		@pricingModel util.PricingModel
 	out:
 		@VMScale	- Map with the type of VM as key and the number of vms as value
 */
-func buildHeterogeneousVMSet(numberReplicas int, limits types.Limit, mapVMProfiles map[string]types.VmProfile) (types.VMScale,error) {
-	var err error
-	tree := &Tree{}
-	node := new(Node)
-	node.NReplicas = numberReplicas
-	node.vmScale = make(map[string]int)
-	tree.Root = node
-	candidateVMSets := []types.VMScale {}
-	computeVMsCapacity(limits, &mapVMProfiles)
-
-	buildTree(tree.Root, numberReplicas,&candidateVMSets,mapVMProfiles)
-	fmt.Println("lenght tree")
-	fmt.Println(len(candidateVMSets))
-	if len(candidateVMSets)> 0{
-		sort.Slice(candidateVMSets, func(i, j int) bool {
-			costi := candidateVMSets[i].Cost(mapVMProfiles)
-			costj := candidateVMSets[j].Cost(mapVMProfiles)
-			if costi < costj {
-				return true
-			} else if costi ==  costj {
-				return candidateVMSets[i].TotalVMs() >= candidateVMSets[j].TotalVMs()
+func buildHeterogeneousVMSet(numberReplicas int, limits types.Limit, mapVMProfiles map[string]types.VmProfile,
+	pricingModel util.PricingModel) (types.VMScale,error) {
+	homogeneousVMSet,err := buildHomogeneousVMSet(numberReplicas, limits, mapVMProfiles, pricingModel)
+	if err != nil || numberReplicas <= 0 {
+		return homogeneousVMSet,err
+	}
+
+	candidates := []vmCandidate{}
+	reservedInstances := reservedInstancesByType(pricingModel)
+	for _,v := range mapVMProfiles {
+		capacity := maxPodsCapacityInVM(v, limits)
+		if capacity > 0 {
+			candidates = append(candidates, vmCandidate{vmType:v.Type, capacity:capacity, price:v.Pricing.Price})
+			//The reserved VMs of the type are already paid, they are a candidate without cost limited to their number
+			if reserved,ok := reservedInstances[v.Type]; ok && reserved.Number > 0 {
+				candidates = append(candidates, vmCandidate{vmType:v.Type, capacity:capacity, price:0, maxVMs:reserved.Number})
 			}
-			return false
-		})
-		return candidateVMSets[0],err
-	}else {
-		return types.VMScale{},errors.New("No VM Candidate")
+		}
+	}
+	//Cheapest price per replica first, so the first remaining type bounds the cost of the remaining replicas
+	sort.Slice(candidates, func(i, j int) bool {
+		pricei := candidates[i].price / float64(candidates[i].capacity)
+		pricej := candidates[j].price / float64(candidates[j].capacity)
+		if pricei == pricej {
+			return candidates[i].capacity > candidates[j].capacity
+		}
+		return pricei < pricej
+	})
+
+	search := vmSetSearch{
+		candidates:candidates,
+		numberReplicas:numberReplicas,
+		deadline:time.Now().Add(util.MAX_VM_SET_SEARCH_TIME * time.Millisecond),
+		counts:make([]int, len(candidates)),
+		bestVMSet:homogeneousVMSet,
+		bestCost:vmSetCost(homogeneousVMSet, mapVMProfiles, pricingModel),
+		bestNumberVMs:homogeneousVMSet.TotalVMs(),
+	}
+	search.branch(0, 0, 0.0, 0)
+	if search.timeout {
+		log.Warning("Search of the cheapest VM set for %d replicas stopped after %d ms", numberReplicas, util.MAX_VM_SET_SEARCH_TIME)
 	}
+	return search.bestVMSet,nil
 }
 
-/*
-	Form scaling options using clusters of heterogeneous VMs
-	Builds a tree to form the different combinations
+//VM type that can host at least one replica
+type vmCandidate struct {
+	vmType   string
+	capacity int
+	price    float64
+	maxVMs   int	//Maximum number of VMs, 0 if it is not limited
+}
+
+//State of the branch and bound search of the cheapest VM set
+type vmSetSearch struct {
+	candidates     []vmCandidate
+	numberReplicas int
+	deadline       time.Time
+	counts         []int
+	nodes          int
+	timeout        bool
+	bestVMSet      types.VMScale
+	bestCost       float64
+	bestNumberVMs  int
+}
+
+/* Branch on the number of VMs of the candidate i, from the most to none
 	in:
-		@node			- Node of the tree
-		@numberReplicas	- Number of replicas that the VM set should host
-		@vmScaleList	- List filled with the candidates VM sets
+		@i int - index of the candidate VM type
+		@replicas int - replicas hosted by the VMs already selected
+		@cost float64 - cost of the VMs already selected
+		@numberVMs int - number of VMs already selected
 */
-func buildTree(node *Node, numberReplicas int, vmScaleList *[]types.VMScale, mapVMProfiles map[string]types.VmProfile) *Node {
-	if node.NReplicas == 0 {
-		return node
-	}
-	for k,v := range mapVMProfiles {
-		maxReplicas := v.ReplicasCapacity
-		if maxReplicas >= numberReplicas {
-			newNode := new(Node)
-			newNode.vmType = k
-			newNode.NReplicas = 0
-			newNode.vmScale = copyMap(node.vmScale)
-			if _, ok := newNode.vmScale[newNode.vmType]; ok {
-				newNode.vmScale[newNode.vmType] = newNode.vmScale[newNode.vmType]+1
-			} else {
-				newNode.vmScale[newNode.vmType] = 1
-			}
-			node.children = append(node.children, newNode)
-			*vmScaleList = append(*vmScaleList, newNode.vmScale)
-			//return node
-		} else if maxReplicas > 0 {
-			newNode := new(Node)
-			newNode.vmType = k
-			newNode.NReplicas = numberReplicas -maxReplicas
-			newNode.vmScale = copyMap(node.vmScale)
-			if _, ok := newNode.vmScale[newNode.vmType]; ok {
-				newNode.vmScale[newNode.vmType] = newNode.vmScale[newNode.vmType] + 1
-			} else {
-				newNode.vmScale[newNode.vmType] = 1
+func (s *vmSetSearch) branch(i int, replicas int, cost float64, numberVMs int) {
+	const epsilon = 1e-9
+	if s.timeout {
+		return
+	}
+	s.nodes++
+	if s.nodes % 1024 == 0 && time.Now().After(s.deadline) {
+		s.timeout = true
+		return
+	}
+	if replicas >= s.numberReplicas {
+		if cost < s.bestCost - epsilon || (cost <= s.bestCost + epsilon && numberVMs < s.bestNumberVMs) {
+			vmSet := make(types.VMScale)
+			for j,n := range s.counts[:i] {
+				if n > 0 {
+					vmSet[s.candidates[j].vmType] += n
+				}
 			}
-			newNode = buildTree(newNode, numberReplicas-maxReplicas, vmScaleList, mapVMProfiles)
-			node.children = append(node.children, newNode)
+			s.bestVMSet = vmSet
+			s.bestCost = cost
+			s.bestNumberVMs = numberVMs
 		}
+		return
+	}
+	if i == len(s.candidates) {
+		return
+	}
+	candidate := s.candidates[i]
+	remaining := s.numberReplicas - replicas
+	lowerBound := cost + float64(remaining) * candidate.price / float64(candidate.capacity)
+	if lowerBound > s.bestCost + epsilon {
+		return
+	}
+	maxVMs := int(math.Ceil(float64(remaining) / float64(candidate.capacity)))
+	if candidate.maxVMs > 0 && maxVMs > candidate.maxVMs {
+		maxVMs = candidate.maxVMs
+	}
+	for n := maxVMs; n >= 0; n-- {
+		s.counts[i] = n
+		s.branch(i+1, replicas + n*candidate.capacity, cost + float64(n)*candidate.price, numberVMs + n)
+	}
+	s.counts[i] = 0
+}
+
+//Scaling method configured for the VMs, horizontal if it is not supported
+func scalingMethod(method string) string {
+	switch method {
+	case util.SCALE_METHOD_HORIZONTAL, util.SCALE_METHOD_VERTICAL, util.SCALE_METHOD_HYBRID:
+		return method
+	case "":
+		return util.SCALE_METHOD_HORIZONTAL
+	default:
+		log.Warningf("Scaling method %s not supported, %s is used instead", method, util.SCALE_METHOD_HORIZONTAL)
+		return util.SCALE_METHOD_HORIZONTAL
 	}
-	return node
+}
+
+/* Adapt the VM set derived by an algorithm to the scaling method. Horizontal keeps the VM set,
+	vertical keeps the number of VMs of the current state and changes their type,
+	hybrid selects the cheapest of both
+	in:
+		@method string - scaling method
+		@vmSet types.VMScale - VM set derived changing the number of VMs
+		@numberReplicas	int - number of replicas
+		@limits types.Limits - limits constraints(cpu cores and memory gb) per replica
+		@currentVMSet types.VMScale - VM set of the current state
+		@mapVMProfiles - map with the profiles of VMs available
+		@pricingModel util.PricingModel
+	out:
+		@VMScale	- Map with the type of VM as key and the number of vms as value
+		@string	- Method applied, empty if the VM set is the current one
+*/
+func vmSetForScalingMethod(method string, vmSet types.VMScale, numberReplicas int, limits types.Limit,
+	currentVMSet types.VMScale, mapVMProfiles map[string]types.VmProfile, pricingModel util.PricingModel) (types.VMScale, string) {
+	if vmSet.Equal(currentVMSet) {
+		return vmSet, ""
+	}
+	if method == util.SCALE_METHOD_HORIZONTAL {
+		return vmSet, util.SCALE_METHOD_HORIZONTAL
+	}
+	verticalVMSet,err := buildVerticalVMSet(numberReplicas, limits, currentVMSet.TotalVMs(), mapVMProfiles, pricingModel)
+	if err != nil {
+		log.Warningf("No VM type can host %d replicas in %d VMs, the number of VMs is changed", numberReplicas, currentVMSet.TotalVMs())
+		return vmSet, util.SCALE_METHOD_HORIZONTAL
+	}
+	if method == util.SCALE_METHOD_HYBRID && len(vmSet) > 0 && vmSetCost(vmSet, mapVMProfiles, pricingModel) < vmSetCost(verticalVMSet, mapVMProfiles, pricingModel) {
+		return vmSet, util.SCALE_METHOD_HORIZONTAL
+	}
+	if verticalVMSet.Equal(currentVMSet) {
+		return verticalVMSet, ""
+	}
+	return verticalVMSet, util.SCALE_METHOD_VERTICAL
+}
+
+//Scaling methods applied to the VM sets of the scaling actions of a policy
+type scalingMethods map[string]bool
+
+func (m scalingMethods) add(method string) {
+	if method != "" {
+		m[method] = true
+	}
+}
+
+//Method recorded for the policy: hybrid if the VMs were changed both ways, the configured method if they were not changed
+func (m scalingMethods) method(configuredMethod string) string {
+	if m[util.SCALE_METHOD_HORIZONTAL] && m[util.SCALE_METHOD_VERTICAL] {
+		return util.SCALE_METHOD_HYBRID
+	}
+	if m[util.SCALE_METHOD_VERTICAL] {
+		return util.SCALE_METHOD_VERTICAL
+	}
+	if m[util.SCALE_METHOD_HORIZONTAL] {
+		return util.SCALE_METHOD_HORIZONTAL
+	}
+	return configuredMethod
+}
+
+/* Build a cluster with a fixed number of VMs of the cheapest type that can host the replicas
+	in:
+		@numberReplicas	int - number of replicas
+		@limits types.Limits - limits constraints(cpu cores and memory gb) per replica
+		@numberVMs int - number of VMs in the cluster
+		@mapVMProfiles - map with the profiles of VMs available
+		@pricingModel util.PricingModel
+	out:
+		@VMScale	- Map with the type of VM as key and the number of vms as value
+*/
+func buildVerticalVMSet(numberReplicas int, limits types.Limit, numberVMs int, mapVMProfiles map[string]types.VmProfile,
+	pricingModel util.PricingModel) (types.VMScale,error) {
+	if numberVMs < 1 {
+		numberVMs = 1
+	}
+	if limits.CPUCores <= 0 || limits.MemoryGB <= 0 {
+		return types.VMScale{},errors.New("No VM Candidate")
+	}
+	bestType := ""
+	bestPrice := math.Inf(1)
+	for vmType,profile := range mapVMProfiles {
+		capacity := maxPodsCapacityInVM(profile, limits)
+		if capacity * numberVMs < numberReplicas {
+			continue
+		}
+		price := vmSetCost(types.VMScale{vmType:numberVMs}, mapVMProfiles, pricingModel)
+		if price < bestPrice || (price == bestPrice && vmType < bestType) {
+			bestType = vmType
+			bestPrice = price
+		}
+	}
+	if bestType == "" {
+		return types.VMScale{},errors.New("No VM Candidate")
+	}
+	return types.VMScale{bestType:numberVMs},nil
 }
 
 /* Build Homogeneous cluster to deploy a number of replicas, each one with the defined constraint limits
@@ -480,10 +797,12 @@ func buildTree(node *Node, numberReplicas int, vmScaleList *[]types.VMScale, map
 		@numberReplicas	int - number of replicas
 		@limits bool types.Limits - limits constraints(cpu cores and memory gb) per replica
 		@mapVMProfiles - map with the profiles of VMs available
+		@pricingModel util.PricingModel
 	out:
 		@VMScale	- Map with the type of VM as key and the number of vms as value
 */
-func buildHomogeneousVMSet(numberReplicas int, limits types.Limit, mapVMProfiles map[string]types.VmProfile) (types.VMScale,error) {
+func buildHomogeneousVMSet(numberReplicas int, limits types.Limit, mapVMProfiles map[string]types.VmProfile,
+	pricingModel util.PricingModel) (types.VMScale,error) {
 	var err error
 	candidateVMSets := []types.VMScale{}
 	for _,v := range mapVMProfiles {
@@ -497,8 +816,8 @@ func buildHomogeneousVMSet(numberReplicas int, limits types.Limit, mapVMProfiles
 	}
 	if len(candidateVMSets) > 0 {
 		sort.Slice(candidateVMSets, func(i, j int) bool {
-			costi := candidateVMSets[i].Cost(mapVMProfiles)
-			costj := candidateVMSets[j].Cost(mapVMProfiles)
+			costi := vmSetCost(candidateVMSets[i], mapVMProfiles, pricingModel)
+			costj := vmSetCost(candidateVMSets[j], mapVMProfiles, pricingModel)
 			if costi < costj {
 				return true
 			} else if costi ==  costj {
@@ -544,7 +863,7 @@ func computeScaleOutTransitionTime(vmAdded types.VMScale, podResize bool, timeSt
 
 func validateVMProfilesAvailable(vmSet types.VMScale, mapVMProfiles map[string]types.VmProfile ) (bool, string) {
 	for k,_ := range vmSet {
-		if _,ok := mapVMProfiles[k]; !ok {
+		if _,ok := mapVMProfiles[types.OnDemandVMType(k)]; !ok {
 			return false, k
 		}
 	}
@@ -552,17 +871,5 @@ func validateVMProfilesAvailable(vmSet types.VMScale, mapVMProfiles map[string]t
 }
 
 func adjustGranularity(granularity string, capacityInSeconds float64) float64{
-	var factor float64
-
-	switch granularity {
-	case util.HOUR:
-		factor = 3600
-	case util.MINUTE:
-		factor = 60
-	case util.SECOND:
-		factor = 1
-	default:
-		factor = 3600
-	}
-	return factor * capacityInSeconds
+	return util.GranularityFactor(granularity) * capacityInSeconds
 }
\ No newline at end of file
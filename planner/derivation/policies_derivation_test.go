@@ -0,0 +1,557 @@
+package derivation
+
+import (
+	"encoding/json"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"testing"
+)
+
+const mockCurrentState = `{"active":{"Services":{"primeapp":{"Replicas":2,"Cpu":"200m","Memory":200000000}},"VMs":{"t2.micro":1}}}`
+
+/* Fake scheduler and performance profiles component. The current state is fixed and the
+	predicted MSCs scale linearly with the number of replicas of the profile with the requested limits
+	in:
+		@profile types.ServicePerformanceProfile
+	out:
+		@*httptest.Server
+*/
+func mockServices(profile types.ServicePerformanceProfile) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == util.ENDPOINT_CURRENT_STATE {
+			w.Write([]byte(mockCurrentState))
+			return
+		}
+		//.../{replicas or msc}/{numcoresutil}/{numcoreslimit}/{nummemlimit}
+		segments := strings.Split(r.URL.Path, "/")
+		if len(segments) < 4 {
+			http.NotFound(w, r)
+			return
+		}
+		value,_ := strconv.ParseFloat(segments[len(segments)-4], 64)
+		cores,_ := strconv.ParseFloat(segments[len(segments)-2], 64)
+		memory,_ := strconv.ParseFloat(segments[len(segments)-1], 64)
+		for _,p := range profile.Profiles {
+			if p.Limits.CPUCores != cores || p.Limits.MemoryGB != memory || len(p.MSCs) == 0 {
+				continue
+			}
+			setting := p.MSCs[0]
+			base := setting.MSCPerSecond.RegBruteForce
+			if strings.HasPrefix(r.URL.Path, "/getPredictedRegressionReplicas/") {
+				setting.Replicas = int(math.Ceil(value / base))
+			} else if strings.HasPrefix(r.URL.Path, "/getPredictedRegressionTRN/") {
+				setting.Replicas = int(value)
+			} else {
+				break
+			}
+			setting.MSCPerSecond.RegBruteForce = base * float64(setting.Replicas)
+			json.NewEncoder(w).Encode(setting)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func readJSON(t *testing.T, file string, v interface{}) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//Store the performance profiles and booting times of the fixtures in memory
+func loadMockProfiles(t *testing.T, serviceName string, servicePerformanceProfile types.ServicePerformanceProfile,
+	vmProfiles []types.VmProfile) {
+	serviceProfileDAO := storage.GetPerformanceProfileDAO(serviceName)
+	for _,p := range servicePerformanceProfile.Profiles {
+		mscSettings := []types.MSCSimpleSetting{}
+		for _,msc := range p.MSCs {
+			mscSettings = append(mscSettings, types.MSCSimpleSetting{
+				BootTimeSec: util.MillisecondsToSeconds(msc.BootTimeMs),
+				MSCPerSecond: msc.MSCPerSecond.RegBruteForce,
+				Replicas: msc.Replicas,
+			})
+		}
+		serviceProfileDAO.Insert(types.PerformanceProfile{ID:bson.NewObjectId(), Limit:p.Limits, MSCSettings:mscSettings})
+	}
+
+	var bootingTimes types.InstancesBootShutdownTime
+	readJSON(t, "../../tests_mock_input/mock_vms_all_times.json", &bootingTimes)
+	vmBootingProfileDAO := storage.GetVMBootingProfileDAO()
+	for _,vm := range vmProfiles {
+		bootingTimes.VMType = vm.Type
+		vmBootingProfileDAO.Insert(bootingTimes)
+	}
+}
+
+func TestPoliciesWithMemoryStorage(t *testing.T) {
+	storage.SetUpStorage(util.StorageConfiguration{Type:util.STORAGE_MEMORY})
+	defer storage.SetUpStorage(util.StorageConfiguration{})
+	defer storage.ResetMemoryStorage()
+
+	var servicePerformanceProfile types.ServicePerformanceProfile
+	readJSON(t, "../../tests_mock_input/performance_profiles_test.json", &servicePerformanceProfile)
+	services := mockServices(servicePerformanceProfile)
+	defer services.Close()
+
+	var vmProfiles []types.VmProfile
+	readJSON(t, "../../vm_profiles.json", &vmProfiles)
+	sort.Slice(vmProfiles, func(i, j int) bool {
+		return vmProfiles[i].Pricing.Price <= vmProfiles[j].Pricing.Price
+	})
+
+	sysConfiguration := util.SystemConfiguration{
+		MainServiceName: "primeapp",
+		ForecastComponent: util.ForecastComponent{Granularity:util.HOUR},
+		SchedulerComponent: util.Component{Endpoint:services.URL},
+		PerformanceProfilesComponent: util.Component{Endpoint:services.URL},
+		PricingModel: util.PricingModel{Budget:10000, BillingUnit:util.HOUR},
+	}
+	loadMockProfiles(t, sysConfiguration.MainServiceName, servicePerformanceProfile, vmProfiles)
+
+	//Scale the forecast down to the load covered by the fixture profiles
+	var forecast types.Forecast
+	readJSON(t, "../../tests_mock_input/mock_forecast_test.json", &forecast)
+	for i := range forecast.ForecastedValues {
+		forecast.ForecastedValues[i].Requests *= 0.05
+	}
+
+	policies, err := Policies(vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) == 0 {
+		t.Fatal("Policies expected candidate policies, got none")
+	}
+	for _,p := range policies {
+		if len(p.ScalingActions) == 0 {
+			t.Error("Policy of algorithm ", p.Algorithm, " has no scaling actions")
+		}
+	}
+
+	selected, err := SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected.Status != types.SELECTED || selected.ID != policies[0].ID {
+		t.Error("SelectPolicy expected the cheapest policy to be selected, got: ", selected.ID, selected.Status)
+	}
+	for _,p := range policies[1:] {
+		if p.Metrics.Cost < selected.Metrics.Cost {
+			t.Error("Selected policy cost: ", selected.Metrics.Cost, " is higher than: ", p.Metrics.Cost)
+		}
+	}
+}
+
+//Scenario without any component, replicas out of the profiles are extrapolated
+func offlineScenario(t *testing.T) ([]types.VmProfile, util.SystemConfiguration, types.Forecast, types.State) {
+	var servicePerformanceProfile types.ServicePerformanceProfile
+	readJSON(t, "../../tests_mock_input/performance_profiles_test.json", &servicePerformanceProfile)
+	var vmProfiles []types.VmProfile
+	readJSON(t, "../../vm_profiles.json", &vmProfiles)
+	sort.Slice(vmProfiles, func(i, j int) bool {
+		return vmProfiles[i].Pricing.Price <= vmProfiles[j].Pricing.Price
+	})
+
+	sysConfiguration := util.SystemConfiguration{
+		MainServiceName: "primeapp",
+		ForecastComponent: util.ForecastComponent{Granularity:util.HOUR},
+		PricingModel: util.PricingModel{Budget:10000, BillingUnit:util.HOUR},
+	}
+	loadMockProfiles(t, sysConfiguration.MainServiceName, servicePerformanceProfile, vmProfiles)
+
+	var forecast types.Forecast
+	readJSON(t, "../../tests_mock_input/mock_forecast_test.json", &forecast)
+	for i := range forecast.ForecastedValues {
+		forecast.ForecastedValues[i].Requests *= 0.05
+	}
+	currentState := types.State{
+		Services: map[string]types.ServiceInfo{"primeapp": {Scale:2, CPU:0.2, Memory:0.2}},
+		VMs: types.VMScale{"t2.micro":1},
+	}
+	return vmProfiles, sysConfiguration, forecast, currentState
+}
+
+/* Offline scenario with the storage in memory and the forecasted requests multiplied by a factor
+	out:
+		@func() - resets the storage
+*/
+func memoryScenario(t *testing.T, loadFactor float64) ([]types.VmProfile, util.SystemConfiguration, types.Forecast, types.State, func()) {
+	storage.SetUpStorage(util.StorageConfiguration{Type:util.STORAGE_MEMORY})
+	vmProfiles, sysConfiguration, forecast, currentState := offlineScenario(t)
+	for i := range forecast.ForecastedValues {
+		forecast.ForecastedValues[i].Requests *= loadFactor
+	}
+	reset := func() {
+		storage.ResetMemoryStorage()
+		storage.SetUpStorage(util.StorageConfiguration{})
+	}
+	return vmProfiles, sysConfiguration, forecast, currentState, reset
+}
+
+func TestPoliciesFromStateOffline(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast); err != nil {
+		t.Fatal(err)
+	}
+	for _,p := range policies {
+		if len(p.ScalingActions) == 0 || p.Metrics.Cost <= 0 {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected scaling actions and cost, got: ", len(p.ScalingActions), p.Metrics.Cost)
+		}
+		if p.Parameters[types.SIZINGQUANTILE] != util.QUANTILE_MEAN {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected sizing quantile: ", util.QUANTILE_MEAN, "got: ", p.Parameters[types.SIZINGQUANTILE])
+		}
+	}
+}
+
+func TestPoliciesWithUnderprovisioning(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+	sysConfiguration.PreferredAlgorithm = util.NAIVE_ALGORITHM
+
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil || len(policies) != 1 {
+		t.Fatal("Expected one naive policy, got: ", len(policies), err)
+	}
+	SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast)
+	fullLoadPolicy := policies[0]
+
+	sysConfiguration.PolicySettings.UnderprovisioningAllowed = true
+	sysConfiguration.PolicySettings.MaxUnderprovision = 20
+	policies, err = PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil || len(policies) != 1 {
+		t.Fatal("Expected one naive policy, got: ", len(policies), err)
+	}
+	SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast)
+	policy := policies[0]
+
+	if policy.Parameters[types.ISUNDERPROVISION] != "true" || policy.Parameters[types.MAXUNDERPROVISION] != "20.00" {
+		t.Error("Expected under provisioning parameters, got: ", policy.Parameters)
+	}
+	for _,sa := range policy.ScalingActions {
+		if sa.Metrics.UnderProvision > 20 {
+			t.Error("Scaling action at ", sa.TimeStart, " under provisions ", sa.Metrics.UnderProvision, "%")
+		}
+	}
+	if maxCapacity(policy) >= maxCapacity(fullLoadPolicy) {
+		t.Error("Expected peak capacity lower than: ", maxCapacity(fullLoadPolicy), "got: ", maxCapacity(policy))
+	}
+}
+
+func maxCapacity(policy types.Policy) float64 {
+	max := 0.0
+	for _,sa := range policy.ScalingActions {
+		max = math.Max(max, sa.Metrics.RequestsCapacity)
+	}
+	return max
+}
+
+func TestPoliciesWithVerticalScaling(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+
+	for _,method := range []string{util.SCALE_METHOD_VERTICAL, util.SCALE_METHOD_HYBRID} {
+		sysConfiguration.PolicySettings.ScalingMethod = method
+		policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+		if err != nil || len(policies) == 0 {
+			t.Fatal("Expected policies for method ", method, "got: ", len(policies), err)
+		}
+		for _,p := range policies {
+			//Hybrid records the method applied when only one of them changes the VMs
+			if p.Parameters[types.METHOD] != method && (method != util.SCALE_METHOD_HYBRID || p.Parameters[types.METHOD] == "") {
+				t.Error("Policy of algorithm ", p.Algorithm, " configured with method: ", method, "got: ", p.Parameters[types.METHOD])
+			}
+			if method != util.SCALE_METHOD_VERTICAL {
+				continue
+			}
+			for _,sa := range p.ScalingActions {
+				if len(sa.DesiredState.VMs) != 1 || sa.DesiredState.VMs.TotalVMs() != currentState.VMs.TotalVMs() {
+					t.Error("Policy of algorithm ", p.Algorithm, " expected ", currentState.VMs.TotalVMs(),
+						" VMs of one type, got: ", sa.DesiredState.VMs)
+				}
+			}
+		}
+	}
+}
+
+func TestAppliedScalingMethod(t *testing.T) {
+	//No VM type hosts the replicas of a load 50 times higher in the current number of VMs
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 50)
+	defer reset()
+	sysConfiguration.PolicySettings.ScalingMethod = util.SCALE_METHOD_VERTICAL
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil || len(policies) == 0 {
+		t.Fatal("Expected policies, got: ", len(policies), err)
+	}
+	for _,p := range policies {
+		if p.Parameters[types.METHOD] != util.SCALE_METHOD_HORIZONTAL && p.Parameters[types.METHOD] != util.SCALE_METHOD_HYBRID {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected the horizontal fallback to be recorded, got: ", p.Parameters[types.METHOD])
+		}
+	}
+}
+
+func TestPoliciesWithScalingConstraints(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 20)
+	defer reset()
+	sysConfiguration.PolicySettings.MinimumHold = 3 * 3600
+	sysConfiguration.PolicySettings.MinimumVMScalingGap = 6 * 3600
+
+	policies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil || len(policies) == 0 {
+		t.Fatal("Expected policies, got: ", len(policies), err)
+	}
+	for _,p := range policies {
+		var lastVMScaling *types.ScalingAction
+		for i,sa := range p.ScalingActions {
+			if i < len(p.ScalingActions) - 1 && p.ScalingActions[i+1].TimeStart.Sub(sa.TimeStart).Seconds() < sysConfiguration.PolicySettings.MinimumHold {
+				t.Error("Policy of algorithm ", p.Algorithm, " expected scaling actions of at least 3 hours, got: ", sa.TimeStart, p.ScalingActions[i+1].TimeStart)
+			}
+			if vmAdded, vmRemoved := DeltaVMSet(sa.InitialState.VMs, sa.DesiredState.VMs); len(vmAdded) == 0 && len(vmRemoved) == 0 {
+				continue
+			}
+			if lastVMScaling != nil && sa.TimeStart.Sub(lastVMScaling.TimeStart).Seconds() < sysConfiguration.PolicySettings.MinimumVMScalingGap {
+				t.Error("Policy of algorithm ", p.Algorithm, " expected VM scaling actions 6 hours apart, got: ", lastVMScaling.TimeStart, sa.TimeStart)
+			}
+			lastVMScaling = &p.ScalingActions[i]
+			if i > 0 && !sa.InitialState.Equal(p.ScalingActions[i-1].DesiredState) {
+				t.Error("Policy of algorithm ", p.Algorithm, " expected to scale from the previous state, got: ", sa.InitialState.VMs, p.ScalingActions[i-1].DesiredState.VMs)
+			}
+		}
+	}
+}
+
+func TestBuildVerticalVMSet(t *testing.T) {
+	mapVMProfiles := map[string]types.VmProfile{
+		"small": {Type:"small", CPUCores:1, Memory:2, Pricing:types.Pricing{Price:0.02}},
+		"large": {Type:"large", CPUCores:4, Memory:8, Pricing:types.Pricing{Price:0.08}},
+	}
+	limits := types.Limit{CPUCores:0.5, MemoryGB:0.5}
+
+	vmSet, err := buildVerticalVMSet(2, limits, 2, mapVMProfiles, util.PricingModel{})
+	if err != nil || vmSet["small"] != 2 {
+		t.Error("For 2 replicas in 2 VMs expected: ", "small:2", "got: ", vmSet, err)
+	}
+	vmSet, err = buildVerticalVMSet(8, limits, 2, mapVMProfiles, util.PricingModel{})
+	if err != nil || vmSet["large"] != 2 {
+		t.Error("For 8 replicas in 2 VMs expected: ", "large:2", "got: ", vmSet, err)
+	}
+	if _, err = buildVerticalVMSet(30, limits, 2, mapVMProfiles, util.PricingModel{}); err == nil {
+		t.Error("For 30 replicas in 2 VMs expected an error")
+	}
+}
+
+func TestApplicationPoliciesFromState(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+
+	//Second service with the same profiles and half of the load
+	var servicePerformanceProfile types.ServicePerformanceProfile
+	readJSON(t, "../../tests_mock_input/performance_profiles_test.json", &servicePerformanceProfile)
+	loadMockProfiles(t, "ratings", servicePerformanceProfile, vmProfiles)
+	ratingsForecast := forecast
+	ratingsForecast.ForecastedValues = make([]types.ForecastedValue, len(forecast.ForecastedValues))
+	for i,v := range forecast.ForecastedValues {
+		v.Requests *= 0.5
+		ratingsForecast.ForecastedValues[i] = v
+	}
+	currentState.Services["ratings"] = types.ServiceInfo{Scale:1, CPU:0.2, Memory:0.2}
+	sysConfiguration.Services = []util.ServiceConfiguration{{Name:"primeapp"}, {Name:"ratings"}}
+	forecasts := map[string]types.Forecast{"primeapp":forecast, "ratings":ratingsForecast}
+
+	policies, err := ApplicationPoliciesFromState(currentState, vmProfiles, sysConfiguration, forecasts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) == 0 {
+		t.Fatal("ApplicationPoliciesFromState expected candidate policies, got none")
+	}
+	mapVMProfiles := VMListToMap(vmProfiles)
+	for _,p := range policies {
+		if p.Parameters[types.SERVICES] != "primeapp,ratings" {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected services: ", "primeapp,ratings", "got: ", p.Parameters[types.SERVICES])
+		}
+		for _,a := range p.ScalingActions {
+			services := a.DesiredState.Services
+			if services["primeapp"].Scale == 0 || services["ratings"].Scale == 0 {
+				t.Error("Policy of algorithm ", p.Algorithm, " expected both services in state, got: ", services)
+			}
+			if !canHostServices(services, a.DesiredState.VMs, mapVMProfiles) {
+				t.Error("Policy of algorithm ", p.Algorithm, " VMs: ", a.DesiredState.VMs, " can not host: ", services)
+			}
+			if a.Metrics.ServicesCapacity["primeapp"] == 0 || a.Metrics.ServicesCapacity["ratings"] == 0 {
+				t.Error("Policy of algorithm ", p.Algorithm, " expected the capacity of both services, got: ", a.Metrics.ServicesCapacity)
+			}
+		}
+		if _,ok := p.Metrics.ServicesUnderProvision["ratings"]; !ok {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected the under provisioning of both services, got: ", p.Metrics.ServicesUnderProvision)
+		}
+	}
+	if _, err = SelectPolicy(&policies, sysConfiguration, vmProfiles, forecast); err != nil {
+		t.Fatal(err)
+	}
+	for _,p := range policies {
+		if p.Metrics.UnderProvision < p.Metrics.ServicesUnderProvision["ratings"] {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected the under provisioning of the worst service, got: ",
+				p.Metrics.UnderProvision, p.Metrics.ServicesUnderProvision)
+		}
+	}
+
+	if _, err = ApplicationPoliciesFromState(currentState, vmProfiles, sysConfiguration, map[string]types.Forecast{"primeapp":forecast}); err == nil {
+		t.Error("Without the forecast of a service expected an error, got none")
+	}
+}
+
+func TestServiceProvision(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	scalingActions := []types.ScalingAction{
+		{TimeStart:start, TimeEnd:start.Add(2 * time.Hour), Metrics:types.ConfigMetrics{ServicesCapacity:map[string]float64{"a":100, "b":50}}},
+	}
+	forecast := []types.ForecastedValue{{TimeStamp:start, Requests:50}, {TimeStamp:start.Add(time.Hour), Requests:200}}
+	//The service a is 100% over provisioned in the first hour and 50% under provisioned in the second one
+	if over, under := serviceProvision(scalingActions, forecast, "a"); over != 100 || under != 50 {
+		t.Error("Expected 100% over and 50% under provisioning, got: ", over, under)
+	}
+	if over, under := serviceProvision(scalingActions, forecast, "b"); over != 0 || under != 75 {
+		t.Error("Expected 75% under provisioning, got: ", over, under)
+	}
+}
+
+func TestBuildApplicationVMSet(t *testing.T) {
+	mapVMProfiles := map[string]types.VmProfile{
+		"small": {Type:"small", CPUCores:1, Memory:2, Pricing:types.Pricing{Price:1}},
+		"large": {Type:"large", CPUCores:4, Memory:8, Pricing:types.Pricing{Price:2}},
+	}
+	services := types.Service{
+		"a": {Scale:3, CPU:0.9, Memory:1},
+		"b": {Scale:4, CPU:0.4, Memory:0.5},
+	}
+	vmSet, err := buildApplicationVMSet(services, 0, mapVMProfiles, util.PricingModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vmSet.Equal(types.VMScale{"large":2}) {
+		t.Error("Expected: ", types.VMScale{"large":2}, "got: ", vmSet)
+	}
+	if !canHostServices(services, vmSet, mapVMProfiles) || canHostServices(services, types.VMScale{"large":1}, mapVMProfiles) {
+		t.Error("Unexpected hosting capacity for: ", services)
+	}
+	if _, err = buildApplicationVMSet(services, 1, mapVMProfiles, util.PricingModel{}); err == nil {
+		t.Error("Expected no VM type able to host the services in 1 VM")
+	}
+}
+
+func TestBuildHeterogeneousVMSet(t *testing.T) {
+	mapVMProfiles := map[string]types.VmProfile{
+		"a": {Type:"a", CPUCores:2, Memory:4, Pricing:types.Pricing{Price:1}},
+		"b": {Type:"b", CPUCores:4, Memory:8, Pricing:types.Pricing{Price:2.5}},
+		"c": {Type:"c", CPUCores:8, Memory:16, Pricing:types.Pricing{Price:5}},
+	}
+	limits := types.Limit{CPUCores:1, MemoryGB:1}
+	vmSet, err := buildHeterogeneousVMSet(10, limits, mapVMProfiles, util.PricingModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := types.VMScale{"b":1, "c":1}
+	if !vmSet.Equal(expected) {
+		t.Error("Expected: ", expected, "got: ", vmSet)
+	}
+	homogeneousVMSet,_ := buildHomogeneousVMSet(10, limits, mapVMProfiles, util.PricingModel{})
+	if vmSet.Cost(mapVMProfiles) > homogeneousVMSet.Cost(mapVMProfiles) {
+		t.Error("Heterogeneous set: ", vmSet, " is more expensive than: ", homogeneousVMSet)
+	}
+
+	if _, err = buildHeterogeneousVMSet(10, types.Limit{CPUCores:16, MemoryGB:1}, mapVMProfiles, util.PricingModel{}); err == nil {
+		t.Error("Expected no VM type able to host replicas of 16 cores")
+	}
+}
+
+func TestPoliciesWithSpotInstances(t *testing.T) {
+	vmProfiles, sysConfiguration, forecast, currentState, reset := memoryScenario(t, 1)
+	defer reset()
+	for i := range vmProfiles {
+		vmProfiles[i].Pricing.SpotPrice = vmProfiles[i].Pricing.Price * 0.3
+		vmProfiles[i].Pricing.InterruptionRate = 0.05
+	}
+
+	onDemandPolicies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SelectPolicy(&onDemandPolicies, sysConfiguration, vmProfiles, forecast)
+
+	sysConfiguration.PolicySettings.SpotInstancesAllowed = true
+	sysConfiguration.PolicySettings.OnDemandBaseline = 50
+	spotPolicies, err := PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SelectPolicy(&spotPolicies, sysConfiguration, vmProfiles, forecast)
+
+	onDemandCost := 0.0
+	for _,p := range onDemandPolicies {
+		onDemandCost += p.Metrics.Cost
+		if p.Metrics.ExpectedCost != p.Metrics.Cost || p.Metrics.ExpectedCapacityLoss != 0 {
+			t.Error("Policy of algorithm ", p.Algorithm, " without spot VMs expected cost: ", p.Metrics.Cost, "got: ", p.Metrics.ExpectedCost, p.Metrics.ExpectedCapacityLoss)
+		}
+	}
+	spotCost := 0.0
+	for _,p := range spotPolicies {
+		spotCost += p.Metrics.Cost
+		if p.Parameters[types.ISSPOTINSTANCES] != "true" || p.Parameters[types.ONDEMANDBASELINE] != "50.00" {
+			t.Error("Policy of algorithm ", p.Algorithm, " unexpected parameters: ", p.Parameters)
+		}
+		spotVMs := false
+		for _,a := range p.ScalingActions {
+			vms := a.DesiredState.VMs
+			for k,v := range vms {
+				spotVMs = spotVMs || types.IsSpotVMType(k)
+				if !types.IsSpotVMType(k) && v < vms[types.SpotVMType(k)] {
+					t.Error("Policy of algorithm ", p.Algorithm, " VMs: ", vms, " below the on-demand baseline")
+				}
+			}
+		}
+		if spotVMs && (p.Metrics.ExpectedCost < p.Metrics.Cost || p.Metrics.ExpectedCapacityLoss <= 0) {
+			t.Error("Policy of algorithm ", p.Algorithm, " expected cost and capacity loss of interruptions, got: ", p.Metrics.ExpectedCost, p.Metrics.ExpectedCapacityLoss)
+		}
+	}
+	if spotCost >= onDemandCost {
+		t.Error("Expected policies with spot VMs cheaper than: ", onDemandCost, "got: ", spotCost)
+	}
+}
+
+func TestSpotVMSet(t *testing.T) {
+	mapVMProfiles := map[string]types.VmProfile{
+		"a": {Type:"a", Pricing:types.Pricing{Price:1, SpotPrice:0.3}},
+		"b": {Type:"b", Pricing:types.Pricing{Price:2}},
+	}
+	vmSet := spotVMSet(types.VMScale{"a":3, "b":2}, 50, mapVMProfiles)
+	expected := types.VMScale{"a":2, "a-spot":1, "b":2}
+	if !vmSet.Equal(expected) {
+		t.Error("Expected: ", expected, "got: ", vmSet)
+	}
+	if cost := vmSet.Cost(mapVMProfiles); math.Abs(cost - 6.3) > 1e-9 {
+		t.Error("Expected cost: ", 6.3, "got: ", cost)
+	}
+	if onDemand := vmSet.OnDemandVMSet(); !onDemand.Equal(types.VMScale{"a":3, "b":2}) {
+		t.Error("Expected on-demand set: ", types.VMScale{"a":3, "b":2}, "got: ", onDemand)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"sort"
 	"errors"
 	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"strconv"
 )
 
 /*Evaluates and select the most suitable policy for the given system configurations and forecast
@@ -32,36 +34,178 @@ func SelectPolicy(policies *[]types.Policy, sysConfig util.SystemConfiguration,
 		policyMetrics.FinishTimeDerivation = (*policies)[i].Metrics.FinishTimeDerivation
 		duration := (*policies)[i].Metrics.FinishTimeDerivation.Sub((*policies)[i].Metrics.StartTimeDerivation).Seconds()
 		policyMetrics.DerivationDuration = util.RoundN(duration, 2.0)
+		policyMetrics.ServicesOverProvision = (*policies)[i].Metrics.ServicesOverProvision
+		policyMetrics.ServicesUnderProvision = (*policies)[i].Metrics.ServicesUnderProvision
+		for _,underProvision := range policyMetrics.ServicesUnderProvision {
+			//The application is under provisioned as much as its most under provisioned service
+			policyMetrics.UnderProvision = math.Max(policyMetrics.UnderProvision, underProvision)
+		}
 		(*policies)[i].Metrics = policyMetrics
 		(*policies)[i].Parameters[types.VMTYPES] = MapKeysToString(vmTypes)
 	}
-	//Sort policies based on price
-	sort.Slice(*policies, func(i, j int) bool {
-		costi := (*policies)[i].Metrics.Cost
-		costj := (*policies)[j].Metrics.Cost
-
-		if costi < costj {
-			return true
-		}else  if costi == costj {
-			return (*policies)[i].Metrics.NumberContainerScalingActions < (*policies)[j].Metrics.NumberContainerScalingActions
-		}
-		return false
-	})
+	//Sort policies based on the preferred metric
+	sortPolicies(policies, sysConfig.PolicySettings)
+	//Keep the trade-offs as candidates
+	markParetoFront(policies)
 
 	if len(*policies) >0 {
-		remainBudget, time := isEnoughBudget(sysConfig.PricingModel.Budget, (*policies)[0])
-		if remainBudget {
-			(*policies)[0].Status = types.SELECTED
-			return (*policies)[0], nil
-		} else {
+		spentBudget := make(map[string]float64)
+		if sysConfig.PricingModel.Budget > 0 {
+			spentBudget = ledgerSpend(sysConfig.MainServiceName)
+		}
+		remainBudget, time := isEnoughBudget(sysConfig.PricingModel, (*policies)[0], spentBudget, mapVMProfiles)
+		(*policies)[0].Parameters[types.ISOVERBUDGET] = strconv.FormatBool(!remainBudget)
+		if !remainBudget {
+			//A policy capped to the budget keeps at least one VM, which can still exceed it
 			return (*policies)[0], errors.New("Budget is not enough for time window, you should increase the budget to ensure resources after " +time.String())
 		}
+		if (*policies)[0].Parameters[types.ISBUDGETLIMITED] == "true" {
+			//The policy was already capped to the budget during derivation
+			log.Warningf("Selected policy is limited by the budget, resources are under provisioned after %s",
+				budgetLimitTime((*policies)[0]).String())
+		}
+		(*policies)[0].Status = types.SELECTED
+		return (*policies)[0], nil
 	} else {
 		return types.Policy{}, errors.New("No suitable policy found")
 	}
 }
 
 
+/* Mark as candidates the policies in the Pareto front over cost, under provisioning
+	and number of scaling actions. The other policies are discarted
+ in:
+	@policies *[]types.Policy
+*/
+func markParetoFront(policies *[]types.Policy) {
+	for i := range *policies {
+		(*policies)[i].Status = types.CANDIDATE
+		for j := range *policies {
+			if i != j && dominates((*policies)[j].Metrics, (*policies)[i].Metrics) {
+				(*policies)[i].Status = types.DISCARTED
+				break
+			}
+		}
+	}
+}
+
+//A policy dominates another if it is not worse in any objective and it is better in at least one
+func dominates(a types.PolicyMetrics, b types.PolicyMetrics) bool {
+	notWorse := a.Cost <= b.Cost && a.UnderProvision <= b.UnderProvision && a.NumberScalingActions <= b.NumberScalingActions
+	better := a.Cost < b.Cost || a.UnderProvision < b.UnderProvision || a.NumberScalingActions < b.NumberScalingActions
+	return notWorse && better
+}
+
+/* Sort the policies from the best to the worst according to the preferred metric.
+	All metrics are better when lower. Ties are broken by cost and then by number of container scaling actions
+ in:
+	@policies *[]types.Policy
+	@policySettings util.PolicySettings
+				- Preferred metric and weights of each metric for the weighted score
+*/
+func sortPolicies(policies *[]types.Policy, policySettings util.PolicySettings) {
+	preferredMetric := policySettings.PreferredMetric
+	if preferredMetric == "" {
+		preferredMetric = util.COST
+	}
+	var scores []float64
+	if preferredMetric == util.WEIGHTED_METRICS {
+		scores = weightedScores(*policies, policySettings.MetricWeights)
+		for i := range *policies {
+			(*policies)[i].Metrics.Score = util.RoundN(scores[i], 4.0)
+		}
+	}
+	sort.Sort(policiesByMetric{policies:*policies, metric:preferredMetric, scores:scores})
+}
+
+type policiesByMetric struct {
+	policies []types.Policy
+	metric   string
+	scores   []float64
+}
+
+func (p policiesByMetric) Len() int {
+	return len(p.policies)
+}
+
+func (p policiesByMetric) Swap(i, j int) {
+	p.policies[i], p.policies[j] = p.policies[j], p.policies[i]
+	if p.scores != nil {
+		p.scores[i], p.scores[j] = p.scores[j], p.scores[i]
+	}
+}
+
+func (p policiesByMetric) Less(i, j int) bool {
+	var valuei, valuej float64
+	if p.scores != nil {
+		valuei, valuej = p.scores[i], p.scores[j]
+	} else {
+		valuei, valuej = metricValue(p.policies[i].Metrics, p.metric), metricValue(p.policies[j].Metrics, p.metric)
+	}
+	if valuei != valuej {
+		return valuei < valuej
+	}
+	costi := p.policies[i].Metrics.Cost
+	costj := p.policies[j].Metrics.Cost
+	if costi != costj {
+		return costi < costj
+	}
+	return p.policies[i].Metrics.NumberContainerScalingActions < p.policies[j].Metrics.NumberContainerScalingActions
+}
+
+//Value of the policy metric with the given name, cost by default. The names are validated with the configuration
+func metricValue(metrics types.PolicyMetrics, metric string) float64 {
+	switch metric {
+	case util.UNDER_PROVISION:
+		return metrics.UnderProvision
+	case util.OVER_PROVISION:
+		return metrics.OverProvision
+	case util.NUMBER_SCALING_ACTIONS:
+		return float64(metrics.NumberScalingActions)
+	case util.TRANSITION_TIME:
+		return metrics.AvgTransitionTime
+	case util.DERIVATION_TIME:
+		return metrics.DerivationDuration
+	default:
+		return metrics.Cost
+	}
+}
+
+/* Compute the weighted score of each policy. Each metric is normalized between 0 and 1
+	among the candidate policies, so that weights are independent of the metric units
+ in:
+	@policies []types.Policy
+	@weights map[string]float64
+				- Weight of each metric, if empty only the cost is considered
+ out:
+	@[]float64	- Score of each policy, lower is better
+*/
+func weightedScores(policies []types.Policy, weights map[string]float64) []float64 {
+	scores := make([]float64, len(policies))
+	if len(weights) == 0 {
+		weights = map[string]float64{util.COST:1}
+	}
+	for metric, weight := range weights {
+		if len(policies) == 0 {
+			break
+		}
+		min := metricValue(policies[0].Metrics, metric)
+		max := min
+		for _,p := range policies {
+			value := metricValue(p.Metrics, metric)
+			min = math.Min(min, value)
+			max = math.Max(max, value)
+		}
+		if max == min {
+			continue
+		}
+		for i,p := range policies {
+			scores[i] += weight * (metricValue(p.Metrics, metric) - min) / (max - min)
+		}
+	}
+	return scores
+}
+
 //Compute the metrics related to the policy and its scaling actions
 func ComputePolicyMetrics(scalingActions *[]types.ScalingAction, forecast []types.ForecastedValue,
 	sysConfiguration util.SystemConfiguration, mapVMProfiles map[string]types.VmProfile) (types.PolicyMetrics, map[string]bool) {
@@ -73,8 +217,11 @@ func ComputePolicyMetrics(scalingActions *[]types.ScalingAction, forecast []type
 	var avgShadowTime float64
 
 	totalCost	:= 0.0
+	totalExpectedCost := 0.0
+	totalCapacityLoss := 0.0
 	numberVMScalingActions := 0
 	numberContainerScalingActions := 0
+	numberChanges := 0
 	vmTypes := make(map[string] bool)
 	totalOver := 0.0
 	totalUnder := 0.0
@@ -84,6 +231,7 @@ func ComputePolicyMetrics(scalingActions *[]types.ScalingAction, forecast []type
 
 	index := 0
 	numberScalingActions := len(*scalingActions)
+	vmsCosts := vmsBilledCost(*scalingActions, sysConfiguration.PricingModel, mapVMProfiles)
 	nPredictedValues := len(forecast)
 	for i, _ := range *scalingActions {
 		scalingAction := (*scalingActions)[i]
@@ -133,18 +281,38 @@ func ComputePolicyMetrics(scalingActions *[]types.ScalingAction, forecast []type
 		if !desiredServiceReplicas.Equal(initialServiceReplicas) {
 			numberContainerScalingActions += 1
 		}
+		if !vmSetDesired.Equal(vmSetInitial) || !desiredServiceReplicas.Equal(initialServiceReplicas) {
+			numberChanges += 1
+		}
 
 		totalCPUCoresInVMSet := 0.0
 		totalMemGBInVMSet := 0.0
-		deltaTime := BilledTime(scalingAction.TimeStart, scalingAction.TimeEnd, sysConfiguration.PricingModel.BillingUnit)
+		replicasCapacity := 0.0
+		expectedReplicasLoss := 0.0
+		podLimits := types.Limit{CPUCores:desiredServiceReplicas.CPU, MemoryGB:desiredServiceReplicas.Memory}
+		cost = util.RoundN(vmsCosts[i], 2.0)
+		spotAdjustment := 0.0
 		for k,v := range vmSetDesired {
 			vmTypes[k] = true
-			totalCPUCoresInVMSet += mapVMProfiles[k].CPUCores * float64(v)
-			totalMemGBInVMSet += mapVMProfiles[k].Memory * float64(v)
-			totalPrice := mapVMProfiles [k].Pricing.Price * float64(v) * deltaTime
-			cost +=  util.RoundN(totalPrice, 2.0)
+			profile := types.VMProfileByType(mapVMProfiles, k)
+			totalCPUCoresInVMSet += profile.CPUCores * float64(v)
+			totalMemGBInVMSet += profile.Memory * float64(v)
+			capacity := float64(maxPodsCapacityInVM(profile, podLimits) * v)
+			replicasCapacity += capacity
+			if types.IsSpotVMType(k) {
+				//Interrupted spot VMs are replaced by on-demand VMs, on average in the middle of the action
+				probability := interruptionProbability(profile, scalingAction.TimeStart, scalingAction.TimeEnd)
+				onDemandPrice := mapVMProfiles[types.OnDemandVMType(k)].Pricing.Price
+				hours := scalingAction.TimeEnd.Sub(scalingAction.TimeStart).Hours()
+				spotAdjustment += (onDemandPrice - profile.Pricing.Price) * probability/2 * float64(v) * hours
+				expectedReplicasLoss += capacity * probability
+			}
 		}
 		totalCost += cost
+		totalExpectedCost += cost + util.RoundN(spotAdjustment, 2.0)
+		if replicasCapacity > 0 {
+			totalCapacityLoss += expectedReplicasLoss * 100.0 / replicasCapacity
+		}
 
 		if i>1 {
 			previousStateEndTime := (*scalingActions)[i-1].TimeEnd
@@ -169,6 +337,8 @@ func ComputePolicyMetrics(scalingActions *[]types.ScalingAction, forecast []type
 			RequestsCapacity:  scalingAction.Metrics.RequestsCapacity,
 			CPUUtilization:    cpuUtilization,
 			MemoryUtilization: memUtilization,
+			BudgetLimited:     scalingAction.Metrics.BudgetLimited,
+			ServicesCapacity:  scalingAction.Metrics.ServicesCapacity,
 		}
 		(*scalingActions)[i].Metrics = configMetrics
 	}
@@ -185,9 +355,11 @@ func ComputePolicyMetrics(scalingActions *[]types.ScalingAction, forecast []type
 		UnderProvision:	util.RoundN(avgUnderProvision, 2.0),
 		NumberVMScalingActions:	numberVMScalingActions,
 		NumberContainerScalingActions:numberContainerScalingActions,
-		NumberScalingActions:numberVMScalingActions,
+		NumberScalingActions:numberChanges,
 		AvgElapsedTime:	util.RoundN(avgElapsedTime, 2.0),
 		AvgShadowTime:	util.RoundN(avgShadowTime, 2.0),
 		AvgTransitionTime:	util.RoundN(avgTransitionTime, 2.0),
+		ExpectedCost:	util.RoundN(totalExpectedCost, 2.0),
+		ExpectedCapacityLoss:	util.RoundN(totalCapacityLoss / float64(numberScalingActions), 2.0),
 	}, vmTypes
 }
\ No newline at end of file
@@ -0,0 +1,72 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"testing"
+)
+
+func candidatePolicies() []types.Policy {
+	return []types.Policy{
+		{Algorithm:"cheap", Metrics:types.PolicyMetrics{Cost:10, UnderProvision:30, OverProvision:5, NumberScalingActions:8, AvgTransitionTime:120}},
+		{Algorithm:"safe", Metrics:types.PolicyMetrics{Cost:30, UnderProvision:0, OverProvision:40, NumberScalingActions:4, AvgTransitionTime:200}},
+		{Algorithm:"balanced", Metrics:types.PolicyMetrics{Cost:14, UnderProvision:5, OverProvision:20, NumberScalingActions:2, AvgTransitionTime:60}},
+	}
+}
+
+func TestSortPoliciesByPreferredMetric(t *testing.T) {
+	expected := map[string]string{
+		"":                          "cheap",
+		util.COST:                   "cheap",
+		util.UNDER_PROVISION:        "safe",
+		util.OVER_PROVISION:         "cheap",
+		util.NUMBER_SCALING_ACTIONS: "balanced",
+		util.TRANSITION_TIME:        "balanced",
+	}
+	for metric, algorithm := range expected {
+		policies := candidatePolicies()
+		sortPolicies(&policies, util.PolicySettings{PreferredMetric:metric})
+		if policies[0].Algorithm != algorithm {
+			t.Error("For metric: ", metric, "expected: ", algorithm, "got: ", policies[0].Algorithm)
+		}
+	}
+}
+
+func TestSortPoliciesByWeightedScore(t *testing.T) {
+	policies := candidatePolicies()
+	weights := map[string]float64{util.COST:0.5, util.UNDER_PROVISION:0.5}
+	sortPolicies(&policies, util.PolicySettings{PreferredMetric:util.WEIGHTED_METRICS, MetricWeights:weights})
+	if policies[0].Algorithm != "balanced" {
+		t.Error("For weights: ", weights, "expected: ", "balanced", "got: ", policies[0].Algorithm)
+	}
+	for i := 1; i < len(policies); i++ {
+		if policies[i-1].Metrics.Score > policies[i].Metrics.Score {
+			t.Error("Policies not sorted by score: ", policies[i-1].Metrics.Score, policies[i].Metrics.Score)
+		}
+	}
+
+	policies = candidatePolicies()
+	sortPolicies(&policies, util.PolicySettings{PreferredMetric:util.WEIGHTED_METRICS})
+	if policies[0].Algorithm != "cheap" {
+		t.Error("Without weights expected: ", "cheap", "got: ", policies[0].Algorithm)
+	}
+}
+
+func TestMarkParetoFront(t *testing.T) {
+	policies := candidatePolicies()
+	policies = append(policies, types.Policy{Algorithm:"dominated",
+		Metrics:types.PolicyMetrics{Cost:20, UnderProvision:10, NumberScalingActions:3}})
+	markParetoFront(&policies)
+
+	expected := map[string]string{
+		"cheap":     types.CANDIDATE,
+		"safe":      types.CANDIDATE,
+		"balanced":  types.CANDIDATE,
+		"dominated": types.DISCARTED,
+	}
+	for _,p := range policies {
+		if p.Status != expected[p.Algorithm] {
+			t.Error("For policy: ", p.Algorithm, "expected: ", expected[p.Algorithm], "got: ", p.Status)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package derivation
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/* Replace the VMs of a policy by spot VMs of the same type, keeping the on-demand baseline.
+	The scaling actions are set up again from the deployed state, since the VMs launched and released change
+	in:
+		@policy *types.Policy
+		@deployedState types.State - current state, including its spot VMs
+		@mapVMProfiles map[string]types.VmProfile
+		@policySettings util.PolicySettings
+*/
+func mixSpotInstances(policy *types.Policy, deployedState types.State, mapVMProfiles map[string]types.VmProfile,
+	policySettings util.PolicySettings) {
+	scalingActions := []types.ScalingAction{}
+	previousState := deployedState
+	numberActions := len(policy.ScalingActions)
+	for i,a := range policy.ScalingActions {
+		timeEnd := policy.TimeWindowEnd
+		if i < numberActions - 1 {
+			timeEnd = policy.ScalingActions[i+1].TimeStart
+		}
+		state := types.State{
+			Services: a.DesiredState.Services,
+			VMs:      spotVMSet(a.DesiredState.VMs, policySettings.OnDemandBaseline, mapVMProfiles),
+		}
+		setScalingSteps(&scalingActions, previousState, state, a.TimeStart, timeEnd, servicesBootingTime(state.Services), a.Metrics.RequestsCapacity, policySettings)
+		previousState = state
+	}
+	policy.ScalingActions = scalingActions
+	policy.Metrics.NumberScalingActions = len(scalingActions)
+	if len(scalingActions) > 0 {
+		policy.TimeWindowStart = scalingActions[0].TimeStart
+		policy.TimeWindowEnd = scalingActions[len(scalingActions)-1].TimeEnd
+	}
+	policy.Parameters[types.ISSPOTINSTANCES] = strconv.FormatBool(true)
+	policy.Parameters[types.ONDEMANDBASELINE] = strconv.FormatFloat(onDemandBaseline(policySettings.OnDemandBaseline), 'f', 2, 64)
+}
+
+/* Split the VMs of each type with spot price into on-demand and spot VMs
+	in:
+		@vmSet types.VMScale - on-demand VM set
+		@baseline float64 - percentage of the VMs of each type kept on-demand
+		@mapVMProfiles map[string]types.VmProfile
+	out:
+		@VMScale
+*/
+func spotVMSet(vmSet types.VMScale, baseline float64, mapVMProfiles map[string]types.VmProfile) types.VMScale {
+	baseline = onDemandBaseline(baseline)
+	vmTypes := []string{}
+	for k := range vmSet {
+		vmTypes = append(vmTypes, k)
+	}
+	sort.Strings(vmTypes)
+
+	mixedVMSet := make(types.VMScale)
+	for _,k := range vmTypes {
+		n := vmSet[k]
+		if types.IsSpotVMType(k) || mapVMProfiles[k].Pricing.SpotPrice <= 0 {
+			mixedVMSet[k] += n
+			continue
+		}
+		onDemand := int(math.Ceil(float64(n) * baseline / 100.0))
+		if onDemand > 0 {
+			mixedVMSet[k] += onDemand
+		}
+		if n - onDemand > 0 {
+			mixedVMSet[types.SpotVMType(k)] += n - onDemand
+		}
+	}
+	return mixedVMSet
+}
+
+//Percentage of on-demand VMs between 0 and 100
+func onDemandBaseline(baseline float64) float64 {
+	return math.Max(0, math.Min(100, baseline))
+}
+
+//Probability that a spot VM is interrupted between timeStart and timeEnd
+func interruptionProbability(profile types.VmProfile, timeStart time.Time, timeEnd time.Time) float64 {
+	hours := timeEnd.Sub(timeStart).Hours()
+	return math.Max(0, math.Min(1, profile.Pricing.InterruptionRate * hours))
+}
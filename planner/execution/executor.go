@@ -0,0 +1,196 @@
+package execution
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/rest_clients/scheduler"
+	"sync"
+	"time"
+)
+
+//Backend that applies the scaling actions of the selected policies
+type Executor interface {
+	Schedule(policy types.Policy) error
+	Invalidate(timestamp time.Time) error
+	CurrentState(serviceNames []string) (types.State, error)
+}
+
+/* Select the executor for the type of the scheduler component
+	in:
+		@component util.Component
+	out:
+		@Executor - the SPDT scheduler if the type is empty
+*/
+func GetExecutor(component util.Component) Executor {
+	switch component.Type {
+	case util.SCHEDULER_KUBERNETES:
+		return &KubernetesExecutor{Component:component}
+	case util.SCHEDULER_FILE:
+		return &FileExecutor{Path:component.File.Path, CurrentStatePath:component.File.CurrentStatePath}
+	}
+	return &SchedulerExecutor{Endpoint:component.Endpoint}
+}
+
+//Executor that sends the states to the SPDT scheduler, one request for each scaling action
+type SchedulerExecutor struct {
+	Endpoint        string
+	ScheduledStates []scheduler.StateToSchedule
+}
+
+//Send the states of the policy, invalidating the states already sent if a request fails
+func (e *SchedulerExecutor) Schedule(policy types.Policy) error {
+	var err error
+	e.ScheduledStates, err = TriggerScheduler(policy, e.Endpoint + util.ENDPOINT_STATES)
+	if err != nil && len(e.ScheduledStates) > 0 {
+		rollbackErr := e.Invalidate(e.ScheduledStates[0].LaunchTime)
+		if rollbackErr != nil {
+			log.Errorf("The states sent could not be invalidated. Error %s", rollbackErr)
+		}
+		e.ScheduledStates = nil
+	}
+	return err
+}
+
+func (e *SchedulerExecutor) Invalidate(timestamp time.Time) error {
+	return scheduler.InvalidateStates(timestamp, e.Endpoint + util.ENDPOINT_INVALIDATE_STATES)
+}
+
+func (e *SchedulerExecutor) CurrentState(serviceNames []string) (types.State, error) {
+	return RetrieveCurrentState(e.Endpoint + util.ENDPOINT_CURRENT_STATE)
+}
+
+//Active state of the infrastructure and whether the scheduler is still deploying its last deployed state
+func (e *SchedulerExecutor) InfrastructureState() (types.State, bool, error) {
+	infrastructureState, err := scheduler.InfraState(e.Endpoint + util.ENDPOINT_CURRENT_STATE)
+	if err != nil {
+		return types.State{}, false, err
+	}
+	return toPolicyState(infrastructureState.ActiveState), !infrastructureState.IsStateTrue, nil
+}
+
+//Executor that patches the deployments and node groups of a Kubernetes cluster
+type KubernetesExecutor struct {
+	Component util.Component
+}
+
+func (e *KubernetesExecutor) Schedule(policy types.Policy) error {
+	_, err := TriggerKubernetes(policy, e.Component)
+	return err
+}
+
+//Stop the pending scalings launched from a timestamp on, reporting the scalings that could not be stopped
+//and the scalings launched by their timers that failed
+func (e *KubernetesExecutor) Invalidate(timestamp time.Time) error {
+	stopped, err := InvalidateKubernetesScalings(timestamp)
+	log.Infof("Stopped %d pending scalings of the cluster", stopped)
+	return err
+}
+
+func (e *KubernetesExecutor) CurrentState(serviceNames []string) (types.State, error) {
+	return RetrieveKubernetesState(e.Component, serviceNames)
+}
+
+//Scheduling of a policy in progress. Its lock is held during each attempt, so once it is cancelled no attempt pushes
+//the states of the policy or reports its outcome
+type pendingScheduling struct {
+	sync.Mutex
+	timer     *time.Timer	//Retry waiting for its backoff
+	cancelled bool
+}
+
+//Schedulings in progress, with the policy ID of each one
+var pendingSchedulings = struct {
+	sync.Mutex
+	schedulings map[string]*pendingScheduling
+}{schedulings: make(map[string]*pendingScheduling)}
+
+/* Schedule a policy with an executor, retrying in the background with an exponential backoff. Each executor rolls
+	back the states of a failed attempt, so the policy is either scheduled completely or marked as failed
+	in:
+		@executor Executor
+		@policy types.Policy
+		@component util.Component - retries and backoff of the scheduler component
+		@done func(types.Policy, error) - called once with the scheduling outcome of the policy and the error
+			of the last attempt if every attempt failed, unless the scheduling is cancelled before
+*/
+func Schedule(executor Executor, policy types.Policy, component util.Component, done func(types.Policy, error)) {
+	retries := component.Retries
+	if retries == 0 {
+		retries = util.DEFAULT_SCHEDULING_RETRIES
+	} else if retries < 0 {
+		retries = 0
+	}
+	backoff := component.RetryBackoff
+	if backoff == 0 {
+		backoff = util.DEFAULT_SCHEDULING_RETRY_BACKOFF
+	}
+	policy.Scheduling = types.SchedulingOutcome{}
+	scheduling := &pendingScheduling{}
+	pendingSchedulings.Lock()
+	pendingSchedulings.schedulings[policy.ID.Hex()] = scheduling
+	pendingSchedulings.Unlock()
+	scheduleAttempt(executor, policy, retries, backoff, scheduling, done)
+}
+
+func scheduleAttempt(executor Executor, policy types.Policy, retries int, backoff float64, scheduling *pendingScheduling,
+	done func(types.Policy, error)) {
+	scheduling.Lock()
+	defer scheduling.Unlock()
+	if scheduling.cancelled {
+		return
+	}
+	policy.Scheduling.Attempts++
+	err := executor.Schedule(policy)
+	if err == nil {
+		policy.Scheduling.FinishTime = time.Now()
+		policy.Status = types.SCHEDULED
+		finishScheduling(policy.ID.Hex(), scheduling)
+		done(policy, nil)
+		return
+	}
+	if policy.Scheduling.Attempts > retries {
+		policy.Scheduling.FinishTime = time.Now()
+		policy.Scheduling.Error = err.Error()
+		policy.Status = types.FAILED
+		finishScheduling(policy.ID.Hex(), scheduling)
+		done(policy, err)
+		return
+	}
+	log.Warningf("Scheduling attempt %d failed with error %s", policy.Scheduling.Attempts, err)
+	scheduling.timer = time.AfterFunc(time.Duration(backoff * float64(time.Second)), func() {
+		scheduleAttempt(executor, policy, retries, 2 * backoff, scheduling, done)
+	})
+}
+
+//Remove a scheduling that finished, unless the policy is being scheduled again
+func finishScheduling(policyID string, scheduling *pendingScheduling) {
+	pendingSchedulings.Lock()
+	defer pendingSchedulings.Unlock()
+	if pendingSchedulings.schedulings[policyID] == scheduling {
+		delete(pendingSchedulings.schedulings, policyID)
+	}
+}
+
+/* Cancel the scheduling of a policy in progress. An attempt already running is waited for, then no attempt pushes
+	the states of the policy and the outcome of its scheduling is not reported
+	in:
+		@policyID string
+	out:
+		@bool - true if a scheduling was in progress
+*/
+func CancelScheduling(policyID string) bool {
+	pendingSchedulings.Lock()
+	scheduling, ok := pendingSchedulings.schedulings[policyID]
+	delete(pendingSchedulings.schedulings, policyID)
+	pendingSchedulings.Unlock()
+	if !ok {
+		return false
+	}
+	scheduling.Lock()
+	defer scheduling.Unlock()
+	scheduling.cancelled = true
+	if scheduling.timer != nil {
+		scheduling.timer.Stop()
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package execution
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Fake scheduler that rejects the states after a number of accepted requests
+type fakeScheduler struct {
+	sync.Mutex
+	failingAttempts int	//Attempts whose second state is rejected
+	states          int
+	invalidations   int
+}
+
+func (f *fakeScheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case r.URL.Path == util.ENDPOINT_STATES:
+		f.states++
+		if f.failingAttempts > 0 && f.states % 2 == 0 {
+			f.failingAttempts--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(r.URL.Path, "/api/invalidate/"):
+		f.invalidations++
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+//Schedule a policy and wait for its scheduling outcome
+func scheduleAndWait(executor Executor, policy types.Policy, component util.Component) (types.Policy, error) {
+	type outcome struct {
+		policy types.Policy
+		err    error
+	}
+	outcomes := make(chan outcome, 1)
+	Schedule(executor, policy, component, func(policy types.Policy, err error) {
+		outcomes <- outcome{policy, err}
+	})
+	o := <-outcomes
+	return o.policy, o.err
+}
+
+func TestScheduleWithRetries(t *testing.T) {
+	now := time.Now().UTC()
+	component := util.Component{Retries:2, RetryBackoff:0.001}
+
+	fake := &fakeScheduler{failingAttempts:10}
+	server := httptest.NewServer(fake)
+	component.Endpoint = server.URL
+	policy := timedPolicy(now.Add(time.Hour), now.Add(2 * time.Hour))
+	policy.Status = types.SELECTED
+	policy, err := scheduleAndWait(GetExecutor(component), policy, component)
+	server.Close()
+	if err == nil || policy.Status != types.FAILED || policy.Scheduling.Attempts != 3 || policy.Scheduling.Error == "" {
+		t.Error("Expected the policy to fail after 3 attempts, got: ", policy.Status, policy.Scheduling, err)
+	}
+	if fake.invalidations != 3 {
+		t.Error("Expected the states of each attempt to be invalidated, got: ", fake.invalidations)
+	}
+
+	fake = &fakeScheduler{failingAttempts:1}
+	server = httptest.NewServer(fake)
+	component.Endpoint = server.URL
+	policy = timedPolicy(now.Add(time.Hour), now.Add(2 * time.Hour))
+	policy.Status = types.SELECTED
+	policy, err = scheduleAndWait(GetExecutor(component), policy, component)
+	server.Close()
+	if err != nil || policy.Status != types.SCHEDULED || policy.Scheduling.Attempts != 2 || policy.Scheduling.FinishTime.IsZero() {
+		t.Error("Expected the policy to be scheduled in the second attempt, got: ", policy.Status, policy.Scheduling, err)
+	}
+	if fake.invalidations != 1 || fake.states != 4 {
+		t.Error("Expected one rollback and 4 states sent, got: ", fake.invalidations, fake.states)
+	}
+
+	//No attempt of a cancelled scheduling pushes states or reports its outcome, even if it was running
+	fake = &fakeScheduler{failingAttempts:1000}
+	server = httptest.NewServer(fake)
+	defer server.Close()
+	component = util.Component{Endpoint:server.URL, Retries:1000, RetryBackoff:0.001}
+	policy = timedPolicy(now.Add(time.Hour), now.Add(2 * time.Hour))
+	called := make(chan bool, 1)
+	go Schedule(GetExecutor(component), policy, component, func(types.Policy, error) { called <- true })
+	for !CancelScheduling(policy.ID.Hex()) {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Lock()
+	states := fake.states
+	fake.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	fake.Lock()
+	if fake.states != states || len(called) != 0 {
+		t.Error("Expected no attempt after the cancellation, got states: ", fake.states - states, "outcome reported: ", len(called) != 0)
+	}
+	fake.Unlock()
+}
@@ -0,0 +1,179 @@
+package execution
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"gopkg.in/yaml.v2"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//Path of the file executor that writes the plan to the standard output
+const STDOUT_PATH = "-"
+
+//Timed plan of the states to launch, written by the file executor
+type ExecutionPlan struct {
+	Steps []PlanStep	`json:"steps" yaml:"steps"`
+}
+
+//State launched at a time to start at the expected time
+type PlanStep struct {
+	PolicyID      string                 `json:"policy_id" yaml:"policy_id"`
+	Name          string                 `json:"name" yaml:"name"`
+	LaunchTime    time.Time              `json:"launch_time" yaml:"launch_time"`
+	ExpectedStart time.Time              `json:"expected_start" yaml:"expected_start"`
+	Services      map[string]PlanService `json:"services" yaml:"services"`
+	VMs           types.VMScale          `json:"vms" yaml:"vms"`	//The VM types removed have 0 VMs
+	SpotVMs       types.VMScale          `json:"spot_vms,omitempty" yaml:"spot_vms,omitempty"`	//Spot VMs of each VM type
+}
+
+type PlanService struct {
+	Replicas int    `json:"replicas" yaml:"replicas"`
+	CPU      string `json:"cpu" yaml:"cpu"`
+	Memory   int64  `json:"memory" yaml:"memory"`
+}
+
+//Executor that writes the plan into a JSON or YAML file, or to the standard output, so other tools can execute it
+type FileExecutor struct {
+	Path             string	//JSON file unless its extension is .yml or .yaml
+	CurrentStatePath string	//Current state in the scheduler format, used until a state of the plan is launched
+}
+
+//Write the states of a policy into the plan, replacing the steps launched from its first state on
+func (e *FileExecutor) Schedule(policy types.Policy) error {
+	steps := []PlanStep{}
+	for _,s := range StatesToSchedule(policy) {
+		//The plan carries the spot VMs apart, keyed by their VM type
+		vms, spotVMs := s.VMs.SplitByMarket()
+		if len(spotVMs) == 0 {
+			spotVMs = nil
+		}
+		services := make(map[string]PlanService)
+		for name,service := range s.Services {
+			services[name] = PlanService{Replicas:service.Scale, CPU:service.CPU, Memory:service.Memory}
+		}
+		steps = append(steps, PlanStep{
+			PolicyID:policy.ID.Hex(),
+			Name:s.Name,
+			LaunchTime:s.LaunchTime,
+			ExpectedStart:s.ExpectedStart,
+			Services:services,
+			VMs:vms,
+			SpotVMs:spotVMs,
+		})
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+	plan, err := e.readPlan()
+	if err != nil {
+		return err
+	}
+	plan.Steps = append(stepsBefore(plan.Steps, steps[0].LaunchTime), steps...)
+	return e.writePlan(plan)
+}
+
+//Remove the steps of the plan launched from a timestamp on
+func (e *FileExecutor) Invalidate(timestamp time.Time) error {
+	plan, err := e.readPlan()
+	if err != nil {
+		return err
+	}
+	plan.Steps = stepsBefore(plan.Steps, timestamp)
+	return e.writePlan(plan)
+}
+
+//State of the last step of the plan already launched, or the state of the current state file
+func (e *FileExecutor) CurrentState(serviceNames []string) (types.State, error) {
+	plan, err := e.readPlan()
+	if err != nil {
+		return types.State{}, err
+	}
+	launchedSteps := stepsBefore(plan.Steps, time.Now().Add(time.Nanosecond))
+	if len(launchedSteps) == 0 {
+		if e.CurrentStatePath == "" {
+			return types.State{}, errors.New("No state of the plan launched and no current state file")
+		}
+		return ReadCurrentState(e.CurrentStatePath)
+	}
+	step := launchedSteps[len(launchedSteps)-1]
+	state := types.State{Services:make(types.Service), VMs:make(types.VMScale)}
+	for name,service := range step.Services {
+		state.Services[name] = types.ServiceInfo{
+			Scale:service.Replicas,
+			CPU:stringToCPUCores(service.CPU),
+			Memory:memBytesToGB(service.Memory),
+		}
+	}
+	for vmType,n := range types.JoinByMarket(step.VMs, step.SpotVMs) {
+		if n > 0 {
+			state.VMs[vmType] = n
+		}
+	}
+	return state, nil
+}
+
+//Steps launched before a time
+func stepsBefore(steps []PlanStep, t time.Time) []PlanStep {
+	before := []PlanStep{}
+	for _,s := range steps {
+		if s.LaunchTime.Before(t) {
+			before = append(before, s)
+		}
+	}
+	return before
+}
+
+func (e *FileExecutor) path() string {
+	if e.Path == "" {
+		return util.DEFAULT_PLAN_FILE
+	}
+	return e.Path
+}
+
+func (e *FileExecutor) isYAML() bool {
+	extension := filepath.Ext(e.path())
+	return extension == ".yml" || extension == ".yaml"
+}
+
+//Plan in the file, empty if the file does not exist or the plan is written to the standard output
+func (e *FileExecutor) readPlan() (ExecutionPlan, error) {
+	plan := ExecutionPlan{}
+	if e.path() == STDOUT_PATH {
+		return plan, nil
+	}
+	data, err := ioutil.ReadFile(e.path())
+	if os.IsNotExist(err) {
+		return plan, nil
+	} else if err != nil {
+		return plan, err
+	}
+	if e.isYAML() {
+		err = yaml.Unmarshal(data, &plan)
+	} else {
+		err = json.Unmarshal(data, &plan)
+	}
+	return plan, err
+}
+
+func (e *FileExecutor) writePlan(plan ExecutionPlan) error {
+	var data []byte
+	var err error
+	if e.isYAML() {
+		data, err = yaml.Marshal(plan)
+	} else {
+		data, err = json.MarshalIndent(plan, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if e.path() == STDOUT_PATH {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return ioutil.WriteFile(e.path(), data, 0644)
+}
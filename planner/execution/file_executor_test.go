@@ -0,0 +1,103 @@
+package execution
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func timedPolicy(launchTimes ...time.Time) types.Policy {
+	policy := types.Policy{ID:bson.NewObjectId()}
+	previousVMs := types.VMScale{"t2.large":1}
+	for i,launchTime := range launchTimes {
+		vms := types.VMScale{"t2.micro":i + 1}
+		policy.ScalingActions = append(policy.ScalingActions, types.ScalingAction{
+			InitialState:        types.State{VMs:previousVMs},
+			DesiredState:        types.State{Services:types.Service{"primeapp":{Scale:i + 2, CPU:0.2, Memory:0.5}}, VMs:vms},
+			TimeStartTransition: launchTime,
+			TimeStart:           launchTime.Add(time.Minute),
+		})
+		previousVMs = vms
+	}
+	return policy
+}
+
+func TestFileExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _,file := range []string{"plan.json", "plan.yml"} {
+		executor := GetExecutor(util.Component{Type:util.SCHEDULER_FILE, File:util.FileExecutorConfiguration{Path:filepath.Join(dir, file)}})
+		if _,err := executor.CurrentState(nil); err == nil {
+			t.Error("Expected an error without launched states nor current state file")
+		}
+
+		policy := timedPolicy(now.Add(-2 * time.Hour), now.Add(time.Hour))
+		if err := executor.Schedule(policy); err != nil {
+			t.Fatal(err)
+		}
+		state, err := executor.CurrentState(nil)
+		expected := types.State{Services:types.Service{"primeapp":{Scale:2, CPU:0.2, Memory:0.5}}, VMs:types.VMScale{"t2.micro":1}}
+		if err != nil || !state.Equal(expected) {
+			t.Error("For file: ", file, "expected current state: ", expected, "got: ", state, err)
+		}
+
+		//A new policy replaces the steps launched from its first state on
+		newPolicy := timedPolicy(now.Add(30 * time.Minute))
+		if err := executor.Schedule(newPolicy); err != nil {
+			t.Fatal(err)
+		}
+		plan, err := executor.(*FileExecutor).readPlan()
+		if err != nil || len(plan.Steps) != 2 || plan.Steps[0].PolicyID != policy.ID.Hex() || plan.Steps[1].PolicyID != newPolicy.ID.Hex() {
+			t.Fatal("For file: ", file, "expected the first step of each policy, got: ", plan.Steps, err)
+		}
+		if !plan.Steps[1].LaunchTime.Equal(now.Add(30 * time.Minute)) || plan.Steps[0].VMs["t2.large"] != 0 || plan.Steps[0].Services["primeapp"].CPU != "200m" {
+			t.Error("For file: ", file, "expected the launch time and states of the policies, got: ", plan.Steps)
+		}
+
+		if err := executor.Invalidate(now); err != nil {
+			t.Fatal(err)
+		}
+		plan, _ = executor.(*FileExecutor).readPlan()
+		if len(plan.Steps) != 1 || plan.Steps[0].PolicyID != policy.ID.Hex() {
+			t.Error("For file: ", file, "expected only the launched step, got: ", plan.Steps)
+		}
+	}
+}
+
+func TestGetExecutor(t *testing.T) {
+	if _,ok := GetExecutor(util.Component{}).(*SchedulerExecutor); !ok {
+		t.Error("Expected the SPDT scheduler by default")
+	}
+	if _,ok := GetExecutor(util.Component{Type:util.SCHEDULER_KUBERNETES}).(*KubernetesExecutor); !ok {
+		t.Error("Expected the Kubernetes executor")
+	}
+}
+
+func TestStatesToScheduleSpotVMs(t *testing.T) {
+	policy := types.Policy{ScalingActions:[]types.ScalingAction{{
+		InitialState: types.State{VMs:types.VMScale{"t2.micro":2, "t2.large-spot":1}},
+		DesiredState: types.State{VMs:types.VMScale{"t2.micro":1, types.SpotVMType("t2.micro"):3}},
+	}}}
+	states := StatesToSchedule(policy)
+	vms := states[0].VMs
+	if len(vms) != 3 || vms["t2.micro"] != 1 || vms["t2.micro-spot"] != 3 || vms["t2.large-spot"] != 0 {
+		t.Fatal("Expected the spot VMs with the on-demand VMs keyed with the spot suffix, got: ", vms)
+	}
+	state := toPolicyState(states[0])
+	if state.VMs["t2.micro"] != 1 || state.VMs["t2.micro-spot"] != 3 {
+		t.Error("Expected the spot VMs joined into the VM set, got: ", state.VMs)
+	}
+	if _,ok := policy.ScalingActions[0].DesiredState.VMs["t2.large-spot"]; ok {
+		t.Error("Expected the VM set of the policy unchanged, got: ", policy.ScalingActions[0].DesiredState.VMs)
+	}
+}
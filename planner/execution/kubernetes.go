@@ -0,0 +1,407 @@
+package execution
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/Cloud-Pie/SPDT/rest_clients/kubernetes"
+	"github.com/op/go-logging"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logging.MustGetLogger("spdt")
+
+//Patches of the deployments and node groups of the cluster applied at the start of the transition of a scaling action
+type KubernetesScaling struct {
+	LaunchTime    time.Time
+	ExpectedStart time.Time
+	Deployments   map[string]kubernetes.Deployment        //Patch of the deployment of each service
+	NodeGroups    map[string]kubernetes.MachineDeployment //Patch of the machine deployment of each node group
+}
+
+//Scalings waiting for their launch time, with the launch time of each one, and the errors of the scalings
+//launched by their timers not reported yet
+var pendingKubernetesScalings = struct {
+	sync.Mutex
+	timers   map[*time.Timer]time.Time
+	failures []string
+}{timers: make(map[*time.Timer]time.Time)}
+
+/* Turn the scaling actions of a policy into patches of the deployments of the services
+	and of the node groups sized by the cluster autoscaler
+	in:
+		@policy types.Policy
+		@configuration util.KubernetesConfiguration
+	out:
+		@[]KubernetesScaling - one scaling for each scaling action
+*/
+func KubernetesScalings(policy types.Policy, configuration util.KubernetesConfiguration) []KubernetesScaling {
+	scalings := []KubernetesScaling{}
+	for _, sa := range policy.ScalingActions {
+		deployments := make(map[string]kubernetes.Deployment)
+		for name, s := range sa.DesiredState.Services {
+			resources := map[string]string{
+				"cpu":    cpuQuantity(s.CPU),
+				"memory": strconv.FormatInt(memGBToBytes(s.Memory), 10),
+			}
+			deployment := kubernetes.Deployment{}
+			deployment.Spec.Replicas = s.Scale
+			deployment.Spec.Template.Spec.Containers = []kubernetes.Container{{
+				Name:      name,
+				Resources: kubernetes.ResourceRequirements{Requests: resources, Limits: resources},
+			}}
+			deployments[name] = deployment
+		}
+
+		//The node groups of the VM types removed are scaled to 0
+		sizes := make(map[string]int)
+		initialVMs, initialSpotVMs := sa.InitialState.VMs.SplitByMarket()
+		desiredVMs, desiredSpotVMs := sa.DesiredState.VMs.SplitByMarket()
+		for vmType := range initialVMs {
+			sizes[nodeGroupName(configuration, vmType, false)] += 0
+		}
+		for vmType := range initialSpotVMs {
+			sizes[nodeGroupName(configuration, vmType, true)] += 0
+		}
+		for vmType, n := range desiredVMs {
+			sizes[nodeGroupName(configuration, vmType, false)] += n
+		}
+		for vmType, n := range desiredSpotVMs {
+			sizes[nodeGroupName(configuration, vmType, true)] += n
+		}
+		nodeGroups := make(map[string]kubernetes.MachineDeployment)
+		for name, n := range sizes {
+			size := strconv.Itoa(n)
+			nodeGroup := kubernetes.MachineDeployment{}
+			nodeGroup.Metadata.Annotations = map[string]string{
+				kubernetes.NODE_GROUP_MIN_SIZE: size,
+				kubernetes.NODE_GROUP_MAX_SIZE: size,
+			}
+			nodeGroup.Spec.Replicas = n
+			nodeGroups[name] = nodeGroup
+		}
+
+		scalings = append(scalings, KubernetesScaling{
+			LaunchTime:    sa.TimeStartTransition,
+			ExpectedStart: sa.TimeStart,
+			Deployments:   deployments,
+			NodeGroups:    nodeGroups,
+		})
+	}
+	return scalings
+}
+
+/* Schedule the scalings of a policy in the cluster. The scalings whose launch time already passed are applied
+	immediately, the others wait for their launch time
+	in:
+		@policy types.Policy
+		@component util.Component - scheduler component with the endpoint of the Kubernetes API server
+	out:
+		@[]KubernetesScaling
+		@error - if a scaling applied immediately failed, then the scalings waiting for their launch time are stopped
+*/
+func TriggerKubernetes(policy types.Policy, component util.Component) ([]KubernetesScaling, error) {
+	client := kubernetes.Client{Endpoint: component.Endpoint, Token: component.ApiKey}
+	configuration := kubernetesConfiguration(component.Kubernetes)
+	scalings := KubernetesScalings(policy, configuration)
+	timers := []*time.Timer{}
+	for i, scaling := range scalings {
+		delay := time.Until(scaling.LaunchTime)
+		if delay <= 0 {
+			err := applyKubernetesScaling(client, configuration, scaling)
+			if err != nil {
+				stopKubernetesScalings(timers)
+				rollbackKubernetesScalings(client, configuration, policy.ScalingActions[i].DesiredState, policy.ScalingActions[0].InitialState)
+				return scalings, err
+			}
+			continue
+		}
+		timers = append(timers, scheduleKubernetesScaling(client, configuration, scaling, delay))
+	}
+	return scalings, nil
+}
+
+//Restore the state of the cluster before the scalings of a policy applied immediately
+func rollbackKubernetesScalings(client kubernetes.Client, configuration util.KubernetesConfiguration, appliedState types.State, initialState types.State) {
+	rollback := types.Policy{ScalingActions: []types.ScalingAction{{InitialState: appliedState, DesiredState: initialState}}}
+	err := applyKubernetesScaling(client, configuration, KubernetesScalings(rollback, configuration)[0])
+	if err != nil {
+		log.Errorf("The cluster could not be restored to its initial state. Error %s", err)
+	}
+}
+
+//Stop the scalings of a policy that were not launched yet
+func stopKubernetesScalings(timers []*time.Timer) {
+	pendingKubernetesScalings.Lock()
+	defer pendingKubernetesScalings.Unlock()
+	for _, timer := range timers {
+		if timer.Stop() {
+			delete(pendingKubernetesScalings.timers, timer)
+		}
+	}
+}
+
+//Apply a scaling at its launch time, keeping its error until the scalings are invalidated
+func scheduleKubernetesScaling(client kubernetes.Client, configuration util.KubernetesConfiguration, scaling KubernetesScaling, delay time.Duration) *time.Timer {
+	pendingKubernetesScalings.Lock()
+	defer pendingKubernetesScalings.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		err := applyKubernetesScaling(client, configuration, scaling)
+		pendingKubernetesScalings.Lock()
+		defer pendingKubernetesScalings.Unlock()
+		delete(pendingKubernetesScalings.timers, timer)
+		if err != nil {
+			log.Errorf("The scaling launched at %s failed with error %s", scaling.LaunchTime, err)
+			pendingKubernetesScalings.failures = append(pendingKubernetesScalings.failures,
+				"the scaling launched at " + scaling.LaunchTime.Format(util.UTC_TIME_LAYOUT) + " failed with error " + err.Error())
+		}
+	})
+	pendingKubernetesScalings.timers[timer] = scaling.LaunchTime
+	return timer
+}
+
+/* Patch the node groups that grow first, so the nodes for new replicas are requested before the replicas,
+	then the deployments and at last the node groups that shrink, so their replicas are removed before their nodes
+	in:
+		@client kubernetes.Client
+		@configuration util.KubernetesConfiguration
+		@scaling KubernetesScaling
+	out:
+		@error
+*/
+func applyKubernetesScaling(client kubernetes.Client, configuration util.KubernetesConfiguration, scaling KubernetesScaling) error {
+	nodeGroups, err := client.MachineDeployments(configuration.NodeGroupsNamespace)
+	if err != nil {
+		return err
+	}
+	currentSizes := make(map[string]int)
+	for _, nodeGroup := range nodeGroups {
+		currentSizes[nodeGroup.Metadata.Name] = nodeGroup.Spec.Replicas
+	}
+	growingNodeGroups := []string{}
+	shrinkingNodeGroups := []string{}
+	for name, nodeGroup := range scaling.NodeGroups {
+		if nodeGroup.Spec.Replicas < currentSizes[name] {
+			shrinkingNodeGroups = append(shrinkingNodeGroups, name)
+		} else {
+			growingNodeGroups = append(growingNodeGroups, name)
+		}
+	}
+	sort.Strings(growingNodeGroups)
+	sort.Strings(shrinkingNodeGroups)
+	for _, name := range growingNodeGroups {
+		err = client.PatchMachineDeployment(configuration.NodeGroupsNamespace, name, scaling.NodeGroups[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	deploymentNames := []string{}
+	for name := range scaling.Deployments {
+		deploymentNames = append(deploymentNames, name)
+	}
+	sort.Strings(deploymentNames)
+	for _, name := range deploymentNames {
+		patch, err := deploymentPatch(client, configuration, name, scaling.Deployments[name])
+		if err != nil {
+			return err
+		}
+		err = client.PatchDeployment(configuration.Namespace, name, patch)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range shrinkingNodeGroups {
+		err = client.PatchMachineDeployment(configuration.NodeGroupsNamespace, name, scaling.NodeGroups[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Patch of a deployment addressed to the container of the service in the deployment of the cluster
+func deploymentPatch(client kubernetes.Client, configuration util.KubernetesConfiguration, serviceName string,
+	patch kubernetes.Deployment) (kubernetes.Deployment, error) {
+	deployment, err := client.GetDeployment(configuration.Namespace, serviceName)
+	if err != nil {
+		return patch, err
+	}
+	container, ok := serviceContainer(configuration, serviceName, deployment)
+	if !ok {
+		return patch, errors.New("The deployment " + serviceName + " has no container for the service")
+	}
+	containers := []kubernetes.Container{}
+	for _, c := range patch.Spec.Template.Spec.Containers {
+		c.Name = container.Name
+		containers = append(containers, c)
+	}
+	patch.Spec.Template.Spec.Containers = containers
+	return patch, nil
+}
+
+//Container of a service in its deployment: the one configured, the one named as the service or the only one
+func serviceContainer(configuration util.KubernetesConfiguration, serviceName string, deployment kubernetes.Deployment) (kubernetes.Container, bool) {
+	containers := deployment.Spec.Template.Spec.Containers
+	name, configured := configuration.Containers[serviceName]
+	if !configured {
+		name = serviceName
+	}
+	for _, c := range containers {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	if !configured && len(containers) == 1 {
+		return containers[0], true
+	}
+	return kubernetes.Container{}, false
+}
+
+/* Stop the scalings that were not launched yet and whose launch time is not before a timestamp
+	in:
+		@timestamp time.Time
+	out:
+		@int - number of scalings stopped
+		@error - scalings being applied that could not be stopped and scalings launched by their timers that failed
+*/
+func InvalidateKubernetesScalings(timestamp time.Time) (int, error) {
+	pendingKubernetesScalings.Lock()
+	defer pendingKubernetesScalings.Unlock()
+	stopped := 0
+	failures := pendingKubernetesScalings.failures
+	pendingKubernetesScalings.failures = nil
+	for timer, launchTime := range pendingKubernetesScalings.timers {
+		if launchTime.Before(timestamp) {
+			continue
+		}
+		if timer.Stop() {
+			delete(pendingKubernetesScalings.timers, timer)
+			stopped++
+		} else {
+			failures = append(failures, "the scaling launched at " + launchTime.Format(util.UTC_TIME_LAYOUT) + " is being applied")
+		}
+	}
+	if len(failures) > 0 {
+		return stopped, errors.New("Scalings of the cluster not invalidated: " + strings.Join(failures, "; "))
+	}
+	return stopped, nil
+}
+
+/* Read the current state from the deployments of the services and the node groups of the cluster
+	in:
+		@component util.Component - scheduler component with the endpoint of the Kubernetes API server
+		@serviceNames []string
+	out:
+		@types.State
+		@error
+*/
+func RetrieveKubernetesState(component util.Component, serviceNames []string) (types.State, error) {
+	client := kubernetes.Client{Endpoint: component.Endpoint, Token: component.ApiKey}
+	configuration := kubernetesConfiguration(component.Kubernetes)
+	state := types.State{Services: make(types.Service), VMs: make(types.VMScale)}
+
+	for _, name := range serviceNames {
+		deployment, err := client.GetDeployment(configuration.Namespace, name)
+		if err != nil {
+			return state, err
+		}
+		service := types.ServiceInfo{Scale: deployment.Spec.Replicas}
+		if c, ok := serviceContainer(configuration, name, deployment); ok {
+			service.CPU = cpuCores(c.Resources.Requests["cpu"])
+			service.Memory = memoryGB(c.Resources.Requests["memory"])
+		}
+		state.Services[name] = service
+	}
+
+	nodeGroups, err := client.MachineDeployments(configuration.NodeGroupsNamespace)
+	if err != nil {
+		return state, err
+	}
+	//Key of the VMs of each node group in the VM set, the spot VMs with the spot suffix
+	vmTypes := make(map[string]string)
+	for vmType, name := range configuration.NodeGroups {
+		vmTypes[name] = vmType
+	}
+	for vmType, name := range configuration.SpotNodeGroups {
+		vmTypes[name] = types.SpotVMType(vmType)
+	}
+	for _, nodeGroup := range nodeGroups {
+		vmType, ok := vmTypes[nodeGroup.Metadata.Name]
+		if !ok && len(configuration.NodeGroups) > 0 {
+			continue
+		} else if !ok {
+			vmType = nodeGroup.Metadata.Name
+		}
+		if nodeGroup.Spec.Replicas > 0 {
+			state.VMs[vmType] += nodeGroup.Spec.Replicas
+		}
+	}
+	return state, nil
+}
+
+//Kubernetes configuration with the default namespaces
+func kubernetesConfiguration(configuration util.KubernetesConfiguration) util.KubernetesConfiguration {
+	if configuration.Namespace == "" {
+		configuration.Namespace = util.DEFAULT_KUBERNETES_NAMESPACE
+	}
+	if configuration.NodeGroupsNamespace == "" {
+		configuration.NodeGroupsNamespace = configuration.Namespace
+	}
+	return configuration
+}
+
+//Machine deployment of the on-demand or the spot VMs of a VM type
+func nodeGroupName(configuration util.KubernetesConfiguration, vmType string, spot bool) string {
+	if spot {
+		if name, ok := configuration.SpotNodeGroups[vmType]; ok {
+			return name
+		}
+		return types.SpotVMType(vmType)
+	}
+	if name, ok := configuration.NodeGroups[vmType]; ok {
+		return name
+	}
+	return vmType
+}
+
+//CPU cores as Kubernetes quantity in millicores
+func cpuQuantity(cores float64) string {
+	return strconv.FormatInt(int64(math.Round(cores * 1000)), 10) + "m"
+}
+
+//CPU cores of a Kubernetes quantity, e.g. 200m or 1.5
+func cpuCores(quantity string) float64 {
+	if strings.HasSuffix(quantity, "m") {
+		millicores, _ := strconv.ParseFloat(strings.TrimSuffix(quantity, "m"), 64)
+		return millicores / 1000.0
+	}
+	cores, _ := strconv.ParseFloat(quantity, 64)
+	return cores
+}
+
+//Memory in GB of a Kubernetes quantity, e.g. 512Mi, 1G or bytes
+func memoryGB(quantity string) float64 {
+	multipliers := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+		{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	}
+	for _, m := range multipliers {
+		if strings.HasSuffix(quantity, m.suffix) {
+			value, _ := strconv.ParseFloat(strings.TrimSuffix(quantity, m.suffix), 64)
+			return value * m.multiplier / 1e9
+		}
+	}
+	bytes, _ := strconv.ParseFloat(quantity, 64)
+	return bytes / 1e9
+}
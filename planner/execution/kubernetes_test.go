@@ -0,0 +1,235 @@
+package execution
+
+import (
+	"github.com/Cloud-Pie/SPDT/rest_clients/kubernetes"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Fake API server that patches its deployments and machine deployments with the merge semantics of Kubernetes
+type fakeAPIServer struct {
+	sync.Mutex
+	deployments map[string]kubernetes.Deployment
+	nodeGroups  map[string]kubernetes.MachineDeployment
+	patches     []string
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	resource := parts[5]
+	name := ""
+	if len(parts) > 6 {
+		name = parts[6]
+	}
+	switch {
+	case r.Method == http.MethodPatch && resource == "deployments" && r.Header.Get("Content-Type") == kubernetes.STRATEGIC_MERGE_PATCH:
+		var patch kubernetes.Deployment
+		json.NewDecoder(r.Body).Decode(&patch)
+		deployment, ok := f.deployments[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		deployment.Spec.Replicas = patch.Spec.Replicas
+		//The containers are merged by name, a container not found is added
+		for _, patchContainer := range patch.Spec.Template.Spec.Containers {
+			merged := false
+			for i, c := range deployment.Spec.Template.Spec.Containers {
+				if c.Name == patchContainer.Name {
+					c.Resources.Requests = mergeMaps(c.Resources.Requests, patchContainer.Resources.Requests)
+					c.Resources.Limits = mergeMaps(c.Resources.Limits, patchContainer.Resources.Limits)
+					deployment.Spec.Template.Spec.Containers[i] = c
+					merged = true
+				}
+			}
+			if !merged {
+				deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, patchContainer)
+			}
+		}
+		f.deployments[name] = deployment
+		f.patches = append(f.patches, "deployments/" + name)
+	case r.Method == http.MethodPatch && resource == "machinedeployments" && r.Header.Get("Content-Type") == kubernetes.MERGE_PATCH:
+		var patch kubernetes.MachineDeployment
+		json.NewDecoder(r.Body).Decode(&patch)
+		nodeGroup, ok := f.nodeGroups[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		nodeGroup.Metadata.Annotations = mergeMaps(nodeGroup.Metadata.Annotations, patch.Metadata.Annotations)
+		nodeGroup.Spec.Replicas = patch.Spec.Replicas
+		f.nodeGroups[name] = nodeGroup
+		f.patches = append(f.patches, "machinedeployments/" + name)
+	case r.Method == http.MethodGet && resource == "deployments":
+		deployment, ok := f.deployments[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(deployment)
+	case r.Method == http.MethodGet && resource == "machinedeployments":
+		list := kubernetes.MachineDeploymentList{}
+		for _, nodeGroup := range f.nodeGroups {
+			list.Items = append(list.Items, nodeGroup)
+		}
+		json.NewEncoder(w).Encode(list)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//Keys of the patch added to the values of the object
+func mergeMaps(values map[string]string, patch map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for k, v := range values {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		merged[k] = v
+	}
+	return merged
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	apiServer := &fakeAPIServer{deployments: make(map[string]kubernetes.Deployment), nodeGroups: make(map[string]kubernetes.MachineDeployment)}
+	deployment := kubernetes.Deployment{}
+	deployment.Metadata.Name = "primeapp"
+	deployment.Spec.Replicas = 1
+	deployment.Spec.Template.Spec.Containers = []kubernetes.Container{
+		{Name: "primeapp-server", Resources: kubernetes.ResourceRequirements{Requests: map[string]string{"cpu": "100m", "ephemeral-storage": "1Gi"}}},
+		{Name: "proxy"},
+	}
+	apiServer.deployments["primeapp"] = deployment
+	for name, replicas := range map[string]int{"micro": 0, "large": 1} {
+		nodeGroup := kubernetes.MachineDeployment{}
+		nodeGroup.Metadata.Name = name
+		nodeGroup.Metadata.Annotations = map[string]string{"owner": "ops"}
+		nodeGroup.Spec.Replicas = replicas
+		apiServer.nodeGroups[name] = nodeGroup
+	}
+	return apiServer
+}
+
+func TestKubernetesScheduling(t *testing.T) {
+	apiServer := newFakeAPIServer()
+	server := httptest.NewServer(apiServer)
+	defer server.Close()
+	component := util.Component{
+		Endpoint:   server.URL,
+		Type:       util.SCHEDULER_KUBERNETES,
+		Kubernetes: util.KubernetesConfiguration{
+			NodeGroups: map[string]string{"t2.micro": "micro", "t2.large": "large"},
+			Containers: map[string]string{"primeapp": "primeapp-server"},
+		},
+	}
+
+	now := time.Now()
+	services := types.Service{"primeapp": {Scale: 3, CPU: 0.2, Memory: 0.5}}
+	policy := types.Policy{ScalingActions: []types.ScalingAction{
+		{
+			InitialState:        types.State{VMs: types.VMScale{"t2.large": 1}},
+			DesiredState:        types.State{Services: services, VMs: types.VMScale{"t2.micro": 2}},
+			TimeStartTransition: now.Add(-time.Minute),
+			TimeStart:           now,
+		},
+		{
+			InitialState:        types.State{Services: services, VMs: types.VMScale{"t2.micro": 2}},
+			DesiredState:        types.State{Services: types.Service{"primeapp": {Scale: 6, CPU: 0.2, Memory: 0.5}}, VMs: types.VMScale{"t2.micro": 4}},
+			TimeStartTransition: now.Add(time.Hour),
+			TimeStart:           now.Add(time.Hour + time.Minute),
+		},
+	}}
+
+	scalings, err := TriggerKubernetes(policy, component)
+	if err != nil || len(scalings) != 2 {
+		t.Fatal("Expected two scalings, got: ", len(scalings), err)
+	}
+	//The node group released is shrunk after the deployment
+	expectedPatches := []string{"machinedeployments/micro", "deployments/primeapp", "machinedeployments/large"}
+	if strings.Join(apiServer.patches, ",") != strings.Join(expectedPatches, ",") {
+		t.Error("Expected patches of the first scaling: ", expectedPatches, "got: ", apiServer.patches)
+	}
+	if micro := apiServer.nodeGroups["micro"]; micro.Spec.Replicas != 2 || micro.Metadata.Annotations[kubernetes.NODE_GROUP_MIN_SIZE] != "2" {
+		t.Error("Expected node group micro with 2 nodes, got: ", micro)
+	}
+	if large := apiServer.nodeGroups["large"]; large.Spec.Replicas != 0 || large.Metadata.Annotations[kubernetes.NODE_GROUP_MAX_SIZE] != "0" ||
+		large.Metadata.Annotations["owner"] != "ops" {
+		t.Error("Expected node group large scaled to 0, got: ", large)
+	}
+	containers := apiServer.deployments["primeapp"].Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Resources.Requests["cpu"] != "200m" || containers[0].Resources.Limits["memory"] != "500000000" ||
+		containers[0].Resources.Requests["ephemeral-storage"] != "1Gi" {
+		t.Error("Expected resources 200m and 500000000 in the container primeapp-server, got: ", containers)
+	}
+
+	state, err := CurrentState(util.SystemConfiguration{MainServiceName: "primeapp", SchedulerComponent: component})
+	if err != nil || !state.Equal(policy.ScalingActions[0].DesiredState) {
+		t.Error("Expected current state: ", policy.ScalingActions[0].DesiredState, "got: ", state, err)
+	}
+
+	if stopped, err := InvalidateKubernetesScalings(now); stopped != 1 || err != nil {
+		t.Error("Expected the pending scaling to be stopped, got: ", stopped, err)
+	}
+
+	//The failure of a scaling launched by its timer is reported when the scalings are invalidated
+	failingPolicy := types.Policy{ScalingActions: []types.ScalingAction{{
+		InitialState:        policy.ScalingActions[0].DesiredState,
+		DesiredState:        types.State{Services: types.Service{"unknownapp": {Scale: 1}}, VMs: types.VMScale{"t2.micro": 2}},
+		TimeStartTransition: time.Now().Add(10 * time.Millisecond),
+	}}}
+	if _, err = TriggerKubernetes(failingPolicy, component); err != nil {
+		t.Fatal("Expected the scaling to wait for its launch time, got: ", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, err := InvalidateKubernetesScalings(now); err == nil {
+		t.Error("Expected the failure of the scaling launched by its timer")
+	}
+	if _, err := InvalidateKubernetesScalings(now); err != nil {
+		t.Error("Expected the failure to be reported once, got: ", err)
+	}
+}
+
+func TestKubernetesQuantities(t *testing.T) {
+	cpu := map[string]float64{"200m": 0.2, "1.5": 1.5, "2": 2}
+	for quantity, cores := range cpu {
+		if c := cpuCores(quantity); c != cores {
+			t.Error("For quantity: ", quantity, "expected: ", cores, "got: ", c)
+		}
+	}
+	memory := map[string]float64{"500000000": 0.5, "512Mi": 0.536870912, "2G": 2}
+	for quantity, gb := range memory {
+		if m := memoryGB(quantity); m != gb {
+			t.Error("For quantity: ", quantity, "expected: ", gb, "got: ", m)
+		}
+	}
+	if q := cpuQuantity(0.25); q != "250m" {
+		t.Error("Expected: ", "250m", "got: ", q)
+	}
+}
+
+func TestKubernetesSpotNodeGroups(t *testing.T) {
+	configuration := util.KubernetesConfiguration{
+		NodeGroups:     map[string]string{"t2.micro": "micro"},
+		SpotNodeGroups: map[string]string{"t2.micro": "micro-spot-pool"},
+	}
+	policy := types.Policy{ScalingActions: []types.ScalingAction{{
+		InitialState: types.State{VMs: types.VMScale{"t2.large-spot": 1}},
+		DesiredState: types.State{VMs: types.VMScale{"t2.micro": 1, "t2.micro-spot": 2}},
+	}}}
+	nodeGroups := KubernetesScalings(policy, configuration)[0].NodeGroups
+	if len(nodeGroups) != 3 || nodeGroups["micro"].Spec.Replicas != 1 || nodeGroups["micro-spot-pool"].Spec.Replicas != 2 {
+		t.Error("Expected the spot VMs in the spot node group of their type, got: ", nodeGroups)
+	}
+	if large, ok := nodeGroups["t2.large-spot"]; !ok || large.Spec.Replicas != 0 {
+		t.Error("Expected the default spot node group of t2.large scaled to 0, got: ", nodeGroups)
+	}
+}
@@ -5,9 +5,25 @@ import (
 	"github.com/Cloud-Pie/SPDT/rest_clients/scheduler"
 	"strconv"
 	"strings"
+	"io/ioutil"
+	"encoding/json"
+	"github.com/Cloud-Pie/SPDT/util"
 )
 
 func TriggerScheduler(policy types.Policy, endpoint string)([] scheduler.StateToSchedule,error) {
+	var statesToSchedule  []scheduler.StateToSchedule
+	for _, stateToSchedule := range StatesToSchedule(policy) {
+		statesToSchedule = append(statesToSchedule, stateToSchedule)
+		err := scheduler.CreateState(stateToSchedule, endpoint)
+		if err != nil {
+			return statesToSchedule,err
+		}
+	}
+	return statesToSchedule,nil
+}
+
+//States in the scheduler format for the scaling actions of a policy
+func StatesToSchedule(policy types.Policy) []scheduler.StateToSchedule {
 	var statesToSchedule  []scheduler.StateToSchedule
 	for _, conf := range policy.ScalingActions {
 		mapServicesToSchedule := make(map[string]scheduler.ServiceToSchedule)
@@ -23,7 +39,13 @@ func TriggerScheduler(policy types.Policy, endpoint string)([] scheduler.StateTo
 				Memory:memory,
 			}
 		}
-		vms := addRemovedKeys(conf.InitialState.VMs, conf.DesiredState.VMs)
+		//The spot VMs are sent with the on-demand VMs, keyed by their VM type with the spot suffix.
+		//The VM set of the policy is copied since the keys of the VM types removed are added
+		desiredVMs := make(types.VMScale)
+		for k,v := range conf.DesiredState.VMs {
+			desiredVMs[k] = v
+		}
+		vms := addRemovedKeys(conf.InitialState.VMs, desiredVMs)
 		stateToSchedule := scheduler.StateToSchedule{
 			LaunchTime:conf.TimeStartTransition,
 			Services:mapServicesToSchedule,
@@ -32,13 +54,8 @@ func TriggerScheduler(policy types.Policy, endpoint string)([] scheduler.StateTo
 			ExpectedStart:conf.TimeStart,
 		}
 		statesToSchedule = append(statesToSchedule, stateToSchedule)
-
-		err := scheduler.CreateState(stateToSchedule, endpoint)
-		if err != nil {
-			return statesToSchedule,err
-		}
 	}
-	return statesToSchedule,nil
+	return statesToSchedule
 }
 
 func CPUToString(value float64) string {
@@ -70,9 +87,32 @@ func stringToCPUCores(value string) float64 {
 	return cpu
 }
 
+//Current state of the infrastructure, read from the backend of the scheduler component
+func CurrentState(sysConfiguration util.SystemConfiguration) (types.State, error) {
+	return GetExecutor(sysConfiguration.SchedulerComponent).CurrentState(sysConfiguration.ServiceNames())
+}
+
 func RetrieveCurrentState(endpoint string ) (types.State, error) {
-	var policyState types.State
 	stateScheduled, _ := scheduler.InfraCurrentState(endpoint)
+	return toPolicyState(stateScheduled),nil
+}
+
+//Read the current state from a file with the same format returned by the scheduler
+func ReadCurrentState(path string) (types.State, error) {
+	var infrastructureState scheduler.InfrastructureState
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return types.State{}, err
+	}
+	err = json.Unmarshal(data, &infrastructureState)
+	if err != nil {
+		return types.State{}, err
+	}
+	return toPolicyState(infrastructureState.ActiveState),nil
+}
+
+//Convert a state in the scheduler format into the state used by the policies
+func toPolicyState(stateScheduled scheduler.StateToSchedule) types.State {
 	mapServicesScheduled := stateScheduled.Services
 	policyServices := make(map[string]types.ServiceInfo)
 
@@ -87,11 +127,10 @@ func RetrieveCurrentState(endpoint string ) (types.State, error) {
 		}
 	}
 
-	policyState = types.State {
+	return types.State {
 		VMs:stateScheduled.VMs,
 		Services:policyServices,
 	}
-	return policyState,nil
 }
 
 //Note: Adjustment of keys required for PASSA
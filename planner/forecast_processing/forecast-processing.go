@@ -4,12 +4,25 @@ import (
 	"github.com/Cloud-Pie/SPDT/types"
 	"github.com/Cloud-Pie/SPDT/util"
 	"time"
+	"math"
+	"sort"
+	"github.com/op/go-logging"
 )
 
-func ScalingIntervals(forecast types.Forecast, granularity string) (types.ProcessedForecast) {
+var log = logging.MustGetLogger("spdt")
+
+/* Split the forecast into the intervals for which a scaling decision is taken
+	in:
+		@forecast types.Forecast
+		@quantile string - quantile of the forecast used to size the intervals: mean, p90 or upper bound
+		@forecastComponent util.ForecastComponent - granularity, confidence of the bounds and extraction of the intervals
+	out:
+		@types.ProcessedForecast
+*/
+func ScalingIntervals(forecast types.Forecast, quantile string, forecastComponent util.ForecastComponent) (types.ProcessedForecast) {
 	var factor float64
 
-	switch granularity {
+	switch forecastComponent.Granularity {
 		case util.HOUR:
 			factor = 3600
 		case util.MINUTE:
@@ -19,11 +32,13 @@ func ScalingIntervals(forecast types.Forecast, granularity string) (types.Proces
 		default:
 			factor = 3600
 	}
+	forecast = sizedForecast(forecast, quantile, forecastComponent.BoundsConfidence)
+	settings := intervalSettings(forecastComponent.Intervals)
+	values := forecast.ForecastedValues
 
+	//The first interval is the state at the beginning of the window
 	intervals := []types.CriticalInterval{}
-	i:= 0
-	lenValues := len(forecast.ForecastedValues)
-	value := forecast.ForecastedValues[0]
+	value := values[0]
 	interval := types.CriticalInterval{
 		Requests: value.Requests / factor,
 		TimeStart:value.TimeStamp,
@@ -31,32 +46,21 @@ func ScalingIntervals(forecast types.Forecast, granularity string) (types.Proces
 	}
 	intervals = append(intervals, interval)
 
-	for i <= lenValues - 2  {
-		value := forecast.ForecastedValues[i]
-		startTimestamp := value.TimeStamp
-		highestPeak := value.Requests
-		var nextValue types.ForecastedValue
-		var endTimestamp time.Time
-
-		for {
-
-			nextValue = forecast.ForecastedValues[i+1]
-			withinCoolDownTime := nextValue.TimeStamp.Sub(startTimestamp).Seconds() < 300
-
-			endTimestamp = forecast.ForecastedValues[i+1].TimeStamp
-			if withinCoolDownTime {
-				highestPeak = (highestPeak + forecast.ForecastedValues[i+1].Requests)/2
-			}
-			i+=1
-			if nextValue.TimeStamp.Sub(startTimestamp).Seconds() >= 300 {
-				break
-			}
-		}
+	var segments []segment
+	if settings.Strategy == util.INTERVALS_POI {
+		segments = poiSegments(values, PoIs(requests(values)))
+	} else {
+		segments = windowingSegments(values, settings.Cooldown)
+	}
+	segments = mergeShortSegments(segments, values, settings)
 
+	for _,sg := range segments {
+		requests, peak := sg.aggregate(values, settings)
 		interval := types.CriticalInterval{
-			Requests:  highestPeak/factor,
-			TimeStart: startTimestamp,
-			TimeEnd:   endTimestamp,
+			Requests:  requests/factor,
+			TimeStart: timeAt(values, sg.from),
+			TimeEnd:   timeAt(values, sg.to),
+			TimePeak:  peak,
 		}
 		intervals = append(intervals, interval)
 	}
@@ -65,3 +69,204 @@ func ScalingIntervals(forecast types.Forecast, granularity string) (types.Proces
 	return  processedForecast
 }
 
+//Settings to extract the intervals with their default values
+func intervalSettings(settings util.IntervalSettings) util.IntervalSettings {
+	if settings.Strategy != util.INTERVALS_POI {
+		settings.Strategy = util.INTERVALS_WINDOWING
+	}
+	if settings.Cooldown <= 0 {
+		settings.Cooldown = util.DEFAULT_INTERVALS_COOLDOWN
+	}
+	if settings.Aggregation != util.AGGREGATION_MEAN && settings.Aggregation != util.AGGREGATION_PERCENTILE {
+		settings.Aggregation = util.AGGREGATION_MAX
+	}
+	if settings.Percentile <= 0 || settings.Percentile > 100 {
+		settings.Percentile = util.DEFAULT_AGGREGATION_PERCENTILE
+	}
+	return settings
+}
+
+//Part of the forecast between two positions, the positions can fall between two values
+type segment struct {
+	from float64
+	to   float64
+}
+
+//Indexes of the values that the segment covers, from its start until before its end
+func (sg segment) indexes(numberValues int) (int, int) {
+	first := int(math.Floor(sg.from))
+	last := int(math.Ceil(sg.to)) - 1
+	if last < first {
+		last = first
+	}
+	if last > numberValues - 1 {
+		last = numberValues - 1
+	}
+	return first, last
+}
+
+func (sg segment) duration(values []types.ForecastedValue) float64 {
+	return timeAt(values, sg.to).Sub(timeAt(values, sg.from)).Seconds()
+}
+
+/* Requests that represent the values of a segment according to the aggregation function
+	in:
+		@values []types.ForecastedValue
+		@settings util.IntervalSettings
+	out:
+		@float64 - requests
+		@time.Time - time of the highest value
+*/
+func (sg segment) aggregate(values []types.ForecastedValue, settings util.IntervalSettings) (float64, time.Time) {
+	first, last := sg.indexes(len(values))
+	covered := requests(values[first:last+1])
+	peak := first
+	for i := first; i <= last; i++ {
+		if values[i].Requests > values[peak].Requests {
+			peak = i
+		}
+	}
+	switch settings.Aggregation {
+	case util.AGGREGATION_MEAN:
+		total := 0.0
+		for _,r := range covered {
+			total += r
+		}
+		return total / float64(len(covered)), values[peak].TimeStamp
+	case util.AGGREGATION_PERCENTILE:
+		return percentile(covered, settings.Percentile), values[peak].TimeStamp
+	}
+	return values[peak].Requests, values[peak].TimeStamp
+}
+
+/* Group the values in windows, a new window starts once the cooldown time passed since the start of the previous one
+	in:
+		@values []types.ForecastedValue
+		@cooldown float64 - seconds
+	out:
+		@[]segment
+*/
+func windowingSegments(values []types.ForecastedValue, cooldown float64) []segment {
+	segments := []segment{}
+	i := 0
+	lenValues := len(values)
+	for i <= lenValues - 2 {
+		startTimestamp := values[i].TimeStamp
+		j := i + 1
+		for j < lenValues - 1 && values[j].TimeStamp.Sub(startTimestamp).Seconds() < cooldown {
+			j++
+		}
+		segments = append(segments, segment{from:float64(i), to:float64(j)})
+		i = j
+	}
+	return segments
+}
+
+/* Merge the segments that start before the cooldown time of the previous one or are shorter than the minimum length
+	in:
+		@segments []segment
+		@values []types.ForecastedValue
+		@settings util.IntervalSettings
+	out:
+		@[]segment
+*/
+func mergeShortSegments(segments []segment, values []types.ForecastedValue, settings util.IntervalSettings) []segment {
+	merged := []segment{}
+	for _,sg := range segments {
+		n := len(merged)
+		if n > 0 && (merged[n-1].duration(values) < settings.Cooldown || merged[n-1].duration(values) < settings.MinLength) {
+			merged[n-1].to = sg.to
+		} else {
+			merged = append(merged, sg)
+		}
+	}
+	//The last segment joins the previous one if it is too short
+	n := len(merged)
+	if n > 1 && merged[n-1].duration(values) < settings.MinLength {
+		merged[n-2].to = merged[n-1].to
+		merged = merged[:n-1]
+	}
+	return merged
+}
+
+//Time of a position of the forecast, interpolated between two values
+func timeAt(values []types.ForecastedValue, position float64) time.Time {
+	i := int(math.Floor(position))
+	if i >= len(values) - 1 {
+		return values[len(values)-1].TimeStamp
+	}
+	delta := values[i+1].TimeStamp.Sub(values[i].TimeStamp).Seconds() * (position - float64(i))
+	return values[i].TimeStamp.Add(time.Duration(math.Round(delta)) * time.Second)
+}
+
+func requests(values []types.ForecastedValue) []float64 {
+	r := make([]float64, len(values))
+	for i,v := range values {
+		r[i] = v.Requests
+	}
+	return r
+}
+
+//Percentile of a list of values with linear interpolation
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	position := p / 100 * float64(len(sorted) - 1)
+	i := int(math.Floor(position))
+	if i >= len(sorted) - 1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1] - sorted[i]) * (position - float64(i))
+}
+
+//Forecast whose requests are the quantile of each forecasted value
+func sizedForecast(forecast types.Forecast, quantile string, boundsConfidence float64) types.Forecast {
+	values := make([]types.ForecastedValue, len(forecast.ForecastedValues))
+	for i,v := range forecast.ForecastedValues {
+		values[i] = v
+		values[i].Requests = RequestsAtQuantile(v, quantile, boundsConfidence)
+	}
+	forecast.ForecastedValues = values
+	return forecast
+}
+
+/* Requests of a forecasted value at a quantile. The bounds are taken as a prediction interval of a normal
+	distribution around the mean, values without upper bound are sized at the mean
+	in:
+		@value types.ForecastedValue
+		@quantile string - mean, p90 or upper bound
+		@boundsConfidence float64 - confidence level in percentage of the prediction interval
+	out:
+		@float64
+*/
+func RequestsAtQuantile(value types.ForecastedValue, quantile string, boundsConfidence float64) float64 {
+	if value.UpperBound <= value.Requests {
+		return value.Requests
+	}
+	switch quantile {
+	case util.QUANTILE_UPPER_BOUND:
+		return value.UpperBound
+	case util.QUANTILE_P90:
+		if boundsConfidence <= 0 || boundsConfidence >= 100 {
+			boundsConfidence = util.DEFAULT_BOUNDS_CONFIDENCE
+		}
+		//Standard deviation from the half width of the two-sided interval
+		zBounds := math.Sqrt2 * math.Erfinv(boundsConfidence / 100)
+		zP90 := math.Sqrt2 * math.Erfinv(2 * 0.9 - 1)
+		return value.Requests + (value.UpperBound - value.Requests) * zP90 / zBounds
+	}
+	return value.Requests
+}
+
+//Quantile used to size the scaling intervals, the mean if it is not supported
+func SizingQuantile(quantile string) string {
+	switch quantile {
+	case util.QUANTILE_P90, util.QUANTILE_UPPER_BOUND:
+		return quantile
+	case "", util.QUANTILE_MEAN:
+	default:
+		log.Warningf("Sizing quantile %s not supported, %s is used instead", quantile, util.QUANTILE_MEAN)
+	}
+	return util.QUANTILE_MEAN
+}
+
@@ -0,0 +1,106 @@
+package forecast_processing
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRequestsAtQuantile(t *testing.T) {
+	value := types.ForecastedValue{Requests:1000, UpperBound:1195.996, LowerBound:804.004}
+	expected := map[string]float64{
+		util.QUANTILE_MEAN:        1000,
+		util.QUANTILE_P90:         1128.155,
+		util.QUANTILE_UPPER_BOUND: 1195.996,
+	}
+	for quantile, requests := range expected {
+		if r := RequestsAtQuantile(value, quantile, 95); math.Abs(r - requests) > 0.01 {
+			t.Error("For quantile: ", quantile, "expected: ", requests, "got: ", r)
+		}
+	}
+	if r := RequestsAtQuantile(types.ForecastedValue{Requests:1000}, util.QUANTILE_UPPER_BOUND, 95); r != 1000 {
+		t.Error("Without bounds expected: ", 1000, "got: ", r)
+	}
+}
+
+func TestScalingIntervalsAtQuantile(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	forecast := types.Forecast{ForecastedValues:[]types.ForecastedValue{
+		{TimeStamp:start, Requests:3600, UpperBound:7200},
+		{TimeStamp:start.Add(time.Hour), Requests:7200, UpperBound:10800},
+	}}
+	forecastComponent := util.ForecastComponent{Granularity:util.HOUR}
+	mean := ScalingIntervals(forecast, SizingQuantile(""), forecastComponent)
+	upper := ScalingIntervals(forecast, SizingQuantile(util.QUANTILE_UPPER_BOUND), forecastComponent)
+	if mean.CriticalIntervals[0].Requests != 1 || upper.CriticalIntervals[0].Requests != 2 {
+		t.Error("Expected requests: ", 1, 2, "got: ", mean.CriticalIntervals[0].Requests, upper.CriticalIntervals[0].Requests)
+	}
+	if forecast.ForecastedValues[0].Requests != 3600 {
+		t.Error("The forecast should not be modified, got: ", forecast.ForecastedValues[0].Requests)
+	}
+	if SizingQuantile("p99") != util.QUANTILE_MEAN {
+		t.Error("Expected unsupported quantiles to be sized at the mean")
+	}
+}
+
+func hourlyForecast(requests []float64) types.Forecast {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	forecast := types.Forecast{}
+	for i,r := range requests {
+		forecast.ForecastedValues = append(forecast.ForecastedValues, types.ForecastedValue{TimeStamp:start.Add(time.Duration(i) * time.Hour), Requests:r})
+	}
+	return forecast
+}
+
+func TestPoIs(t *testing.T) {
+	pois := PoIs([]float64{1, 3, 7, 3, 1, 1, 5, 5, 2, 4})
+	if len(pois) != 2 || pois[0].Index != 2 || pois[1].Index != 6 {
+		t.Fatal("Expected peaks at: ", 2, 6, "got: ", pois)
+	}
+	if pois[0].Start.Index != 0 || pois[0].End.Index != 4 || pois[1].Start.Index != 4 {
+		t.Error("Expected valleys at: ", 0, 4, "got: ", pois[0].Start.Index, pois[0].End.Index, pois[1].Start.Index)
+	}
+	if pois[0].Widht_heights != 4 || pois[0].Left_ips != 1.25 || pois[0].Right_ips != 2.75 {
+		t.Error("Expected width: ", 4, 1.25, 2.75, "got: ", pois[0].Widht_heights, pois[0].Left_ips, pois[0].Right_ips)
+	}
+}
+
+func TestScalingIntervalsStrategies(t *testing.T) {
+	forecast := hourlyForecast([]float64{3600, 10800, 25200, 10800, 3600, 3600, 18000, 18000, 7200, 14400})
+
+	windowing := ScalingIntervals(forecast, util.QUANTILE_MEAN, util.ForecastComponent{Granularity:util.HOUR})
+	if len(windowing.CriticalIntervals) != 10 || windowing.CriticalIntervals[3].Requests != 7 {
+		t.Error("Expected one interval per hour, got: ", windowing.CriticalIntervals)
+	}
+
+	poi := ScalingIntervals(forecast, util.QUANTILE_MEAN, util.ForecastComponent{Granularity:util.HOUR,
+		Intervals:util.IntervalSettings{Strategy:util.INTERVALS_POI}})
+	requests := []float64{1, 3, 7, 7, 5, 5}
+	if len(poi.CriticalIntervals) != len(requests) {
+		t.Fatal("Expected intervals: ", len(requests), "got: ", poi.CriticalIntervals)
+	}
+	for i,r := range requests {
+		if poi.CriticalIntervals[i].Requests != r {
+			t.Error("For interval: ", i, "expected: ", r, "got: ", poi.CriticalIntervals[i].Requests)
+		}
+	}
+	peakInterval := poi.CriticalIntervals[2]
+	if !peakInterval.TimePeak.Equal(forecast.ForecastedValues[2].TimeStamp) ||
+		!peakInterval.TimeStart.Equal(forecast.ForecastedValues[1].TimeStamp.Add(15 * time.Minute)) {
+		t.Error("Expected peak interval from: ", 1.25, "with peak at: ", 2, "got: ", peakInterval)
+	}
+
+	mean := ScalingIntervals(forecast, util.QUANTILE_MEAN, util.ForecastComponent{Granularity:util.HOUR,
+		Intervals:util.IntervalSettings{Strategy:util.INTERVALS_POI, Aggregation:util.AGGREGATION_MEAN, MinLength:3 * 3600}})
+	for i := 2; i < len(mean.CriticalIntervals); i++ {
+		interval := mean.CriticalIntervals[i]
+		if interval.TimeEnd.Sub(interval.TimeStart).Hours() < 3 && i < len(mean.CriticalIntervals) - 1 {
+			t.Error("Expected intervals of at least 3 hours, got: ", interval)
+		}
+	}
+	if mean.CriticalIntervals[1].Requests >= 7 || mean.CriticalIntervals[1].Requests <= 1 {
+		t.Error("Expected the mean of the merged peak, got: ", mean.CriticalIntervals[1].Requests)
+	}
+}
@@ -0,0 +1,128 @@
+package forecast_processing
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"sort"
+)
+
+/* Detect the peaks of a time serie together with the valleys around them
+	in:
+		@values []float64
+	out:
+		@[]types.PoI - one point of interest for each peak, the valleys are its start and end
+*/
+func PoIs(values []float64) []types.PoI {
+	pois := []types.PoI{}
+	peaks := peakIndexes(values)
+	for k,p := range peaks {
+		from := 0
+		if k > 0 {
+			from = peaks[k-1]
+		}
+		to := len(values) - 1
+		if k < len(peaks) - 1 {
+			to = peaks[k+1]
+		}
+		leftValley := minIndex(values, from, p)
+		rightValley := minIndex(values, p, to)
+
+		//The width of the peak is measured at the half of its height over the highest valley
+		base := values[leftValley]
+		if values[rightValley] > base {
+			base = values[rightValley]
+		}
+		height := (values[p] + base) / 2
+
+		poi := types.PoI{
+			Peak:          true,
+			Index:         p,
+			Widht_heights: height,
+			Left_ips:      leftCrossing(values, p, leftValley, height),
+			Right_ips:     rightCrossing(values, p, rightValley, height),
+		}
+		poi.Start.Index = leftValley
+		poi.End.Index = rightValley
+		pois = append(pois, poi)
+	}
+	return pois
+}
+
+//Indexes of the local maxima, the first value of a plateau is the peak
+func peakIndexes(values []float64) []int {
+	peaks := []int{}
+	n := len(values)
+	for i := 1; i < n - 1; i++ {
+		if values[i] <= values[i-1] {
+			continue
+		}
+		j := i
+		for j < n - 1 && values[j+1] == values[i] {
+			j++
+		}
+		if j < n - 1 && values[j+1] < values[i] {
+			peaks = append(peaks, i)
+		}
+		i = j
+	}
+	return peaks
+}
+
+//Index of the lowest value between from and to, both included
+func minIndex(values []float64, from int, to int) int {
+	index := from
+	for i := from; i <= to; i++ {
+		if values[i] < values[index] {
+			index = i
+		}
+	}
+	return index
+}
+
+//Position on the left of the peak where the serie crosses the height, interpolated between two values
+func leftCrossing(values []float64, peak int, valley int, height float64) float64 {
+	i := peak
+	for i > valley && values[i-1] >= height {
+		i--
+	}
+	if i == valley {
+		return float64(valley)
+	}
+	return float64(i-1) + (height - values[i-1]) / (values[i] - values[i-1])
+}
+
+//Position on the right of the peak where the serie crosses the height, interpolated between two values
+func rightCrossing(values []float64, peak int, valley int, height float64) float64 {
+	j := peak
+	for j < valley && values[j+1] >= height {
+		j++
+	}
+	if j == valley {
+		return float64(valley)
+	}
+	return float64(j) + (values[j] - height) / (values[j] - values[j+1])
+}
+
+/* Split the forecast at the width of its peaks, each peak and each valley between them becomes a segment
+	in:
+		@values []types.ForecastedValue
+		@pois []types.PoI
+	out:
+		@[]segment
+*/
+func poiSegments(values []types.ForecastedValue, pois []types.PoI) []segment {
+	segments := []segment{}
+	if len(values) < 2 {
+		return segments
+	}
+	boundaries := []float64{0, float64(len(values) - 1)}
+	for _,poi := range pois {
+		boundaries = append(boundaries, poi.Left_ips, poi.Right_ips)
+	}
+	sort.Float64s(boundaries)
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] > boundaries[i-1] {
+			segments = append(segments, segment{from:boundaries[i-1], to:boundaries[i]})
+		}
+	}
+	return segments
+}
@@ -0,0 +1,235 @@
+package forecaster
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/op/go-logging"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var log = logging.MustGetLogger("spdt")
+
+/* Predict the load of a time window from the history of a service
+	in:
+		@history []types.ForecastedValue - load before the time window
+		@timeStart time.Time
+		@timeEnd time.Time
+		@granularity string - unit of time between two values
+		@settings util.NativeForecaster
+	out:
+		@types.Forecast - one value per unit of time from timeStart to timeEnd
+		@error
+*/
+func Forecast(history []types.ForecastedValue, timeStart time.Time, timeEnd time.Time, granularity string,
+	settings util.NativeForecaster) (types.Forecast, error) {
+	switch granularity {
+	case util.SECOND, util.MINUTE, util.HOUR, util.DAY, util.MONTH:
+	default:
+		return types.Forecast{}, errors.New("Invalid forecast granularity " + granularity)
+	}
+	step := time.Duration(util.ParseIntervalToSeconds("1" + granularity)) * time.Second
+	series := regularSeries(history, timeStart, step)
+	if len(series) == 0 {
+		return types.Forecast{}, errors.New("No history available to forecast")
+	}
+	horizon := int(timeEnd.Sub(timeStart) / step) + 1
+
+	var predictions []float64
+	seasonLength := settings.SeasonLength
+	if seasonLength <= 0 {
+		seasonLength = util.DEFAULT_SEASON_LENGTH
+	}
+	method := settings.Method
+	if method == util.HOLT_WINTERS && len(series) < 2 * seasonLength {
+		log.Warningf("History of %d values is shorter than two seasons, %s is used instead", len(series), util.SEASONAL_NAIVE)
+		method = util.SEASONAL_NAIVE
+	}
+	if method == util.SEASONAL_NAIVE && len(series) < seasonLength {
+		log.Warningf("History of %d values is shorter than a season, %s is used instead", len(series), util.MOVING_AVERAGE)
+		method = util.MOVING_AVERAGE
+	}
+	switch method {
+	case util.HOLT_WINTERS:
+		predictions = holtWinters(series, seasonLength, horizon, settings)
+	case util.SEASONAL_NAIVE:
+		predictions = seasonalNaive(series, seasonLength, horizon)
+	default:
+		window := settings.Window
+		if window <= 0 {
+			window = util.DEFAULT_MOVING_AVERAGE_WINDOW
+		}
+		predictions = movingAverage(series, window, horizon)
+	}
+
+	forecast := types.Forecast{
+		TimeWindowStart: timeStart,
+		TimeWindowEnd:   timeEnd,
+	}
+	for i,p := range predictions {
+		forecast.ForecastedValues = append(forecast.ForecastedValues, types.ForecastedValue{
+			TimeStamp: timeStart.Add(time.Duration(i) * step),
+			Requests:  math.Max(0, p),
+		})
+	}
+	return forecast, nil
+}
+
+/* Load history built from the values observed in the windows of stored forecasts. Only when no values were
+	observed, the forecasted values are used. When forecasts overlap, the one of the latest window is kept
+	in:
+		@forecasts []types.Forecast
+	out:
+		@[]types.ForecastedValue - sorted by time
+*/
+func History(forecasts []types.Forecast) []types.ForecastedValue {
+	sort.SliceStable(forecasts, func(i, j int) bool {
+		return forecasts[i].TimeWindowStart.Before(forecasts[j].TimeWindowStart)
+	})
+	observed := false
+	for _,f := range forecasts {
+		observed = observed || len(f.ObservedValues) > 0
+	}
+	values := make(map[time.Time]float64)
+	for _,f := range forecasts {
+		forecastValues := f.ForecastedValues
+		if observed {
+			forecastValues = f.ObservedValues
+		}
+		for _,v := range forecastValues {
+			values[v.TimeStamp.UTC()] = v.Requests
+		}
+	}
+	history := []types.ForecastedValue{}
+	for t,r := range values {
+		history = append(history, types.ForecastedValue{TimeStamp:t, Requests:r})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].TimeStamp.Before(history[j].TimeStamp)
+	})
+	return history
+}
+
+/* Values of the history at regular steps that end just before timeStart.
+	Missing steps take the previous value
+	in:
+		@history []types.ForecastedValue
+		@timeStart time.Time
+		@step time.Duration
+	out:
+		@[]float64
+*/
+func regularSeries(history []types.ForecastedValue, timeStart time.Time, step time.Duration) []float64 {
+	values := []types.ForecastedValue{}
+	for _,v := range history {
+		if v.TimeStamp.Before(timeStart) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return []float64{}
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].TimeStamp.Before(values[j].TimeStamp)
+	})
+
+	//The series is aligned with timeStart
+	numberSteps := int(timeStart.Sub(values[0].TimeStamp) / step)
+	first := timeStart.Add(-time.Duration(numberSteps) * step)
+	series := make([]float64, numberSteps)
+	j := 0
+	last := values[0].Requests
+	for i := range series {
+		t := first.Add(time.Duration(i) * step)
+		for j < len(values) && !values[j].TimeStamp.After(t) {
+			last = values[j].Requests
+			j++
+		}
+		series[i] = last
+	}
+	return series
+}
+
+//Each value is the value of the same time in the last season
+func seasonalNaive(series []float64, seasonLength int, horizon int) []float64 {
+	predictions := make([]float64, horizon)
+	lastSeason := series[len(series)-seasonLength:]
+	for i := range predictions {
+		predictions[i] = lastSeason[i % seasonLength]
+	}
+	return predictions
+}
+
+//Each value is the mean of the last values of the series
+func movingAverage(series []float64, window int, horizon int) []float64 {
+	if window > len(series) {
+		window = len(series)
+	}
+	mean := 0.0
+	for _,v := range series[len(series)-window:] {
+		mean += v
+	}
+	mean = mean / float64(window)
+	predictions := make([]float64, horizon)
+	for i := range predictions {
+		predictions[i] = mean
+	}
+	return predictions
+}
+
+/* Additive Holt-Winters, the level and trend are initialized with the first two seasons
+	in:
+		@series []float64 - at least two seasons
+		@seasonLength int
+		@horizon int - number of values predicted
+		@settings util.NativeForecaster - smoothing factors
+	out:
+		@[]float64
+*/
+func holtWinters(series []float64, seasonLength int, horizon int, settings util.NativeForecaster) []float64 {
+	alpha := smoothingFactor(settings.Alpha, util.DEFAULT_HOLT_WINTERS_ALPHA)
+	beta := smoothingFactor(settings.Beta, util.DEFAULT_HOLT_WINTERS_BETA)
+	gamma := smoothingFactor(settings.Gamma, util.DEFAULT_HOLT_WINTERS_GAMMA)
+
+	firstMean := mean(series[:seasonLength])
+	secondMean := mean(series[seasonLength:2*seasonLength])
+	level := firstMean
+	trend := (secondMean - firstMean) / float64(seasonLength)
+	seasonal := make([]float64, seasonLength)
+	for i := range seasonal {
+		seasonal[i] = series[i] - firstMean
+	}
+
+	for i,v := range series {
+		s := seasonal[i % seasonLength]
+		previousLevel := level
+		level = alpha * (v - s) + (1 - alpha) * (level + trend)
+		trend = beta * (level - previousLevel) + (1 - beta) * trend
+		seasonal[i % seasonLength] = gamma * (v - level) + (1 - gamma) * s
+	}
+
+	predictions := make([]float64, horizon)
+	n := len(series)
+	for h := range predictions {
+		predictions[h] = level + float64(h+1) * trend + seasonal[(n + h) % seasonLength]
+	}
+	return predictions
+}
+
+//Smoothing factor between 0 and 1, the default value is used if it is not set
+func smoothingFactor(value float64, defaultValue float64) float64 {
+	if value <= 0 || value > 1 {
+		return defaultValue
+	}
+	return value
+}
+
+func mean(values []float64) float64 {
+	total := 0.0
+	for _,v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
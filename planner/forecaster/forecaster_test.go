@@ -0,0 +1,103 @@
+package forecaster
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"testing"
+	"time"
+)
+
+//Daily load with a peak at noon
+func dailyLoad(t time.Time) float64 {
+	return 1000 + 500 * math.Sin(float64(t.Hour() - 6) * math.Pi / 12)
+}
+
+func periodicHistory(start time.Time, days int) []types.ForecastedValue {
+	history := []types.ForecastedValue{}
+	for i := 0; i < days * 24; i++ {
+		t := start.Add(time.Duration(i) * time.Hour)
+		history = append(history, types.ForecastedValue{TimeStamp:t, Requests:dailyLoad(t)})
+	}
+	return history
+}
+
+func TestForecastMethods(t *testing.T) {
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	history := periodicHistory(start, 4)
+	timeStart := start.Add(4 * 24 * time.Hour)
+	timeEnd := timeStart.Add(23 * time.Hour)
+
+	tolerance := map[string]float64{util.SEASONAL_NAIVE:0.001, util.HOLT_WINTERS:50}
+	for method, maxError := range tolerance {
+		forecast, err := Forecast(history, timeStart, timeEnd, util.HOUR, util.NativeForecaster{Method:method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(forecast.ForecastedValues) != 24 || !forecast.ForecastedValues[23].TimeStamp.Equal(timeEnd) {
+			t.Fatal(method, " expected 24 values until: ", timeEnd, "got: ", len(forecast.ForecastedValues))
+		}
+		for _,v := range forecast.ForecastedValues {
+			if math.Abs(v.Requests - dailyLoad(v.TimeStamp)) > maxError {
+				t.Error(method, " at: ", v.TimeStamp, "expected: ", dailyLoad(v.TimeStamp), "got: ", v.Requests)
+			}
+		}
+	}
+
+	forecast, err := Forecast(history, timeStart, timeEnd, util.HOUR, util.NativeForecaster{Method:util.MOVING_AVERAGE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(forecast.ForecastedValues[0].Requests - 1000) > 0.001 {
+		t.Error("Moving average of a day expected: ", 1000, "got: ", forecast.ForecastedValues[0].Requests)
+	}
+
+	//A short history falls back to the moving average
+	forecast, err = Forecast(history[len(history)-6:], timeStart, timeEnd, util.HOUR, util.NativeForecaster{Method:util.HOLT_WINTERS})
+	if err != nil || len(forecast.ForecastedValues) != 24 {
+		t.Error("Expected a forecast from a short history, got: ", err)
+	}
+	if _, err = Forecast([]types.ForecastedValue{}, timeStart, timeEnd, util.HOUR, util.NativeForecaster{}); err == nil {
+		t.Error("Expected an error without history")
+	}
+	for _,granularity := range []string{"", "x"} {
+		if _, err = Forecast(history, timeStart, timeEnd, granularity, util.NativeForecaster{}); err == nil {
+			t.Error("Expected an error with the granularity: ", granularity)
+		}
+	}
+}
+
+func TestHistoryKeepsLatestForecast(t *testing.T) {
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	forecasts := []types.Forecast{
+		{TimeWindowStart:start.Add(time.Hour), ForecastedValues:[]types.ForecastedValue{
+			{TimeStamp:start.Add(time.Hour), Requests:20}, {TimeStamp:start.Add(2 * time.Hour), Requests:30}}},
+		{TimeWindowStart:start, ForecastedValues:[]types.ForecastedValue{
+			{TimeStamp:start, Requests:1}, {TimeStamp:start.Add(time.Hour), Requests:2}}},
+	}
+	history := History(forecasts)
+	expected := []float64{1, 20, 30}
+	if len(history) != len(expected) {
+		t.Fatal("Expected: ", expected, "got: ", history)
+	}
+	for i,v := range history {
+		if v.Requests != expected[i] {
+			t.Error("Expected: ", expected, "got: ", history)
+		}
+	}
+}
+
+func TestHistoryFromObservedValues(t *testing.T) {
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	forecasts := []types.Forecast{
+		{TimeWindowStart:start, ForecastedValues:[]types.ForecastedValue{
+			{TimeStamp:start, Requests:1}, {TimeStamp:start.Add(time.Hour), Requests:2}},
+			ObservedValues:[]types.ForecastedValue{{TimeStamp:start, Requests:5}}},
+		{TimeWindowStart:start.Add(2 * time.Hour), ForecastedValues:[]types.ForecastedValue{
+			{TimeStamp:start.Add(2 * time.Hour), Requests:3}}},
+	}
+	history := History(forecasts)
+	if len(history) != 1 || history[0].Requests != 5 {
+		t.Error("Expected the observed value: ", 5, "got: ", history)
+	}
+}
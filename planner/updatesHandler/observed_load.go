@@ -0,0 +1,150 @@
+package updatesHandler
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"math"
+	"sort"
+	"time"
+)
+
+/* Add observed values to the values observed in the time window of a forecast. A value observed
+	at the same time as a stored value replaces it
+	in:
+		@forecast types.Forecast
+		@observedValues []types.ForecastedValue
+	out:
+		@types.Forecast - with the observed values of its time window sorted by time
+		@int - number of observed values added
+*/
+func AddObservedValues(forecast types.Forecast, observedValues []types.ForecastedValue) (types.Forecast, int) {
+	byTime := make(map[int64]types.ForecastedValue)
+	for _, v := range forecast.ObservedValues {
+		byTime[v.TimeStamp.UnixNano()] = v
+	}
+	added := 0
+	for _, v := range observedValues {
+		if v.TimeStamp.Before(forecast.TimeWindowStart) || !v.TimeStamp.Before(forecast.TimeWindowEnd) {
+			continue
+		}
+		byTime[v.TimeStamp.UnixNano()] = types.ForecastedValue{TimeStamp: v.TimeStamp, Requests: v.Requests}
+		added++
+	}
+	values := []types.ForecastedValue{}
+	for _, v := range byTime {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].TimeStamp.Before(values[j].TimeStamp) })
+	forecast.ObservedValues = values
+	return forecast, added
+}
+
+/* Error of a forecast with its observed values. Each observed value is compared with the forecasted value
+	of the interval that contains it
+	in:
+		@forecast types.Forecast
+	out:
+		@types.ForecastError
+*/
+func ForecastError(forecast types.Forecast) types.ForecastError {
+	forecastError := types.ForecastError{}
+	predictions := forecast.ForecastedValues
+	absolutePercentage := 0.0
+	observedSum := 0.0
+	forecastedSum := 0.0
+	index := 0
+	for _, observed := range forecast.ObservedValues {
+		for index+1 < len(predictions) && !predictions[index+1].TimeStamp.After(observed.TimeStamp) {
+			index++
+		}
+		if index >= len(predictions) || predictions[index].TimeStamp.After(observed.TimeStamp) {
+			continue
+		}
+		forecasted := predictions[index].Requests
+		if observed.Requests > 0 {
+			absolutePercentage += math.Abs(observed.Requests - forecasted) / observed.Requests
+			forecastError.Samples++
+		}
+		observedSum += observed.Requests
+		forecastedSum += forecasted
+	}
+	if forecastError.Samples > 0 {
+		forecastError.MAPE = 100 * absolutePercentage / float64(forecastError.Samples)
+	}
+	if forecastedSum > 0 {
+		forecastError.Bias = 100 * (observedSum - forecastedSum) / forecastedSum
+	}
+	return forecastError
+}
+
+//Scale the forecasted requests and their bounds by the bias of the forecast
+func CorrectForecast(forecast types.Forecast, forecastError types.ForecastError) types.Forecast {
+	factor := 1 + forecastError.Bias / 100
+	values := make([]types.ForecastedValue, len(forecast.ForecastedValues))
+	for i, v := range forecast.ForecastedValues {
+		values[i] = types.ForecastedValue{
+			TimeStamp:  v.TimeStamp,
+			Requests:   v.Requests * factor,
+			UpperBound: v.UpperBound * factor,
+			LowerBound: v.LowerBound * factor,
+		}
+	}
+	forecast.ForecastedValues = values
+	return forecast
+}
+
+//Requests per second, as pulled from Prometheus, converted to requests in a unit of the granularity of the forecasts
+func PerSecondToGranularity(observedValues []types.ForecastedValue, granularity string) []types.ForecastedValue {
+	factor := util.GranularityFactor(granularity)
+	values := make([]types.ForecastedValue, len(observedValues))
+	for i, v := range observedValues {
+		values[i] = types.ForecastedValue{TimeStamp: v.TimeStamp, Requests: v.Requests * factor}
+	}
+	return values
+}
+
+//Consecutive requests of the main service observed out of the capacity bounds of the selected policy
+type OutOfBoundsStreak struct {
+	PolicyID string
+	Count    int
+	Start    time.Time	//Time of the first value of the streak
+	Last     time.Time	//Time of the last value counted
+}
+
+/* Count the observed requests of the main service that break the capacity bounds of the scaling action of the policy
+	at the time they were observed. A value within the bounds ends the streak, and the values observed out of the
+	scaling actions or not after the last value counted are ignored
+	in:
+		@observedValues []types.ForecastedValue
+		@policy types.Policy - the streak restarts if it is a different policy
+		@sysConfiguration util.SystemConfiguration
+*/
+func (s *OutOfBoundsStreak) Add(observedValues []types.ForecastedValue, policy types.Policy, sysConfiguration util.SystemConfiguration) {
+	if s.PolicyID != policy.ID.Hex() {
+		*s = OutOfBoundsStreak{PolicyID: policy.ID.Hex()}
+	}
+	values := make([]types.ForecastedValue, len(observedValues))
+	copy(values, observedValues)
+	sort.Slice(values, func(i, j int) bool { return values[i].TimeStamp.Before(values[j].TimeStamp) })
+	for _, observed := range values {
+		if !observed.TimeStamp.After(s.Last) {
+			continue
+		}
+		for _, sa := range policy.ScalingActions {
+			if sa.TimeStart.After(observed.TimeStamp) || !sa.TimeEnd.After(observed.TimeStamp) {
+				continue
+			}
+			lowerBoundCapacity, upperBoundCapacity := capacityBounds(sa, sysConfiguration.MainServiceName)
+			if observed.Requests > upperBoundCapacity || observed.Requests < lowerBoundCapacity {
+				if s.Count == 0 {
+					s.Start = observed.TimeStamp
+				}
+				s.Count++
+			} else {
+				s.Count = 0
+			}
+			s.Last = observed.TimeStamp
+			break
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package updatesHandler
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestForecastError(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	forecast := types.Forecast{TimeWindowStart:start, TimeWindowEnd:start.Add(3 * time.Hour), ForecastedValues:[]types.ForecastedValue{
+		{TimeStamp:start, Requests:100},
+		{TimeStamp:start.Add(time.Hour), Requests:200},
+		{TimeStamp:start.Add(2 * time.Hour), Requests:100},
+	}}
+	forecast, added := AddObservedValues(forecast, []types.ForecastedValue{
+		{TimeStamp:start.Add(90 * time.Minute), Requests:250},
+		{TimeStamp:start.Add(30 * time.Minute), Requests:50},
+		{TimeStamp:start.Add(4 * time.Hour), Requests:50},
+	})
+	if added != 2 || len(forecast.ObservedValues) != 2 || !forecast.ObservedValues[0].TimeStamp.Equal(start.Add(30 * time.Minute)) {
+		t.Fatal("Expected the 2 values observed in the time window sorted by time, got: ", forecast.ObservedValues)
+	}
+	//A value observed again replaces the stored one
+	forecast, _ = AddObservedValues(forecast, []types.ForecastedValue{{TimeStamp:start.Add(30 * time.Minute), Requests:80}})
+	if len(forecast.ObservedValues) != 2 || forecast.ObservedValues[0].Requests != 80 {
+		t.Fatal("Expected the observed value to be replaced, got: ", forecast.ObservedValues)
+	}
+
+	forecastError := ForecastError(forecast)
+	//|80-100|/80 = 0.25 and |250-200|/250 = 0.2
+	if forecastError.Samples != 2 || math.Abs(forecastError.MAPE - 22.5) > 1e-9 || math.Abs(forecastError.Bias - 10) > 1e-9 {
+		t.Error("Expected MAPE 22.5 and bias 10 over 2 values, got: ", forecastError)
+	}
+	corrected := CorrectForecast(forecast, forecastError)
+	if math.Abs(corrected.ForecastedValues[1].Requests - 220) > 1e-9 || forecast.ForecastedValues[1].Requests != 200 {
+		t.Error("Expected the corrected forecast with 220 requests, got: ", corrected.ForecastedValues[1].Requests)
+	}
+}
+
+func TestOutOfBoundsStreak(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	sysConfiguration := util.SystemConfiguration{MainServiceName:"primeapp"}
+	policy := types.Policy{ID:bson.NewObjectId(), ScalingActions:[]types.ScalingAction{
+		{
+			DesiredState: types.State{Services:types.Service{"primeapp":{Scale:4}}},
+			Metrics:      types.ConfigMetrics{RequestsCapacity:400},
+			TimeStart:    start,
+			TimeEnd:      start.Add(time.Hour),
+		},
+		{
+			DesiredState: types.State{Services:types.Service{"primeapp":{Scale:2}}},
+			Metrics:      types.ConfigMetrics{RequestsCapacity:200},
+			TimeStart:    start.Add(time.Hour),
+			TimeEnd:      start.Add(2 * time.Hour),
+		},
+	}}
+	//The bounds are 300-400 requests in the first hour and 100-200 in the second one
+	streak := OutOfBoundsStreak{}
+	streak.Add([]types.ForecastedValue{{TimeStamp:start.Add(time.Minute), Requests:350}, {TimeStamp:start.Add(70 * time.Minute), Requests:150}},
+		policy, sysConfiguration)
+	if streak.Count != 0 {
+		t.Error("Expected the observed requests within the capacity bounds, got: ", streak)
+	}
+	streak.Add([]types.ForecastedValue{{TimeStamp:start.Add(90 * time.Minute), Requests:250}, {TimeStamp:start.Add(80 * time.Minute), Requests:250}},
+		policy, sysConfiguration)
+	if streak.Count != 2 || !streak.Start.Equal(start.Add(80 * time.Minute)) {
+		t.Error("Expected 2 values out of the bounds from: ", start.Add(80 * time.Minute), "got: ", streak)
+	}
+	//Values already counted are ignored and a value within the bounds ends the streak
+	streak.Add([]types.ForecastedValue{{TimeStamp:start.Add(90 * time.Minute), Requests:250}}, policy, sysConfiguration)
+	if streak.Count != 2 {
+		t.Error("Expected the value observed again to be ignored, got: ", streak)
+	}
+	streak.Add([]types.ForecastedValue{{TimeStamp:start.Add(100 * time.Minute), Requests:150}}, policy, sysConfiguration)
+	if streak.Count != 0 {
+		t.Error("Expected the streak to end, got: ", streak)
+	}
+
+	//Requests per second observed against the hourly capacity: 0.1 requests per second are 360 requests per hour
+	perSecond := []types.ForecastedValue{{TimeStamp:start.Add(2 * time.Minute), Requests:0.1}, {TimeStamp:start.Add(3 * time.Minute), Requests:0.05}}
+	observedValues := PerSecondToGranularity(perSecond, util.HOUR)
+	if observedValues[0].Requests != 360 || perSecond[0].Requests != 0.1 {
+		t.Error("Expected 360 requests per hour, got: ", observedValues[0].Requests)
+	}
+	streak.Add(observedValues, types.Policy{ID:bson.NewObjectId(), ScalingActions:policy.ScalingActions}, sysConfiguration)
+	if streak.Count != 1 || !streak.Start.Equal(start.Add(3 * time.Minute)) {
+		t.Error("Expected only the 180 requests per hour out of the bounds of a new streak, got: ", streak)
+	}
+}
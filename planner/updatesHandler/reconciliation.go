@@ -0,0 +1,153 @@
+package updatesHandler
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"math"
+	"time"
+)
+
+/* Compare the actual state of the infrastructure with the state that a policy expects at a time.
+	Until the tolerance after the expected start of a state passes, the infrastructure may still be in the
+	previous state, and once the transition of the next state starts it may already be in the next state
+	in:
+		@policy types.Policy
+		@actualState types.State
+		@inTransition bool - the scheduler reports that the last deployed state is not active yet
+		@t time.Time
+		@tolerance time.Duration - time allowed after the expected start of a state to reach it
+	out:
+		@types.StateDrift
+		@bool - false if the policy does not expect a state at time t
+*/
+func StateDrift(policy types.Policy, actualState types.State, inTransition bool, t time.Time, tolerance time.Duration) (types.StateDrift, bool) {
+	index := -1
+	for i, sa := range policy.ScalingActions {
+		if !sa.TimeStart.After(t) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return types.StateDrift{}, false
+	}
+	action := policy.ScalingActions[index]
+	drift := types.StateDrift{
+		Time:          t,
+		PolicyID:      policy.ID.Hex(),
+		ExpectedState: action.DesiredState,
+		ActualState:   actualState,
+		MissingVMs:    types.VMScale{},
+		ExtraVMs:      types.VMScale{},
+		WrongReplicas: make(map[string]int),
+	}
+	if sameState(actualState, action.DesiredState) {
+		return drift, true
+	}
+	if index+1 < len(policy.ScalingActions) {
+		next := policy.ScalingActions[index+1]
+		if !next.TimeStartTransition.After(t) && sameState(actualState, next.DesiredState) {
+			drift.ExpectedState = next.DesiredState
+			return drift, true
+		}
+	}
+	beforeDeadline := t.Before(action.TimeStart.Add(tolerance))
+	if beforeDeadline && (sameState(actualState, action.InitialState) || inTransition) {
+		return drift, true
+	}
+
+	expectedVMs := 0
+	differentVMs := 0
+	for vmType, n := range action.DesiredState.VMs {
+		expectedVMs += n
+		if actualState.VMs[vmType] < n {
+			drift.MissingVMs[vmType] = n - actualState.VMs[vmType]
+			differentVMs += n - actualState.VMs[vmType]
+		}
+	}
+	for vmType, n := range actualState.VMs {
+		if n > action.DesiredState.VMs[vmType] {
+			drift.ExtraVMs[vmType] = n - action.DesiredState.VMs[vmType]
+			differentVMs += n - action.DesiredState.VMs[vmType]
+		}
+	}
+	expectedReplicas := 0
+	differentReplicas := 0
+	for name, s := range action.DesiredState.Services {
+		expectedReplicas += s.Scale
+		if difference := actualState.Services[name].Scale - s.Scale; difference != 0 {
+			drift.WrongReplicas[name] = difference
+			differentReplicas += int(math.Abs(float64(difference)))
+		}
+	}
+	drift.Magnitude = math.Max(ratio(differentVMs, expectedVMs), ratio(differentReplicas, expectedReplicas))
+	drift.LateTransition = !beforeDeadline && (sameState(actualState, action.InitialState) || inTransition)
+	return drift, true
+}
+
+//Same VMs and replicas, the resources of the services are not compared
+func sameState(actualState types.State, expectedState types.State) bool {
+	for vmType, n := range expectedState.VMs {
+		if actualState.VMs[vmType] != n {
+			return false
+		}
+	}
+	for vmType, n := range actualState.VMs {
+		if expectedState.VMs[vmType] != n {
+			return false
+		}
+	}
+	for name, s := range expectedState.Services {
+		if actualState.Services[name].Scale != s.Scale {
+			return false
+		}
+	}
+	return true
+}
+
+func ratio(different int, expected int) float64 {
+	if expected == 0 {
+		if different > 0 {
+			return 1
+		}
+		return 0
+	}
+	return float64(different) / float64(expected)
+}
+
+//Exponential backoff between the derivations of new policies triggered by a persistent deviation from the selected policy
+type RederivationBackoff struct {
+	next  time.Time
+	delay time.Duration
+}
+
+//Whether a new policy can be derived at time t
+func (b *RederivationBackoff) Allow(t time.Time) bool {
+	return !t.Before(b.next)
+}
+
+/* Record a derivation at time t, waiting the base delay before the next one and twice as long as the previous
+	delay before each later one, up to the maximum delay
+	in:
+		@t time.Time
+		@base time.Duration
+		@max time.Duration
+	out:
+		@time.Time - time of the next derivation allowed
+*/
+func (b *RederivationBackoff) Rederived(t time.Time, base time.Duration, max time.Duration) time.Time {
+	if b.delay == 0 {
+		b.delay = base
+	} else {
+		b.delay = 2 * b.delay
+	}
+	if b.delay > max {
+		b.delay = max
+	}
+	b.next = t.Add(b.delay)
+	return b.next
+}
+
+//Allow the next derivation once the deviation is gone
+func (b *RederivationBackoff) Reset() {
+	b.next = time.Time{}
+	b.delay = 0
+}
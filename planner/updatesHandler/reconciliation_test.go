@@ -0,0 +1,107 @@
+package updatesHandler
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"testing"
+	"time"
+)
+
+func TestStateDrift(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	initialState := types.State{VMs:types.VMScale{"t2.large":1}}
+	desiredState := types.State{Services:types.Service{"primeapp":{Scale:3, CPU:0.2, Memory:0.5}}, VMs:types.VMScale{"t2.micro":2}}
+	nextState := types.State{Services:types.Service{"primeapp":{Scale:6, CPU:0.2, Memory:0.5}}, VMs:types.VMScale{"t2.micro":4}}
+	policy := types.Policy{ScalingActions:[]types.ScalingAction{
+		{InitialState:initialState, DesiredState:desiredState, TimeStartTransition:start.Add(-time.Minute), TimeStart:start},
+		{InitialState:desiredState, DesiredState:nextState, TimeStartTransition:start.Add(3 * time.Hour), TimeStart:start.Add(4 * time.Hour)},
+	}}
+	tolerance := 10 * time.Minute
+
+	if _, ok := StateDrift(policy, initialState, false, start.Add(-time.Hour), tolerance); ok {
+		t.Error("Expected no state to compare before the first scaling action")
+	}
+	for _, c := range []struct {
+		actual types.State
+		t      time.Time
+	}{
+		{desiredState, start.Add(time.Hour)},
+		{initialState, start.Add(time.Minute)},
+		{nextState, start.Add(3 * time.Hour)},
+	} {
+		if drift, ok := StateDrift(policy, c.actual, false, c.t, tolerance); !ok || drift.Magnitude != 0 {
+			t.Error("For state: ", c.actual, "at: ", c.t, "expected no drift, got: ", drift.Magnitude, ok)
+		}
+	}
+
+	drift, _ := StateDrift(policy, initialState, false, start.Add(time.Hour), tolerance)
+	if !drift.LateTransition || drift.MissingVMs["t2.micro"] != 2 || drift.ExtraVMs["t2.large"] != 1 ||
+		drift.WrongReplicas["primeapp"] != -3 || drift.Magnitude != 1.5 {
+		t.Error("Expected a late transition with magnitude 1.5, got: ", drift)
+	}
+
+	actualState := types.State{Services:types.Service{"primeapp":{Scale:3, CPU:0.2, Memory:0.5}}, VMs:types.VMScale{"t2.micro":1}}
+	drift, _ = StateDrift(policy, actualState, false, start.Add(time.Hour), tolerance)
+	if drift.LateTransition || drift.MissingVMs["t2.micro"] != 1 || len(drift.WrongReplicas) != 0 || drift.Magnitude != 0.5 {
+		t.Error("Expected one missing VM with magnitude 0.5, got: ", drift)
+	}
+	drift, _ = StateDrift(policy, actualState, true, start.Add(time.Hour), tolerance)
+	if !drift.LateTransition {
+		t.Error("Expected a late transition while the scheduler is still deploying, got: ", drift)
+	}
+}
+
+func TestRederivationBackoff(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	backoff := RederivationBackoff{}
+	if !backoff.Allow(start) {
+		t.Error("Expected the first derivation to be allowed")
+	}
+	for i, expected := range []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute} {
+		next := backoff.Rederived(start, 10 * time.Minute, 30 * time.Minute)
+		if next != start.Add(expected) || backoff.Allow(next.Add(-time.Second)) || !backoff.Allow(next) {
+			t.Error("For derivation: ", i, "expected next derivation at: ", start.Add(expected), "got: ", next)
+		}
+	}
+	backoff.Reset()
+	if next := backoff.Rederived(start, 10 * time.Minute, 30 * time.Minute); next != start.Add(10 * time.Minute) {
+		t.Error("Expected the delay to restart after a reset, got: ", next)
+	}
+}
+
+func TestTruncatePolicy(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	policy := types.Policy{TimeWindowStart:start, TimeWindowEnd:start.Add(6 * time.Hour), ScalingActions:[]types.ScalingAction{
+		{TimeStartTransition:start, TimeStart:start.Add(time.Minute), TimeEnd:start.Add(3 * time.Hour)},
+		{TimeStartTransition:start.Add(3 * time.Hour), TimeStart:start.Add(3 * time.Hour + time.Minute), TimeEnd:start.Add(6 * time.Hour)},
+	}}
+	truncated := TruncatePolicy(policy, start.Add(2 * time.Hour))
+	if truncated.TimeWindowEnd != start.Add(2 * time.Hour) || truncated.ScalingActions[0].Invalidated ||
+		truncated.ScalingActions[0].TimeEnd != start.Add(2 * time.Hour) || !truncated.ScalingActions[1].Invalidated {
+		t.Error("Expected the first action to end at the truncation and the second to be invalidated, got: ", truncated)
+	}
+	if policy.ScalingActions[1].Invalidated || policy.ScalingActions[0].TimeEnd != start.Add(3 * time.Hour) {
+		t.Error("Expected the original policy to be unchanged, got: ", policy)
+	}
+}
+
+func TestSelectedPolicyInForce(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	end := start.Add(6 * time.Hour)
+	truncated := types.Policy{Status:types.SCHEDULED, TimeWindowStart:start, TimeWindowEnd:start.Add(2 * time.Hour)}
+	rederived := types.Policy{Status:types.SCHEDULED, TimeWindowStart:start.Add(2 * time.Hour), TimeWindowEnd:end}
+	discarted := types.Policy{Status:types.DISCARTED, TimeWindowStart:start.Add(3 * time.Hour), TimeWindowEnd:end}
+
+	policy, ok := SelectedPolicyInForce([]types.Policy{rederived, discarted, truncated})
+	if !ok || policy.TimeWindowStart != rederived.TimeWindowStart {
+		t.Error("Expected the policy derived again for the rest of the window, got: ", policy, ok)
+	}
+	//A policy truncated when it started is replaced by the policy derived then
+	emptied := types.Policy{Status:types.SCHEDULED, TimeWindowStart:start.Add(2 * time.Hour), TimeWindowEnd:start.Add(2 * time.Hour)}
+	policy, ok = SelectedPolicyInForce([]types.Policy{emptied, rederived})
+	if !ok || policy.TimeWindowEnd != end {
+		t.Error("Expected the policy that ends with the window, got: ", policy, ok)
+	}
+	if _, ok = SelectedPolicyInForce([]types.Policy{discarted}); ok {
+		t.Error("Expected no policy in force")
+	}
+}
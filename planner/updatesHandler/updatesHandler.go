@@ -1,11 +1,11 @@
 package updatesHandler
 
 import (
-	Sservice "github.com/Cloud-Pie/SPDT/rest_clients/scheduler"
 	"github.com/Cloud-Pie/SPDT/util"
 	"github.com/Cloud-Pie/SPDT/storage"
 	"time"
 	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/planner/execution"
 	"github.com/op/go-logging"
 )
 
@@ -14,8 +14,13 @@ var log = logging.MustGetLogger("spdt")
 func InvalidateOldPolicies(systemConfiguration util.SystemConfiguration, timeStart time.Time,timeEnd time.Time) bool{
 	invalidated := false
 	policyDAO := storage.GetPolicyDAO(systemConfiguration.MainServiceName)
+	budgetLedgerDAO := storage.GetBudgetLedgerDAO(systemConfiguration.MainServiceName)
 	currentPolicies,err := policyDAO.FindAllByTimeWindow(timeStart,timeEnd)
 	if len(currentPolicies) > 0 {
+		//No pending attempt may push states after they are invalidated
+		for _,p := range currentPolicies {
+			execution.CancelScheduling(p.ID.Hex())
+		}
 		err = InvalidateScalingStates(systemConfiguration, timeStart)
 		if err != nil {
 			log.Info("Deleted previous scheduled states")
@@ -27,6 +32,11 @@ func InvalidateOldPolicies(systemConfiguration util.SystemConfiguration, timeSta
 				invalidated = false
 				log.Fatalf("Error, policies could not be removed from db: %s",  err.Error())
 			}
+			//Release the budget expected for the policy from the invalidation on
+			err = budgetLedgerDAO.ReleaseByPolicyID(p.ID.Hex(), timeStart)
+			if err != nil {
+				log.Errorf("Error, budget of policy %s could not be released: %s", p.ID.Hex(), err.Error())
+			}
 		}
 		invalidated = true
 	} else {
@@ -36,10 +46,77 @@ func InvalidateOldPolicies(systemConfiguration util.SystemConfiguration, timeSta
 	return invalidated
 }
 
+//Invalidate the states of a policy launched from a time on, then truncate the policy at that time and release its budget
+//expected from that time on, so the policy and its spend before that time are kept
+func InvalidatePolicyFrom(systemConfiguration util.SystemConfiguration, policy types.Policy, timeInvalidation time.Time) error {
+	execution.CancelScheduling(policy.ID.Hex())
+	err := InvalidateScalingStates(systemConfiguration, timeInvalidation)
+	if err != nil {
+		return err
+	}
+	err = storage.GetPolicyDAO(systemConfiguration.MainServiceName).UpdateById(policy.ID, TruncatePolicy(policy, timeInvalidation))
+	if err != nil {
+		return err
+	}
+	err = storage.GetBudgetLedgerDAO(systemConfiguration.MainServiceName).ReleaseByPolicyID(policy.ID.Hex(), timeInvalidation)
+	if err != nil {
+		log.Errorf("Error, budget of policy %s could not be released: %s", policy.ID.Hex(), err.Error())
+	}
+	return nil
+}
+
+/* Truncate a policy at a time. The scaling actions launched from that time on are marked as invalidated
+	and the action in progress at that time ends then
+	in:
+		@policy types.Policy
+		@t time.Time
+	out:
+		@types.Policy - policy whose time window ends at t
+*/
+func TruncatePolicy(policy types.Policy, t time.Time) types.Policy {
+	scalingActions := make([]types.ScalingAction, len(policy.ScalingActions))
+	copy(scalingActions, policy.ScalingActions)
+	for i := range scalingActions {
+		if !scalingActions[i].TimeStartTransition.Before(t) {
+			scalingActions[i].Invalidated = true
+		} else if scalingActions[i].TimeEnd.After(t) {
+			scalingActions[i].TimeEnd = t
+		}
+	}
+	policy.ScalingActions = scalingActions
+	if policy.TimeWindowEnd.After(t) {
+		policy.TimeWindowEnd = t
+	}
+	return policy
+}
+
+/* Policy in force for the rest of a time window among the policies stored within it. A window split by the
+	policies derived again for its rest is covered by the last of them
+	in:
+		@policies []types.Policy
+	out:
+		@types.Policy
+		@bool - false if no policy of the window is selected
+*/
+func SelectedPolicyInForce(policies []types.Policy) (types.Policy, bool) {
+	var inForce types.Policy
+	found := false
+	for _,p := range policies {
+		if p.Status != types.SELECTED && p.Status != types.SCHEDULED {
+			continue
+		}
+		if !found || p.TimeWindowStart.After(inForce.TimeWindowStart) ||
+			(p.TimeWindowStart.Equal(inForce.TimeWindowStart) && p.TimeWindowEnd.After(inForce.TimeWindowEnd)) {
+			inForce = p
+			found = true
+		}
+	}
+	return inForce, found
+}
+
 func InvalidateScalingStates(sysConfiguration util.SystemConfiguration, timeInvalidation time.Time) error {
 	log.Info("Start request Scheduler to invalidate states")
-	statesInvalidationURL := sysConfiguration.SchedulerComponent.Endpoint+util.ENDPOINT_INVALIDATE_STATES
-	err := Sservice.InvalidateStates(timeInvalidation, statesInvalidationURL)
+	err := execution.GetExecutor(sysConfiguration.SchedulerComponent).Invalidate(timeInvalidation)
 	if err != nil {
 		log.Error("The scheduler request failed with error %s\n", err)
 	} else {
@@ -57,8 +134,7 @@ func ValidateMSCThresholds(forecast types.Forecast,  policy types.Policy, sysCon
 	index := 0
 	nPredictedValues := len(predictions)
 	for _,c := range policy.ScalingActions {
-		upperBoundCapacity := c.Metrics.RequestsCapacity
-		lowerBoundCapacity := upperBoundCapacity - (upperBoundCapacity / float64(c.DesiredState.Services[mainService].Scale))
+		lowerBoundCapacity, upperBoundCapacity := capacityBounds(c, mainService)
 
 		for  index < nPredictedValues && c.TimeEnd.After(predictions[index].TimeStamp) {
 			shouldScale = predictions[index].Requests > upperBoundCapacity || predictions[index].Requests < lowerBoundCapacity
@@ -69,4 +145,26 @@ func ValidateMSCThresholds(forecast types.Forecast,  policy types.Policy, sysCon
 		}
 	}
 	return  shouldScale
-}
\ No newline at end of file
+}
+
+//Requests that the state of a scaling action serves without one replica less or more of a service
+func capacityBounds(scalingAction types.ScalingAction, serviceName string) (float64, float64) {
+	upperBoundCapacity := scalingAction.Metrics.RequestsCapacity
+	if capacity,ok := scalingAction.Metrics.ServicesCapacity[serviceName]; ok {
+		upperBoundCapacity = capacity
+	}
+	lowerBoundCapacity := upperBoundCapacity - (upperBoundCapacity / float64(scalingAction.DesiredState.Services[serviceName].Scale))
+	return lowerBoundCapacity, upperBoundCapacity
+}
+
+//Check the forecast of each service against the capacity bounds of its replicas in the policy
+func ValidateServicesThresholds(forecasts map[string]types.Forecast, policy types.Policy, sysConfiguration util.SystemConfiguration) bool {
+	for serviceName,forecast := range forecasts {
+		serviceConfiguration := sysConfiguration
+		serviceConfiguration.MainServiceName = serviceName
+		if ValidateMSCThresholds(forecast, policy, serviceConfiguration) {
+			return true
+		}
+	}
+	return false
+}
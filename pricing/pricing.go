@@ -0,0 +1,135 @@
+package pricing
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"github.com/op/go-logging"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"errors"
+	"sort"
+	"strings"
+)
+
+var log = logging.MustGetLogger("spdt")
+
+//Unit to which all the prices are normalized
+const CANONICAL_UNIT = "hour"
+
+/* Read the prices of the VM types from a yaml or json file
+	in:
+		@path string
+	out:
+		@types.PriceModel
+		@error
+*/
+func ReadPriceModel(path string) (types.PriceModel, error) {
+	var priceModel types.PriceModel
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return priceModel, err
+	}
+	err = yaml.Unmarshal(data, &priceModel)
+	return priceModel, err
+}
+
+/* Convert a price into the price per hour
+	in:
+		@price float64
+		@unit string - second, minute, hour or month. Units of the billing configuration (s, m, h, M) are accepted
+	out:
+		@float64 - price per hour
+		@error - if the unit is not supported
+*/
+func HourlyPrice(price float64, unit string) (float64, error) {
+	if unit == util.MONTH {
+		return price / util.HOURS_PER_MONTH, nil
+	}
+	normalizedUnit := strings.ToLower(strings.TrimSpace(unit))
+	if len(normalizedUnit) > 1 {
+		normalizedUnit = strings.TrimSuffix(normalizedUnit, "s")
+	}
+	switch normalizedUnit {
+	case util.SECOND, "sec", "second":
+		return price * 3600, nil
+	case util.MINUTE, "min", "minute":
+		return price * 60, nil
+	case util.HOUR, "hr", "hour", "":
+		return price, nil
+	case "month", "mo":
+		return price / util.HOURS_PER_MONTH, nil
+	}
+	return price, errors.New("Price unit " + unit + " not supported")
+}
+
+/* Merge the prices of a price model into the VM profiles. All the prices are normalized to the price per hour.
+	The profiles keep their own price when the price model does not include their type
+	in:
+		@vmProfiles []types.VmProfile
+		@priceModel types.PriceModel
+	out:
+		@[]types.VmProfile - profiles sorted by price
+		@error - if a unit is not supported
+*/
+func ApplyPrices(vmProfiles []types.VmProfile, priceModel types.PriceModel) ([]types.VmProfile, error) {
+	prices := make(map[string]types.VMPrice)
+	for _,p := range priceModel.VMPrices {
+		prices[p.VmType] = p
+	}
+
+	pricedProfiles := []types.VmProfile{}
+	for _,profile := range vmProfiles {
+		pricing := profile.Pricing
+		unit := pricing.Unit
+		if vmPrice, ok := prices[profile.Type]; ok {
+			pricing.Price = vmPrice.Price
+			pricing.SpotPrice = vmPrice.SpotPrice
+			pricing.InterruptionRate = vmPrice.InterruptionRate
+			unit = vmPrice.Unit
+			delete(prices, profile.Type)
+		}
+		price, err := HourlyPrice(pricing.Price, unit)
+		if err != nil {
+			return vmProfiles, err
+		}
+		spotPrice,_ := HourlyPrice(pricing.SpotPrice, unit)
+		pricing.Price = price
+		pricing.SpotPrice = spotPrice
+		pricing.Unit = CANONICAL_UNIT
+		profile.Pricing = pricing
+		pricedProfiles = append(pricedProfiles, profile)
+	}
+	for vmType := range prices {
+		log.Warning("Price of VM type %s ignored, its profile is not available", vmType)
+	}
+
+	sort.Slice(pricedProfiles, func(i, j int) bool {
+		return pricedProfiles[i].Pricing.Price <= pricedProfiles[j].Pricing.Price
+	})
+	return pricedProfiles, nil
+}
+
+/* Read a price file and merge its prices into the VM profiles
+	in:
+		@vmProfiles []types.VmProfile
+		@path string - price file, if it is empty only the units of the profiles are normalized
+		@sysConfiguration util.SystemConfiguration
+	out:
+		@[]types.VmProfile
+		@error
+*/
+func LoadPrices(vmProfiles []types.VmProfile, path string, sysConfiguration util.SystemConfiguration) ([]types.VmProfile, error) {
+	var priceModel types.PriceModel
+	if path != "" {
+		var err error
+		priceModel, err = ReadPriceModel(path)
+		if err != nil {
+			return vmProfiles, err
+		}
+		if (priceModel.CSP != "" && priceModel.CSP != sysConfiguration.CSP) ||
+			(priceModel.Region != "" && priceModel.Region != sysConfiguration.Region) {
+			log.Warning("Prices of %s %s used for %s %s", priceModel.CSP, priceModel.Region, sysConfiguration.CSP, sysConfiguration.Region)
+		}
+	}
+	return ApplyPrices(vmProfiles, priceModel)
+}
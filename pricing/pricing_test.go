@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHourlyPrice(t *testing.T) {
+	expected := map[string]float64{
+		"Hour":    1,
+		util.HOUR: 1,
+		"":        1,
+		"second":  3600,
+		util.SECOND: 3600,
+		"Minutes": 60,
+		util.MINUTE: 60,
+		"month":   1.0/720,
+		util.MONTH: 1.0/720,
+	}
+	for unit, price := range expected {
+		hourlyPrice, err := HourlyPrice(1, unit)
+		if err != nil || hourlyPrice != price {
+			t.Error("For unit: ", unit, "expected: ", price, "got: ", hourlyPrice, err)
+		}
+	}
+	if _, err := HourlyPrice(1, "fortnight"); err == nil {
+		t.Error("For unit: ", "fortnight", "expected an error, got none")
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pricesFile := filepath.Join(dir, "prices.yml")
+	prices := `CSP: AWS
+region: us-east-2
+vm-prices:
+  - type: t2.large
+    price: 36
+    unit: month
+    spot-price: 18
+  - type: t2.unknown
+    price: 1
+    unit: hour
+`
+	if err = ioutil.WriteFile(pricesFile, []byte(prices), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vmProfiles := []types.VmProfile{
+		{Type:"t2.large", Pricing:types.Pricing{Price:0.0928, Unit:"Hour"}},
+		{Type:"t2.micro", Pricing:types.Pricing{Price:0.0116, Unit:"Hour"}},
+	}
+	sysConfiguration := util.SystemConfiguration{CSP:"AWS", Region:"us-east-2"}
+	pricedProfiles, err := LoadPrices(vmProfiles, pricesFile, sysConfiguration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pricedProfiles) != 2 || pricedProfiles[0].Type != "t2.micro" {
+		t.Fatal("Expected profiles sorted by price, got: ", pricedProfiles)
+	}
+	large := pricedProfiles[1].Pricing
+	if large.Price != 0.05 || large.SpotPrice != 0.025 || large.Unit != CANONICAL_UNIT {
+		t.Error("For type: ", "t2.large", "expected price: ", 0.05, 0.025, "got: ", large)
+	}
+	if micro := pricedProfiles[0].Pricing; micro.Price != 0.0116 || micro.Unit != CANONICAL_UNIT {
+		t.Error("For type: ", "t2.micro", "expected price: ", 0.0116, "got: ", micro)
+	}
+}
@@ -0,0 +1,135 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net/http"
+	"bytes"
+	"io/ioutil"
+	"errors"
+	"strconv"
+)
+
+//Annotations that bound the size of a node group for the cluster autoscaler
+const NODE_GROUP_MIN_SIZE = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+const NODE_GROUP_MAX_SIZE = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+
+const STRATEGIC_MERGE_PATCH = "application/strategic-merge-patch+json"
+const MERGE_PATCH = "application/merge-patch+json"
+
+type ObjectMeta struct {
+	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Deployment struct {
+	Metadata ObjectMeta     `json:"metadata"`
+	Spec     DeploymentSpec `json:"spec"`
+}
+
+type DeploymentSpec struct {
+	Replicas int             `json:"replicas"`
+	Template PodTemplateSpec `json:"template"`
+}
+
+type PodTemplateSpec struct {
+	Spec PodSpec `json:"spec"`
+}
+
+type PodSpec struct {
+	Containers []Container `json:"containers"`
+}
+
+type Container struct {
+	Name      string               `json:"name"`
+	Resources ResourceRequirements `json:"resources"`
+}
+
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+//Node group of the cluster managed by the Cluster API
+type MachineDeployment struct {
+	Metadata ObjectMeta            `json:"metadata"`
+	Spec     MachineDeploymentSpec `json:"spec"`
+}
+
+type MachineDeploymentSpec struct {
+	Replicas int `json:"replicas"`
+}
+
+type MachineDeploymentList struct {
+	Items []MachineDeployment `json:"items"`
+}
+
+//Client of the Kubernetes API server, the token is sent as bearer token if it is not empty
+type Client struct {
+	Endpoint string
+	Token    string
+}
+
+func (c Client) GetDeployment(namespace string, name string) (Deployment, error) {
+	deployment := Deployment{}
+	err := c.request(http.MethodGet, deploymentPath(namespace, name), "", nil, &deployment)
+	return deployment, err
+}
+
+//Patch the replicas and resources of a deployment, the containers are merged by name
+func (c Client) PatchDeployment(namespace string, name string, patch Deployment) error {
+	return c.request(http.MethodPatch, deploymentPath(namespace, name), STRATEGIC_MERGE_PATCH, patch, nil)
+}
+
+func (c Client) MachineDeployments(namespace string) ([]MachineDeployment, error) {
+	list := MachineDeploymentList{}
+	err := c.request(http.MethodGet, "/apis/cluster.x-k8s.io/v1beta1/namespaces/" + namespace + "/machinedeployments", "", nil, &list)
+	return list.Items, err
+}
+
+//Patch the replicas and annotations of the machine deployment of a node group
+func (c Client) PatchMachineDeployment(namespace string, name string, patch MachineDeployment) error {
+	return c.request(http.MethodPatch, "/apis/cluster.x-k8s.io/v1beta1/namespaces/" + namespace + "/machinedeployments/" + name,
+		MERGE_PATCH, patch, nil)
+}
+
+func deploymentPath(namespace string, name string) string {
+	return "/apis/apps/v1/namespaces/" + namespace + "/deployments/" + name
+}
+
+func (c Client) request(method string, path string, contentType string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(method, c.Endpoint + path, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer " + c.Token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		return errors.New(method + " " + path + " failed with status " + strconv.Itoa(response.StatusCode) + ": " + string(data))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//Response of a range query, each series has pairs of unix time and value
+type QueryRangeResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+/* Evaluate a query over a time range. The values of all the series returned at the same time are added
+	in:
+		@endpoint string - base URL of the Prometheus compatible API
+		@query string
+		@start time.Time
+		@end time.Time
+		@step time.Duration
+	out:
+		@[]types.ForecastedValue - requests at each step, sorted by time
+		@error
+*/
+func QueryRange(endpoint string, query string, start time.Time, end time.Time, step time.Duration) ([]types.ForecastedValue, error) {
+	values := []types.ForecastedValue{}
+	q := url.Values{}
+	q.Add("query", query)
+	q.Add("start", strconv.FormatInt(start.Unix(), 10))
+	q.Add("end", strconv.FormatInt(end.Unix(), 10))
+	q.Add("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	response, err := http.Get(endpoint + util.ENDPOINT_PROMETHEUS_QUERY_RANGE + "?" + q.Encode())
+	if err != nil {
+		return values, err
+	}
+	defer response.Body.Close()
+	queryResponse := QueryRangeResponse{}
+	err = json.NewDecoder(response.Body).Decode(&queryResponse)
+	if err != nil {
+		return values, err
+	}
+	if queryResponse.Status != "success" {
+		return values, errors.New("The query failed with error " + queryResponse.Error)
+	}
+
+	requests := make(map[int64]float64)
+	for _, series := range queryResponse.Data.Result {
+		for _, pair := range series.Values {
+			if len(pair) != 2 {
+				continue
+			}
+			timestamp, ok := pair[0].(float64)
+			valueString, okValue := pair[1].(string)
+			if !ok || !okValue {
+				continue
+			}
+			value, err := strconv.ParseFloat(valueString, 64)
+			if err != nil || math.IsNaN(value) {
+				continue
+			}
+			requests[int64(timestamp)] += value
+		}
+	}
+	for timestamp, value := range requests {
+		values = append(values, types.ForecastedValue{TimeStamp: time.Unix(timestamp, 0).UTC(), Requests: value})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].TimeStamp.Before(values[j].TimeStamp) })
+	return values, nil
+}
@@ -0,0 +1,35 @@
+package prometheus
+
+import (
+	"github.com/Cloud-Pie/SPDT/util"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != util.ENDPOINT_PROMETHEUS_QUERY_RANGE || r.URL.Query().Get("query") != "rate(requests[1m])" ||
+			r.URL.Query().Get("step") != "60" {
+			w.Write([]byte(`{"status":"error","error":"unexpected request"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"pod":"a"},"values":[[1541055660,"2"],[1541055600,"1.5"]]},
+			{"metric":{"pod":"b"},"values":[[1541055600,"0.5"],[1541055660,"NaN"]]}]}}`))
+	}))
+	defer server.Close()
+
+	start := time.Unix(1541055600, 0)
+	values, err := QueryRange(server.URL, "rate(requests[1m])", start, start.Add(time.Minute), time.Minute)
+	if err != nil || len(values) != 2 {
+		t.Fatal("Expected 2 values, got: ", values, err)
+	}
+	if !values[0].TimeStamp.Equal(start) || values[0].Requests != 2 || values[1].Requests != 2 {
+		t.Error("Expected the values of the series added and sorted by time, got: ", values)
+	}
+	if _, err := QueryRange(server.URL, "other", start, start.Add(time.Minute), time.Minute); err == nil {
+		t.Error("Expected the error of the query")
+	}
+}
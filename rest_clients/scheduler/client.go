@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"time"
 	"github.com/Cloud-Pie/SPDT/util"
+	"errors"
+	"strconv"
 )
 
 type StateToSchedule struct {
@@ -27,35 +29,52 @@ type ServiceToSchedule struct {
 type InfrastructureState struct {
 	ActiveState				StateToSchedule	`json:"active" bson:"active"`
 	LastDeployedState		StateToSchedule	`json:"lastDeployed" bson:"lastDeployed"`
-	isStateTrue				bool	`json:"isStateTrue" bson:"isStateTrue"`
+	IsStateTrue				bool	`json:"isStateTrue" bson:"isStateTrue"`	//The active state is the last deployed state
 }
 
 func CreateState(stateToSchedule StateToSchedule, endpoint string) error {
 	jsonValue, _ := json.Marshal(stateToSchedule)
-	_, err := http.Post(endpoint, "application/json", bytes.NewBuffer(jsonValue))
-	return err
+	response, err := http.Post(endpoint, "application/json", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return responseError(response)
+}
+
+//Error of a response whose status is not successful
+func responseError(response *http.Response) error {
+	if response.StatusCode < 300 {
+		return nil
+	}
+	data, _ := ioutil.ReadAll(response.Body)
+	return errors.New("The scheduler responded with status " + strconv.Itoa(response.StatusCode) + ": " + string(data))
 }
 
 
 func InfraCurrentState(endpoint string) (StateToSchedule, error) {
-	currentState := StateToSchedule{}
+	infrastructureState, err := InfraState(endpoint)
+	return infrastructureState.ActiveState, err
+}
+
+//Active and last deployed states of the infrastructure
+func InfraState(endpoint string) (InfrastructureState, error) {
 	infrastructureState := InfrastructureState{}
 	response, err := http.Get(endpoint)
 	if err != nil {
-		return currentState, err
+		return infrastructureState, err
 	}
 
 	defer response.Body.Close()
+	if err = responseError(response); err != nil {
+		return infrastructureState, err
+	}
 	data, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return  currentState, err
+		return  infrastructureState, err
 	}
 	err = json.Unmarshal(data, &infrastructureState)
-	if err != nil {
-		return  currentState, err
-	}
-	currentState = infrastructureState.ActiveState
-	return  currentState, err
+	return  infrastructureState, err
 }
 
 func InvalidateStates(timestamp time.Time,endpoint string) (error) {
@@ -67,6 +86,9 @@ func InvalidateStates(timestamp time.Time,endpoint string) (error) {
 		return  err
 	}
 	defer response.Body.Close()
+	if err = responseError(response); err != nil {
+		return err
+	}
 	_,err = ioutil.ReadAll(response.Body)
 	if err != nil {
 		return   err
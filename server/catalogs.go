@@ -0,0 +1,75 @@
+package server
+
+import (
+	"github.com/Cloud-Pie/SPDT/planner/derivation"
+	"github.com/Cloud-Pie/SPDT/planner/execution"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"time"
+)
+
+/* Derive the policies of the application with the VM profiles of each configured catalog
+	and compare the selected policies. Nothing is stored nor scheduled
+	in:
+		@timeStart time.Time
+		@timeEnd time.Time
+		@sysConfiguration SystemConfiguration
+	out:
+		@[]types.CatalogPolicy - selected policy of each catalog, the cheapest first
+		@error
+*/
+func CompareCatalogs(timeStart time.Time, timeEnd time.Time, sysConfiguration util.SystemConfiguration) ([]types.CatalogPolicy, error) {
+	catalogPolicies := []types.CatalogPolicy{}
+	//Request Performance Profiles
+	err := FetchApplicationProfile(sysConfiguration)
+	if err != nil {
+		return catalogPolicies,err
+	}
+	//Request Forecasting
+	forecasts,err := requestServiceForecasts(sysConfiguration, timeStart, timeEnd)
+	if err != nil {
+		return catalogPolicies,err
+	}
+	log.Info("Request current state" )
+	currentState,err := execution.CurrentState(sysConfiguration)
+	if err != nil {
+		return catalogPolicies,err
+	}
+	return compareCatalogsFromState(currentState, sysConfiguration, forecasts), nil
+}
+
+//Derive and select the policy of each catalog starting from a given current state
+func compareCatalogsFromState(currentState types.State, sysConfiguration util.SystemConfiguration,
+	forecasts map[string]types.Forecast) []types.CatalogPolicy {
+	catalogPolicies := []types.CatalogPolicy{}
+	for _,catalogConfiguration := range sysConfiguration.CatalogConfigurations() {
+		catalogSysConfiguration := sysConfiguration.ForCatalog(catalogConfiguration)
+		catalog := types.Catalog{CSP:catalogConfiguration.CSP, Region:catalogConfiguration.Region}
+		vmProfiles,err := readVMProfilesFile(catalogConfiguration.VMProfilesFile, catalogSysConfiguration)
+		var bootingProfiles []types.InstancesBootShutdownTime
+		if err == nil {
+			bootingProfiles,err = catalogBootingProfiles(catalogConfiguration, catalogSysConfiguration, vmProfiles)
+		}
+		if err != nil {
+			catalogPolicies = append(catalogPolicies, types.CatalogPolicy{CSP:catalog.CSP, Region:catalog.Region, Error:err.Error()})
+			continue
+		}
+		catalog.VMProfiles = vmProfiles
+		catalog.BootingProfiles = bootingProfiles
+		log.Infof("Derive policies for %s %s", catalog.CSP, catalog.Region)
+		catalogPolicies = append(catalogPolicies, derivation.CatalogPolicy(currentState, catalog, catalogSysConfiguration, forecasts))
+	}
+	derivation.SortCatalogPolicies(catalogPolicies)
+	return catalogPolicies
+}
+
+//Booting and shutdown times of the catalog file, or requested for the provider and region of the catalog. They are not stored
+func catalogBootingProfiles(catalogConfiguration util.CatalogConfiguration, sysConfiguration util.SystemConfiguration,
+	vmProfiles []types.VmProfile) ([]types.InstancesBootShutdownTime, error) {
+	if catalogConfiguration.BootTimesFile == "" {
+		return requestVMBootingProfiles(sysConfiguration, vmProfiles)
+	}
+	var vmBootingProfiles []types.InstancesBootShutdownTime
+	err := readJSONFile(catalogConfiguration.BootTimesFile, &vmBootingProfiles)
+	return vmBootingProfiles, err
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"github.com/Cloud-Pie/SPDT/planner/updatesHandler"
+	"github.com/Cloud-Pie/SPDT/rest_clients/prometheus"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"strings"
+	"time"
+)
+
+//Requests of the main service observed out of the bounds of the selected policy, guarded by derivationLock
+var observedLoadStreak updatesHandler.OutOfBoundsStreak
+
+//Periodically pull the observed requests per second of each service from the observed load component
+func pullObservedLoad(sysConfiguration util.SystemConfiguration) {
+	component := sysConfiguration.ObservedLoadComponent
+	if component.Endpoint == "" {
+		return
+	}
+	interval := component.Interval
+	if interval == 0 {
+		interval = util.DEFAULT_OBSERVED_LOAD_INTERVAL
+	}
+	step := component.Step
+	if step == 0 {
+		step = util.DEFAULT_OBSERVED_LOAD_STEP
+	}
+	pullingInterval := time.Duration(interval * float64(time.Second))
+	timeStart := time.Now().Add(-pullingInterval)
+	for {
+		time.Sleep(pullingInterval)
+		timeEnd := time.Now()
+		for _, serviceName := range sysConfiguration.ServiceNames() {
+			query := strings.Replace(component.Query, "{service}", serviceName, -1)
+			observedValues, err := prometheus.QueryRange(component.Endpoint, query, timeStart, timeEnd, time.Duration(step * float64(time.Second)))
+			if err != nil {
+				log.Errorf("The observed requests of service %s could not be pulled. Error %s", serviceName, err)
+				continue
+			}
+			observedValues = updatesHandler.PerSecondToGranularity(observedValues, sysConfiguration.ForecastComponent.Granularity)
+			_, err = ingestObservedLoad(sysConfiguration, serviceName, observedValues, timeEnd)
+			if err != nil {
+				log.Errorf("The observed requests of service %s could not be stored. Error %s", serviceName, err)
+			}
+		}
+		timeStart = timeEnd
+	}
+}
+
+/* Store the observed requests of a service next to its forecast and measure the error of the forecast.
+	If consecutive requests of the main service break the capacity bounds of the selected policy, the policy is
+	invalidated and a new one is derived for the rest of its time window
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@serviceName string
+		@observedValues []types.ForecastedValue - requests in a unit of the granularity of the forecasts
+		@t time.Time - start of the rest of the window if a new policy is derived
+	out:
+		@types.ForecastError - error of the forecast of the last observed value
+		@error
+*/
+func ingestObservedLoad(sysConfiguration util.SystemConfiguration, serviceName string, observedValues []types.ForecastedValue,
+	t time.Time) (types.ForecastError, error) {
+	forecastError := types.ForecastError{}
+	if len(observedValues) == 0 {
+		return forecastError, nil
+	}
+	derivationLock.Lock()
+	defer derivationLock.Unlock()
+	forecastDAO := storage.GetForecastDAO(serviceName)
+	storedForecasts, err := forecastDAO.FindAll()
+	if err != nil {
+		return forecastError, err
+	}
+	last := observedValues[0]
+	for _, v := range observedValues {
+		if v.TimeStamp.After(last.TimeStamp) {
+			last = v
+		}
+	}
+	for _, forecast := range storedForecasts {
+		forecast, added := updatesHandler.AddObservedValues(forecast, observedValues)
+		if added == 0 {
+			continue
+		}
+		err = forecastDAO.Update(forecast.IDdb, forecast)
+		if err != nil {
+			return forecastError, err
+		}
+		if !forecast.TimeWindowStart.After(last.TimeStamp) && forecast.TimeWindowEnd.After(last.TimeStamp) {
+			forecastError = updatesHandler.ForecastError(forecast)
+			log.Infof("Forecast error of service %s: MAPE %.2f%%, bias %.2f%% over %d values",
+				serviceName, forecastError.MAPE, forecastError.Bias, forecastError.Samples)
+		}
+	}
+
+	if serviceName != sysConfiguration.MainServiceName {
+		return forecastError, nil
+	}
+	policy, err := storage.GetPolicyDAO(serviceName).FindSelectedByTime(last.TimeStamp)
+	if err != nil {
+		return forecastError, nil
+	}
+	violations := sysConfiguration.ObservedLoadComponent.Violations
+	if violations == 0 {
+		violations = util.DEFAULT_OBSERVED_LOAD_VIOLATIONS
+	}
+	observedLoadStreak.Add(observedValues, policy, sysConfiguration)
+	if observedLoadStreak.Count >= violations {
+		log.Warningf("The requests observed since %s break the capacity bounds of policy %s", observedLoadStreak.Start, policy.ID.Hex())
+		observedLoadStreak = updatesHandler.OutOfBoundsStreak{}
+		//The policy replaced is the one in force now, the values observed may precede a policy derived again since
+		current, err := storage.GetPolicyDAO(serviceName).FindSelectedByTime(t)
+		if err != nil {
+			log.Warningf("No selected policy at %s to derive again", t)
+			return forecastError, nil
+		}
+		forecasts, err := remainingForecasts(sysConfiguration, t)
+		if err == nil {
+			//The rest of the forecast is corrected with the bias observed so far, if any value was compared
+			if forecastError.Samples > 0 {
+				forecasts[serviceName] = updatesHandler.CorrectForecast(forecasts[serviceName], forecastError)
+			}
+			_, err = rederivePolicy(sysConfiguration, current, forecasts, t)
+		}
+		if err != nil {
+			log.Errorf("The policy could not be derived again. Error %s", err)
+		}
+	}
+	return forecastError, nil
+}
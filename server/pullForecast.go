@@ -9,11 +9,15 @@ import (
 	"github.com/Cloud-Pie/SPDT/types"
 	"fmt"
 	"github.com/Cloud-Pie/SPDT/planner/updatesHandler"
+	"github.com/Cloud-Pie/SPDT/planner/derivation"
+	"github.com/Cloud-Pie/SPDT/planner/forecaster"
 )
 
 var requestsCapacityPerState types.RequestCapacitySupply
 
 func StartPolicyDerivation(timeStart time.Time, timeEnd time.Time, sysConfiguration util.SystemConfiguration) (types.Policy, error) {
+	derivationLock.Lock()
+	defer derivationLock.Unlock()
 	var selectedPolicy types.Policy
 	mainService := sysConfiguration.MainServiceName
 
@@ -23,13 +27,14 @@ func StartPolicyDerivation(timeStart time.Time, timeEnd time.Time, sysConfigurat
 		return types.Policy{},error
 	}
 	//Request Forecasting
-	forecast,err := fetchForecast(sysConfiguration, timeStart, timeEnd)
+	forecasts,err := fetchServiceForecasts(sysConfiguration, timeStart, timeEnd)
 	if err != nil {
 		return types.Policy{},err
 	}
+	forecast := forecasts[mainService]
 
 	//Get VM Profiles
-	vmProfiles,err := ReadVMProfiles()
+	vmProfiles,err := ReadVMProfiles(sysConfiguration)
 	if err != nil {
 		return types.Policy{},err
 	}
@@ -41,17 +46,15 @@ func StartPolicyDerivation(timeStart time.Time, timeEnd time.Time, sysConfigurat
 
 	updateForecastInDB(forecast, sysConfiguration)
 
-	policyDAO := storage.GetPolicyDAO(mainService)
-	storedPolicy, err := policyDAO.FindSelectedByTimeWindow(timeStart, timeEnd)
+	//The window may be split by the policies derived again for its rest
+	storedPolicy, err := selectedPolicyInWindow(sysConfiguration, timeStart, timeEnd)
 	if err != nil {
-		selectedPolicy,err = setNewPolicy(forecast, sysConfiguration, vmProfiles)
+		selectedPolicy,err = setNewPolicy(forecasts, sysConfiguration, vmProfiles)
 		ScheduleScaling(sysConfiguration, selectedPolicy)
 	}else {
-		shouldUpdate := updatesHandler.ValidateMSCThresholds(forecast,storedPolicy, sysConfiguration)
+		shouldUpdate := updatesHandler.ValidateServicesThresholds(forecastsFrom(forecasts, storedPolicy.TimeWindowStart),storedPolicy, sysConfiguration)
 		if shouldUpdate {
-			updatesHandler.InvalidateOldPolicies(sysConfiguration, timeStart, timeEnd )
-			selectedPolicy,err = setNewPolicy(forecast, sysConfiguration, vmProfiles)
-			ScheduleScaling(sysConfiguration, selectedPolicy)
+			selectedPolicy,err = replaceWindowPolicy(sysConfiguration, storedPolicy, forecasts, vmProfiles, timeStart, timeEnd, time.Now())
 			if err != nil {
 				return types.Policy{},err
 			}
@@ -61,22 +64,73 @@ func StartPolicyDerivation(timeStart time.Time, timeEnd time.Time, sysConfigurat
 	return selectedPolicy, err
 }
 
-func fetchForecast(sysConfiguration util.SystemConfiguration, timeStart time.Time, timeEnd time.Time) (types.Forecast,  error) {
+//Derive and evaluate the policies for the time window without storing or scheduling them
+func DryRunPolicyDerivation(timeStart time.Time, timeEnd time.Time, sysConfiguration util.SystemConfiguration) ([]types.Policy, error) {
+	//Request Performance Profiles
+	err := FetchApplicationProfile(sysConfiguration)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	//Request Forecasting
+	forecasts,err := requestServiceForecasts(sysConfiguration, timeStart, timeEnd)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	forecast := forecasts[sysConfiguration.MainServiceName]
+	//Get VM Profiles
+	vmProfiles,err := ReadVMProfiles(sysConfiguration)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	//Get VM booting Profiles
+	err = FetchVMBootingProfiles(sysConfiguration, vmProfiles)
+	if err != nil {
+		return []types.Policy{},err
+	}
 
-	forecastURL := sysConfiguration.ForecastComponent.Endpoint + util.ENDPOINT_FORECAST
-	mainService := sysConfiguration.MainServiceName
+	candidatePolicies,err := derivation.ApplicationPolicies(vmProfiles, sysConfiguration, forecasts)
+	if err != nil {
+		return candidatePolicies,err
+	}
+	_,err = derivation.SelectPolicy(&candidatePolicies, sysConfiguration, vmProfiles, forecast)
+	return candidatePolicies,err
+}
 
-	//Request Forecasting
-	log.Info("Start request Forecasting")
-	forecast,err := Fservice.GetForecast(forecastURL, timeStart, timeEnd)
+//Request the forecast of every service of the application without storing it
+func requestServiceForecasts(sysConfiguration util.SystemConfiguration, timeStart time.Time, timeEnd time.Time) (map[string]types.Forecast, error) {
+	forecasts := make(map[string]types.Forecast)
+	for _,serviceName := range sysConfiguration.ServiceNames() {
+		forecast,err := requestForecast(sysConfiguration, serviceName, timeStart, timeEnd)
+		if err != nil {
+			return forecasts,err
+		}
+		forecasts[serviceName] = forecast
+	}
+	return forecasts, nil
+}
+
+//Request and store the forecast of every service of the application
+func fetchServiceForecasts(sysConfiguration util.SystemConfiguration, timeStart time.Time, timeEnd time.Time) (map[string]types.Forecast, error) {
+	forecasts := make(map[string]types.Forecast)
+	for _,serviceName := range sysConfiguration.ServiceNames() {
+		forecast,err := fetchForecast(sysConfiguration, serviceName, timeStart, timeEnd)
+		if err != nil {
+			return forecasts,err
+		}
+		forecasts[serviceName] = forecast
+	}
+	return forecasts, nil
+}
+
+func fetchForecast(sysConfiguration util.SystemConfiguration, serviceName string, timeStart time.Time, timeEnd time.Time) (types.Forecast,  error) {
+
+	forecast,err := requestForecast(sysConfiguration, serviceName, timeStart, timeEnd)
 	if err != nil {
 		return types.Forecast{},err
-	} else {
-		log.Info("Finish request Forecasting")
 	}
 
 	//Retrieve data access to the database for forecasting
-	forecastDAO := storage.GetForecastDAO(mainService)
+	forecastDAO := storage.GetForecastDAO(serviceName)
 	//Check if already exist, then update
 	resultQuery,err := forecastDAO.FindOneByTimeWindow(timeStart, timeEnd)
 
@@ -90,7 +144,9 @@ func fetchForecast(sysConfiguration util.SystemConfiguration, timeStart time.Tim
 	} else if resultQuery.IDdb != "" {
 		id := resultQuery.IDdb
 		forecast.IDdb = id
-		if resultQuery.IDPrediction != forecast.IDPrediction {
+		forecast.ObservedValues = resultQuery.ObservedValues
+		//Updates are only handled for the forecast of the main service
+		if resultQuery.IDPrediction != forecast.IDPrediction && forecast.IDPrediction != "" && serviceName == sysConfiguration.MainServiceName {
 			subscribeForecastingUpdates(sysConfiguration, forecast.IDPrediction)
 		}
 		forecastDAO.Update(id, forecast)
@@ -100,6 +156,53 @@ func fetchForecast(sysConfiguration util.SystemConfiguration, timeStart time.Tim
 
 
 
+/* Request the forecast of a service to the forecasting component or to the native forecaster,
+	according to the mode of the native forecaster
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@serviceName string
+		@timeStart time.Time
+		@timeEnd time.Time
+	out:
+		@types.Forecast
+		@error
+*/
+func requestForecast(sysConfiguration util.SystemConfiguration, serviceName string, timeStart time.Time, timeEnd time.Time) (types.Forecast, error) {
+	mode := sysConfiguration.ForecastComponent.NativeForecaster.Mode
+	if mode == util.NATIVE_FORECASTER_PRIMARY {
+		return nativeForecast(sysConfiguration, serviceName, timeStart, timeEnd)
+	}
+
+	forecastURL := sysConfiguration.ForecastEndpoint(serviceName) + util.ENDPOINT_FORECAST
+	log.Info("Start request Forecasting for service %s", serviceName)
+	forecast,err := Fservice.GetForecast(forecastURL, timeStart, timeEnd)
+	if err != nil && mode == util.NATIVE_FORECASTER_FALLBACK {
+		log.Warningf("Forecasting component not available, the native forecaster is used. Error %s", err.Error())
+		return nativeForecast(sysConfiguration, serviceName, timeStart, timeEnd)
+	} else if err != nil {
+		return types.Forecast{},err
+	}
+	log.Info("Finish request Forecasting")
+	return forecast, nil
+}
+
+//Forecast of a service predicted by the native forecaster from the load observed in its stored forecasts
+func nativeForecast(sysConfiguration util.SystemConfiguration, serviceName string, timeStart time.Time, timeEnd time.Time) (types.Forecast, error) {
+	storedForecasts,err := storage.GetForecastDAO(serviceName).FindAll()
+	if err != nil {
+		return types.Forecast{},err
+	}
+	settings := sysConfiguration.ForecastComponent.NativeForecaster
+	log.Infof("Start native forecast for service %s with method %s", serviceName, settings.Method)
+	forecast,err := forecaster.Forecast(forecaster.History(storedForecasts), timeStart, timeEnd,
+		sysConfiguration.ForecastComponent.Granularity, settings)
+	if err != nil {
+		return types.Forecast{},err
+	}
+	forecast.ServiceName = serviceName
+	return forecast, nil
+}
+
 func subscribeForecastingUpdates(sysConfiguration util.SystemConfiguration, idPrediction string){
 	log.Info("Start subscribe to prediction updates")
 	forecastUpdatesURL := sysConfiguration.ForecastComponent.Endpoint + util.ENDPOINT_SUBSCRIBE_NOTIFICATIONS
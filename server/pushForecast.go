@@ -7,13 +7,14 @@ import (
 	"github.com/Cloud-Pie/SPDT/util"
 	"fmt"
 	"gopkg.in/mgo.v2/bson"
+	"time"
 )
 
 func updatePolicyDerivation(forecastChannel chan types.Forecast) {
 	for forecast := range forecastChannel {
 		timeStart := forecast.TimeWindowStart
 		timeEnd := forecast.TimeWindowEnd
-		mainService := sysConfiguration.MainServiceName
+		derivationLock.Lock()
 
 		//Read Configuration File
 		sysConfiguration,_ := util.ReadConfigFile(util.CONFIG_FILE)
@@ -23,7 +24,7 @@ func updatePolicyDerivation(forecastChannel chan types.Forecast) {
 		//Request Performance Profiles
 		FetchApplicationProfile(sysConfiguration)
 		//Get VM Profiles
-		vmProfiles,err := ReadVMProfiles()
+		vmProfiles,err := ReadVMProfiles(sysConfiguration)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -33,16 +34,19 @@ func updatePolicyDerivation(forecastChannel chan types.Forecast) {
 			fmt.Println(err)
 		}
 		updateForecastInDB(forecast, sysConfiguration)
-		policyDAO := storage.GetPolicyDAO(mainService)
-		storedPolicy, err := policyDAO.FindSelectedByTimeWindow(timeStart, timeEnd)
-		shouldUpdate := updatesHandler.ValidateMSCThresholds(forecast,storedPolicy, sysConfiguration)
+		//The window may be split by the policies derived again for its rest
+		storedPolicy, err := selectedPolicyInWindow(sysConfiguration, timeStart, timeEnd)
+		forecasts := storedServiceForecasts(forecast, sysConfiguration)
+		shouldUpdate := updatesHandler.ValidateServicesThresholds(forecastsFrom(forecasts, storedPolicy.TimeWindowStart),storedPolicy, sysConfiguration)
 		if shouldUpdate {
-			updatesHandler.InvalidateOldPolicies(sysConfiguration, timeStart, timeEnd )
-			selectedPolicy,_ := setNewPolicy(forecast, sysConfiguration, vmProfiles)
-			ScheduleScaling(sysConfiguration, selectedPolicy)
+			_,err = replaceWindowPolicy(sysConfiguration, storedPolicy, forecasts, vmProfiles, timeStart, timeEnd, time.Now())
+			if err != nil {
+				log.Errorf("The policy could not be derived again. Error %s", err)
+			}
 		} else {
 			log.Info("Forecast updated. Scaling policy is still valid")
 		}
+		derivationLock.Unlock()
 	}
 }
 
@@ -66,10 +70,30 @@ func updateForecastInDB(forecast types.Forecast, sysConfiguration util.SystemCon
 	} else if resultQuery.IDdb != "" {
 		id := resultQuery.IDdb
 		forecast.IDdb = id
+		forecast.ObservedValues = resultQuery.ObservedValues
 		if resultQuery.IDPrediction != forecast.IDPrediction {
 			subscribeForecastingUpdates(sysConfiguration, forecast.IDPrediction)
 		}
 		forecastDAO.Update(id, forecast)
 	}
 	return err
+}
+
+//Forecasts of all the services for the time window of the updated forecast of the main service
+func storedServiceForecasts(forecast types.Forecast, sysConfiguration util.SystemConfiguration) map[string]types.Forecast {
+	forecasts := make(map[string]types.Forecast)
+	for _,serviceName := range sysConfiguration.ServiceNames() {
+		if serviceName == sysConfiguration.MainServiceName {
+			forecasts[serviceName] = forecast
+			continue
+		}
+		forecastDAO := storage.GetForecastDAO(serviceName)
+		serviceForecast,err := forecastDAO.FindOneByTimeWindow(forecast.TimeWindowStart, forecast.TimeWindowEnd)
+		if err != nil {
+			log.Errorf("Forecast of service %s not available. Details: %s", serviceName, err)
+			continue
+		}
+		forecasts[serviceName] = serviceForecast
+	}
+	return forecasts
 }
\ No newline at end of file
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"github.com/Cloud-Pie/SPDT/planner/execution"
+	"github.com/Cloud-Pie/SPDT/planner/updatesHandler"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"errors"
+	"sync"
+	"time"
+)
+
+//Maximum number of drifts kept for the drift endpoint
+const MAX_STATE_DRIFTS = 100
+
+//Drifts detected by the reconciler, the most recent last
+var stateDrifts = struct {
+	sync.Mutex
+	drifts []types.StateDrift
+}{}
+
+//Serializes the derivation, invalidation and scheduling of the policies of the background tasks
+var derivationLock sync.Mutex
+
+//Delay between the derivations triggered by a persistent drift, guarded by derivationLock
+var driftBackoff updatesHandler.RederivationBackoff
+
+//Periodically compare the actual state of the infrastructure with the state expected by the selected policy
+func reconcileState(sysConfiguration util.SystemConfiguration) {
+	interval := sysConfiguration.Reconciliation.Interval
+	if interval < 0 {
+		log.Info("Reconciliation disabled")
+		return
+	}
+	if interval == 0 {
+		interval = util.DEFAULT_RECONCILIATION_INTERVAL
+	}
+	for {
+		time.Sleep(time.Duration(interval * float64(time.Second)))
+		reconcile(sysConfiguration, time.Now())
+	}
+}
+
+/* Compare the actual state with the state the selected policy expects at a time, and derive a new policy
+	for the rest of its window from the actual state if the drift exceeds the threshold. While the drift persists,
+	the next derivation waits the tolerance and twice as long before each later one, up to the maximum backoff
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@t time.Time
+	out:
+		@types.StateDrift
+		@bool - false if there is no state to compare
+*/
+func reconcile(sysConfiguration util.SystemConfiguration, t time.Time) (types.StateDrift, bool) {
+	derivationLock.Lock()
+	defer derivationLock.Unlock()
+	policy, err := storage.GetPolicyDAO(sysConfiguration.MainServiceName).FindSelectedByTime(t)
+	if err != nil {
+		return types.StateDrift{}, false
+	}
+	actualState, inTransition, err := infrastructureState(sysConfiguration)
+	if err != nil {
+		log.Errorf("The actual state could not be retrieved. Error %s", err)
+		return types.StateDrift{}, false
+	}
+	tolerance := sysConfiguration.Reconciliation.Tolerance
+	if tolerance == 0 {
+		tolerance = util.DEFAULT_RECONCILIATION_TOLERANCE
+	}
+	drift, ok := updatesHandler.StateDrift(policy, actualState, inTransition, t, time.Duration(tolerance * float64(time.Second)))
+	if !ok {
+		return drift, false
+	}
+	if drift.Magnitude > 0 {
+		log.Warningf("Drift of %.2f from the state expected by policy %s. Missing VMs %v, extra VMs %v, wrong replicas %v, late transition %t",
+			drift.Magnitude, drift.PolicyID, drift.MissingVMs, drift.ExtraVMs, drift.WrongReplicas, drift.LateTransition)
+	}
+	threshold := sysConfiguration.Reconciliation.DriftThreshold
+	if threshold == 0 {
+		threshold = util.DEFAULT_DRIFT_THRESHOLD
+	}
+	maxBackoff := sysConfiguration.Reconciliation.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = util.DEFAULT_DRIFT_MAX_BACKOFF
+	}
+	if drift.Magnitude <= threshold {
+		driftBackoff.Reset()
+	} else if !driftBackoff.Allow(t) {
+		log.Warningf("The drift from policy %s persists, a new policy is not derived again yet", drift.PolicyID)
+	} else {
+		next := driftBackoff.Rederived(t, time.Duration(tolerance * float64(time.Second)), time.Duration(maxBackoff * float64(time.Second)))
+		log.Infof("A new policy is derived from the actual state, the next derivation for a drift is not before %s", next)
+		var forecasts map[string]types.Forecast
+		forecasts, err = remainingForecasts(sysConfiguration, t)
+		if err == nil {
+			_, err = rederivePolicy(sysConfiguration, policy, forecasts, t)
+		}
+		if err != nil {
+			log.Errorf("The policy could not be derived again from the actual state. Error %s", err)
+		}
+		drift.Rederived = err == nil
+	}
+	recordDrift(drift)
+	return drift, true
+}
+
+//Actual state and whether the scheduler is still deploying, only known for the SPDT scheduler
+func infrastructureState(sysConfiguration util.SystemConfiguration) (types.State, bool, error) {
+	executor := execution.GetExecutor(sysConfiguration.SchedulerComponent)
+	if schedulerExecutor, ok := executor.(*execution.SchedulerExecutor); ok {
+		return schedulerExecutor.InfrastructureState()
+	}
+	state, err := executor.CurrentState(sysConfiguration.ServiceNames())
+	return state, false, err
+}
+
+func recordDrift(drift types.StateDrift) {
+	stateDrifts.Lock()
+	defer stateDrifts.Unlock()
+	stateDrifts.drifts = append(stateDrifts.drifts, drift)
+	if len(stateDrifts.drifts) > MAX_STATE_DRIFTS {
+		stateDrifts.drifts = stateDrifts.drifts[len(stateDrifts.drifts) - MAX_STATE_DRIFTS:]
+	}
+}
+
+/* Replace a policy by a policy derived from the current state for the rest of its time window
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@policy types.Policy - policy to replace
+		@forecasts map[string]types.Forecast - forecast of each service for the rest of the window
+		@t time.Time - start of the rest of the window
+	out:
+		@types.Policy - new selected policy
+		@error
+*/
+func rederivePolicy(sysConfiguration util.SystemConfiguration, policy types.Policy, forecasts map[string]types.Forecast,
+	t time.Time) (types.Policy, error) {
+	vmProfiles, err := ReadVMProfiles(sysConfiguration)
+	if err != nil {
+		return types.Policy{}, err
+	}
+	err = updatesHandler.InvalidatePolicyFrom(sysConfiguration, policy, t)
+	if err != nil {
+		return types.Policy{}, err
+	}
+	selectedPolicy, err := setNewPolicy(forecasts, sysConfiguration, vmProfiles)
+	if err != nil {
+		return selectedPolicy, err
+	}
+	ScheduleScaling(sysConfiguration, selectedPolicy)
+	return selectedPolicy, nil
+}
+
+/* Selected policy in force for the rest of a time window, which is the last policy derived again for it
+	if the window was split by a rederivation
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@timeStart time.Time
+		@timeEnd time.Time
+	out:
+		@types.Policy
+		@error
+*/
+func selectedPolicyInWindow(sysConfiguration util.SystemConfiguration, timeStart time.Time, timeEnd time.Time) (types.Policy, error) {
+	policies, err := storage.GetPolicyDAO(sysConfiguration.MainServiceName).FindAllByTimeWindow(timeStart, timeEnd)
+	if err != nil {
+		return types.Policy{}, err
+	}
+	policy, ok := updatesHandler.SelectedPolicyInForce(policies)
+	if !ok {
+		return types.Policy{}, errors.New("No selected policy for the window")
+	}
+	return policy, nil
+}
+
+/* Replace the selected policy of a time window whose forecast changed. A policy for the whole window replaces the
+	policies of the window. A policy derived again for the rest of the window is only replaced from its start,
+	or from now if it already started, so the scalings and the budget of the window are not duplicated
+	in:
+		@sysConfiguration util.SystemConfiguration
+		@policy types.Policy - selected policy in force for the rest of the window
+		@forecasts map[string]types.Forecast - forecast of each service for the whole window
+		@vmProfiles []types.VmProfile
+		@timeStart time.Time
+		@timeEnd time.Time
+		@now time.Time
+	out:
+		@types.Policy - new selected policy
+		@error
+*/
+func replaceWindowPolicy(sysConfiguration util.SystemConfiguration, policy types.Policy, forecasts map[string]types.Forecast,
+	vmProfiles []types.VmProfile, timeStart time.Time, timeEnd time.Time, now time.Time) (types.Policy, error) {
+	if !policy.TimeWindowStart.After(timeStart) {
+		updatesHandler.InvalidateOldPolicies(sysConfiguration, timeStart, timeEnd)
+		selectedPolicy, err := setNewPolicy(forecasts, sysConfiguration, vmProfiles)
+		ScheduleScaling(sysConfiguration, selectedPolicy)
+		return selectedPolicy, err
+	}
+	t := policy.TimeWindowStart
+	if now.After(t) {
+		t = now
+	}
+	if !t.Before(policy.TimeWindowEnd) {
+		log.Infof("The window of policy %s is over, it is not replaced", policy.ID.Hex())
+		return policy, nil
+	}
+	return rederivePolicy(sysConfiguration, policy, forecastsFrom(forecasts, t), t)
+}
+
+//Stored forecast of each service whose window contains a time, without the values that ended before that time
+func remainingForecasts(sysConfiguration util.SystemConfiguration, t time.Time) (map[string]types.Forecast, error) {
+	forecasts := make(map[string]types.Forecast)
+	for _, serviceName := range sysConfiguration.ServiceNames() {
+		forecast, err := storedForecastAt(serviceName, t)
+		if err != nil {
+			return forecasts, err
+		}
+		forecasts[serviceName] = forecast
+	}
+	return forecastsFrom(forecasts, t), nil
+}
+
+//Forecast of each service from a time on, without the values that ended before that time
+func forecastsFrom(forecasts map[string]types.Forecast, t time.Time) map[string]types.Forecast {
+	remaining := make(map[string]types.Forecast)
+	for serviceName, forecast := range forecasts {
+		first := 0
+		for i, value := range forecast.ForecastedValues {
+			if !value.TimeStamp.After(t) {
+				first = i
+			}
+		}
+		forecast.ForecastedValues = forecast.ForecastedValues[first:]
+		forecast.TimeWindowStart = t
+		remaining[serviceName] = forecast
+	}
+	return remaining
+}
+
+//Stored forecast of a service whose time window contains a time
+func storedForecastAt(serviceName string, t time.Time) (types.Forecast, error) {
+	storedForecasts, err := storage.GetForecastDAO(serviceName).FindAll()
+	if err != nil {
+		return types.Forecast{}, err
+	}
+	for _, forecast := range storedForecasts {
+		if !forecast.TimeWindowStart.After(t) && forecast.TimeWindowEnd.After(t) {
+			return forecast, nil
+		}
+	}
+	return types.Forecast{}, errors.New("No forecast of service " + serviceName + " at " + t.Format(util.UTC_TIME_LAYOUT))
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/Cloud-Pie/SPDT/util"
 	"github.com/Cloud-Pie/SPDT/types"
 	"time"
+	"github.com/Cloud-Pie/SPDT/planner/derivation"
+	"github.com/Cloud-Pie/SPDT/planner/updatesHandler"
 )
 
 var forecastChannel chan types.Forecast
@@ -27,6 +29,11 @@ func SetUpServer( fc chan types.Forecast ) *gin.Engine {
 	router.DELETE("/api/:service/policies", deletePolicyWindow)
 	router.PUT("/api/:service/policies/:id", invalidatePolicyByID)
 	router.GET("/api/:service/forecast", getForecast)
+	router.GET("/api/:service/pareto-front", getParetoFront)
+	router.GET("/api/:service/budget", getBudget)
+	router.GET("/api/:service/drift", getDrift)
+	router.POST("/api/:service/observed", postObservedLoad)
+	router.GET("/api/:service/forecast-error", getForecastError)
 
 	return router
 }
@@ -37,7 +44,6 @@ func policyByID(c *gin.Context) {
 	id := c.Param("id")
 	serviceName := c.Param("service")
 	policyDAO := db.GetPolicyDAO(serviceName)
-	policyDAO.Connect()
 	policy,err := policyDAO.FindByID(id)
 
 	if err != nil {
@@ -56,6 +62,10 @@ func deletePolicyByID(c *gin.Context) {
 	if err != nil {
 		c.JSON(http.StatusBadRequest, err.Error())
 	}
+	//The spend until now is kept in the budget
+	if err = db.GetBudgetLedgerDAO(serviceName).ReleaseByPolicyID(id, time.Now()); err != nil {
+		log.Errorf("The budget of the policy with ID = %s could not be released. Error %s", id, err)
+	}
 	c.JSON(http.StatusOK,"Policy removed")
 }
 
@@ -91,6 +101,38 @@ func getPolicies(c *gin.Context) {
 	c.JSON(http.StatusOK, policies)
 }
 
+// This handler retrieves the policies in the Pareto front (candidates and selected) for a time window
+// The request responds to an endpoint matching:  /api/:service/pareto-front?start=2018-08-07T20:28:20&end=2018-08-07T20:28:20
+func getParetoFront(c *gin.Context) {
+	windowTimeStart := c.DefaultQuery("start", "")
+	windowTimeEnd := c.DefaultQuery("end","")
+	serviceName := c.Param("service")
+	policyDAO := db.GetPolicyDAO(serviceName)
+
+	if windowTimeStart == "" || windowTimeEnd == "" {
+		c.JSON(http.StatusBadRequest, "Missing parameters [start,end]")
+		return
+	}
+	startTime, err := time.Parse(util.UTC_TIME_LAYOUT, windowTimeStart)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	endTime, err := time.Parse(util.UTC_TIME_LAYOUT, windowTimeEnd)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	policies,_ := policyDAO.FindAllByTimeWindow(startTime,endTime)
+	front := make([]types.Policy,0)
+	for _,p := range policies {
+		if p.Status == types.CANDIDATE || p.Status == types.SELECTED || p.Status == types.SCHEDULED || p.Status == types.FAILED {
+			front = append(front, p)
+		}
+	}
+	c.JSON(http.StatusOK, front)
+}
+
 // This handler delete policy that match the query parameters
 // The request responds to a policiesEndpoint matching:  /api/policies?start=2018-08-07T20:28:20&end=2018-08-07T20:28:20
 func deletePolicyWindow(c *gin.Context) {
@@ -102,7 +144,14 @@ func deletePolicyWindow(c *gin.Context) {
 	if windowTimeStart != "" && windowTimeEnd != "" {
 		startTime, err := time.Parse(util.UTC_TIME_LAYOUT, windowTimeStart)
 		endTime, err := time.Parse(util.UTC_TIME_LAYOUT, windowTimeEnd)
+		policies,_ := policyDAO.FindAllByTimeWindow(startTime,endTime)
 		err = policyDAO.DeleteAllByTimeWindow(startTime,endTime)
+		budgetLedgerDAO := db.GetBudgetLedgerDAO(serviceName)
+		for _,p := range policies {
+			if err := budgetLedgerDAO.ReleaseByPolicyID(p.ID.Hex(), time.Now()); err != nil {
+				log.Errorf("The budget of the policy with ID = %s could not be released. Error %s", p.ID.Hex(), err)
+			}
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, err.Error())
 		}
@@ -118,15 +167,39 @@ func invalidatePolicyByID(c *gin.Context) {
 	id := c.Param("id")
 	serviceName := c.Param("service")
 	policyDAO := db.GetPolicyDAO(serviceName)
-	policyDAO.Connect()
 	err := policyDAO.DeleteById(id)
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, err.Error())
 	}
+	//The spend until now is kept in the budget
+	if err = db.GetBudgetLedgerDAO(serviceName).ReleaseByPolicyID(id, time.Now()); err != nil {
+		log.Errorf("The budget of the policy with ID = %s could not be released. Error %s", id, err)
+	}
 	c.JSON(http.StatusOK,"Policy removed")
 }
 
+// This handler retrieves the budget ledger with the expected spend of each calendar month
+// The request responds to an endpoint matching:  /api/:service/budget?month=2018-11
+func getBudget(c *gin.Context) {
+	month := c.DefaultQuery("month", "")
+	serviceName := c.Param("service")
+	budgetLedgerDAO := db.GetBudgetLedgerDAO(serviceName)
+
+	var entries []types.BudgetEntry
+	var err error
+	if month == "" {
+		entries,err = budgetLedgerDAO.FindAll()
+	} else {
+		entries,err = budgetLedgerDAO.FindByMonth(month)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, derivation.MonthlyBudgets(sysConfiguration.PricingModel.Budget, entries))
+}
+
 func serverCall(c *gin.Context) {
 	/*sysConfiguration,_ := util.ReadConfigFile("config.yml")
 
@@ -141,6 +214,52 @@ func serverCall(c *gin.Context) {
 	}*/
 }
 
+// This handler retrieves the drifts from the expected states detected by the reconciler, the most recent last
+func getDrift(c *gin.Context) {
+	stateDrifts.Lock()
+	drifts := append([]types.StateDrift{}, stateDrifts.drifts...)
+	stateDrifts.Unlock()
+	c.JSON(http.StatusOK, drifts)
+}
+
+// This handler receives the requests observed for a service as a list of values with timestamp and requests
+func postObservedLoad(c *gin.Context) {
+	serviceName := c.Param("service")
+	observedValues := []types.ForecastedValue{}
+	err := c.BindJSON(&observedValues)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	forecastError, err := ingestObservedLoad(sysConfiguration, serviceName, observedValues, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, forecastError)
+}
+
+// This handler retrieves the error of the forecast of a service measured with the requests observed
+// The request responds to an endpoint matching:  /api/:service/forecast-error?time=2018-08-07T20:28:20
+func getForecastError(c *gin.Context) {
+	serviceName := c.Param("service")
+	timestamp := time.Now()
+	if t := c.DefaultQuery("time", ""); t != "" {
+		var err error
+		timestamp, err = time.Parse(util.UTC_TIME_LAYOUT, t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	forecast, err := storedForecastAt(serviceName, timestamp)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, updatesHandler.ForecastError(forecast))
+}
+
 //Listener to receive forecasting updates
 func updateForecast(c *gin.Context) {
 	forecast := &types.Forecast{}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"github.com/Cloud-Pie/SPDT/planner/derivation"
+	"github.com/Cloud-Pie/SPDT/planner/execution"
+	"github.com/Cloud-Pie/SPDT/storage"
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"encoding/json"
+	"io/ioutil"
+)
+
+/* Derive and evaluate the policies for a scenario described in files, without calling any component
+	in:
+		@forecastFile string - forecast with the same format returned by the forecasting component
+		@profilesFile string - performance profiles with the format returned by the performance profiles component
+		@currentStateFile string - current state with the format returned by the scheduler
+		@sysConfiguration SystemConfiguration
+	out:
+		@[]types.Policy - candidate policies with their metrics
+		@error
+*/
+func SimulatePolicyDerivation(forecastFile string, profilesFile string, currentStateFile string,
+	sysConfiguration util.SystemConfiguration) ([]types.Policy, error) {
+	var forecast types.Forecast
+	var servicePerformanceProfile types.ServicePerformanceProfile
+
+	//Without endpoints the derivation does not request the components
+	sysConfiguration.ForecastComponent.Endpoint = ""
+	sysConfiguration.PerformanceProfilesComponent.Endpoint = ""
+	sysConfiguration.SchedulerComponent.Endpoint = ""
+
+	err := readJSONFile(forecastFile, &forecast)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	err = readJSONFile(profilesFile, &servicePerformanceProfile)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	serviceProfileDAO := storage.GetPerformanceProfileDAO(sysConfiguration.MainServiceName)
+	err = storePerformanceProfiles(servicePerformanceProfile, serviceProfileDAO)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	currentState, err := execution.ReadCurrentState(currentStateFile)
+	if err != nil {
+		return []types.Policy{},err
+	}
+	vmProfiles,err := ReadVMProfiles(sysConfiguration)
+	if err != nil {
+		return []types.Policy{},err
+	}
+
+	candidatePolicies,err := derivation.PoliciesFromState(currentState, vmProfiles, sysConfiguration, forecast)
+	if err != nil {
+		return candidatePolicies,err
+	}
+	_,err = derivation.SelectPolicy(&candidatePolicies, sysConfiguration, vmProfiles, forecast)
+	return candidatePolicies,err
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -15,9 +15,9 @@ import (
 	"gopkg.in/mgo.v2/bson"
 	"io/ioutil"
 	"encoding/json"
-	"sort"
 	"github.com/Cloud-Pie/SPDT/planner/derivation"
 	"github.com/Cloud-Pie/SPDT/planner/execution"
+	"github.com/Cloud-Pie/SPDT/pricing"
 )
 
 var (
@@ -43,12 +43,15 @@ func Start(port string, configFile string) {
 	if err != nil {
 		log.Error("%s", err)
 	}
+	storage.SetUpStorage(sysConfiguration.Storage)
 
 	out := make(chan types.Forecast)
 	server := SetUpServer(out)
 	go updatePolicyDerivation(out)
 	go removeTemporalData(sysConfiguration)
 	go periodicPolicyDerivation(sysConfiguration)
+	go reconcileState(sysConfiguration)
+	go pullObservedLoad(sysConfiguration)
 
 	server.Run(":" + port)
 
@@ -84,12 +87,14 @@ func removeTemporalData(sysConfiguration util.SystemConfiguration){
 		intervalInSeconds := util.ParseIntervalToSeconds(storageInterval)
 		intervalDuration := time.Duration(intervalInSeconds)
 		timestamp := current.Add(-1 * intervalDuration * time.Second )
-		forecastDAO := storage.GetForecastDAO(sysConfiguration.MainServiceName)
-		err := forecastDAO.DeleteAllBeforeDate(timestamp)
-		if err != nil {
-			log.Error("An error has occurred and temporal data was not deleted. Details: %s", err)
-		} else {
-			log.Info("call delete temp")
+		for _,serviceName := range sysConfiguration.ServiceNames() {
+			forecastDAO := storage.GetForecastDAO(serviceName)
+			err := forecastDAO.DeleteAllBeforeDate(timestamp)
+			if err != nil {
+				log.Error("An error has occurred and temporal data was not deleted. Details: %s", err)
+			} else {
+				log.Info("call delete temp")
+			}
 		}
 		time.Sleep(24 * time.Hour)
 	}
@@ -131,10 +136,19 @@ func setLogger() {
 }*/
 
 //Fetch the profiles of the available Virtual Machines to generate the scaling policies
-func ReadVMProfiles()([]types.VmProfile, error) {
+//with the prices of the configured price file
+func ReadVMProfiles(sysConfiguration util.SystemConfiguration)([]types.VmProfile, error) {
+	return readVMProfilesFile(util.DEFAULT_VM_PROFILES_FILE, sysConfiguration)
+}
+
+//Read the profiles of the Virtual Machines from a file with the prices of the configured price file
+func readVMProfilesFile(path string, sysConfiguration util.SystemConfiguration)([]types.VmProfile, error) {
 	var err error
 	var vmProfiles	[]types.VmProfile
-	data, err := ioutil.ReadFile("./vm_profiles.json")
+	if path == "" {
+		path = util.DEFAULT_VM_PROFILES_FILE
+	}
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		log.Error(err.Error())
 		return vmProfiles,err
@@ -145,49 +159,77 @@ func ReadVMProfiles()([]types.VmProfile, error) {
 		log.Error(err.Error())
 		return vmProfiles, err
 	}
-	sort.Slice(vmProfiles, func(i, j int) bool {
-		return vmProfiles[i].Pricing.Price <=  vmProfiles[j].Pricing.Price
-	})
-
+	vmProfiles, err = pricing.LoadPrices(vmProfiles, sysConfiguration.PricingModel.PricesFile, sysConfiguration)
+	if err != nil {
+		log.Error(err.Error())
+	}
 	return vmProfiles,err
 }
 
-//Fetch the booting and shutdown time of vms
+//Fetch the booting and shutdown time of the vms whose times are not already stored
 func FetchVMBootingProfiles(sysConfiguration util.SystemConfiguration, vmProfiles []types.VmProfile) error{
 	var err error
-	var vmBootingProfile types.InstancesBootShutdownTime
 	vmBootingProfileDAO := storage.GetVMBootingProfileDAO()
-	storedVMBootingProfiles,_ := vmBootingProfileDAO.FindAll()
-	if len(storedVMBootingProfiles) == 0 {
-		log.Info("Start request VM booting Profiles")
-		endpoint := sysConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_ALL_VM_TIMES
-		csp := sysConfiguration.CSP
-		region := sysConfiguration.Region
-		for _, vm := range vmProfiles {
-			vmBootingProfile, err = Pservice.GetAllBootShutDownProfilesByType(endpoint, vm.Type, region, csp)
-			if err != nil {
-				log.Error("Error in request VM Booting Profile for type %s. %s",vm.Type, err.Error())
-			}
-			vmBootingProfile.VMType = vm.Type
+	missingVMProfiles := []types.VmProfile{}
+	for _, vm := range vmProfiles {
+		if _,errFind := vmBootingProfileDAO.FindByType(vm.Type); errFind != nil {
+			missingVMProfiles = append(missingVMProfiles, vm)
+		}
+	}
+	if len(missingVMProfiles) > 0 {
+		var vmBootingProfiles []types.InstancesBootShutdownTime
+		vmBootingProfiles, err = requestVMBootingProfiles(sysConfiguration, missingVMProfiles)
+		for _, vmBootingProfile := range vmBootingProfiles {
 			vmBootingProfileDAO.Insert(vmBootingProfile)
 		}
-		log.Info("Finish request VM booting Profiles")
 	}
 	return err
 }
 
-//Fetch the performance profile of the microservice that should be scaled
+//Request the booting and shutdown times of VM types for the provider and region of the configuration
+func requestVMBootingProfiles(sysConfiguration util.SystemConfiguration, vmProfiles []types.VmProfile) ([]types.InstancesBootShutdownTime, error) {
+	var err error
+	vmBootingProfiles := []types.InstancesBootShutdownTime{}
+	log.Info("Start request VM booting Profiles")
+	endpoint := sysConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_ALL_VM_TIMES
+	csp := sysConfiguration.CSP
+	region := sysConfiguration.Region
+	for _, vm := range vmProfiles {
+		var vmBootingProfile types.InstancesBootShutdownTime
+		vmBootingProfile, err = Pservice.GetAllBootShutDownProfilesByType(endpoint, vm.Type, region, csp)
+		if err != nil {
+			log.Errorf("Error in request VM Booting Profile for type %s. %s",vm.Type, err.Error())
+		}
+		vmBootingProfile.VMType = vm.Type
+		vmBootingProfiles = append(vmBootingProfiles, vmBootingProfile)
+	}
+	log.Info("Finish request VM booting Profiles")
+	return vmBootingProfiles, err
+}
+
+//Fetch the performance profiles of the microservices that should be scaled
 func FetchApplicationProfile(sysConfiguration util.SystemConfiguration) error {
+	for _,serviceName := range sysConfiguration.ServiceNames() {
+		err := fetchServiceProfile(sysConfiguration, serviceName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Fetch the performance profile of a microservice, if it is not already stored
+func fetchServiceProfile(sysConfiguration util.SystemConfiguration, serviceName string) error {
 	var err error
 	var servicePerformanceProfile types.ServicePerformanceProfile
-	serviceProfileDAO := storage.GetPerformanceProfileDAO(sysConfiguration.MainServiceName)
+	serviceProfileDAO := storage.GetPerformanceProfileDAO(serviceName)
 	storedPerformanceProfiles,_ := serviceProfileDAO.FindAll()
 	if len(storedPerformanceProfiles) == 0 {
 
 		log.Info("Start request Performance Profiles")
 		endpoint := sysConfiguration.PerformanceProfilesComponent.Endpoint + util.ENDPOINT_SERVICE_PROFILES
 		servicePerformanceProfile, err = Pservice.GetServicePerformanceProfiles(endpoint,sysConfiguration.AppName,
-																sysConfiguration.AppType, sysConfiguration.MainServiceName)
+																sysConfiguration.AppType, serviceName)
 
 		if err != nil {
 			log.Error("Error in request Performance Profiles: %s",err.Error())
@@ -196,31 +238,38 @@ func FetchApplicationProfile(sysConfiguration util.SystemConfiguration) error {
 		}
 
 		//Selects and stores received information about Performance Profiles
-		for _,p := range servicePerformanceProfile.Profiles {
-			mscSettings := []types.MSCSimpleSetting{}
-			for _,msc := range p.MSCs {
-				setting := types.MSCSimpleSetting{
-					BootTimeSec: util.MillisecondsToSeconds(msc.BootTimeMs),
-					MSCPerSecond: msc.MSCPerSecond.RegBruteForce,
-					Replicas: msc.Replicas,
-					StandDevBootTimeSec: util.MillisecondsToSeconds(msc.StandDevBootTimeMS),
-				}
-				mscSettings = append(mscSettings, setting)
-			}
-			performanceProfile := types.PerformanceProfile {
-				ID: bson.NewObjectId(),Limit: p.Limits, MSCSettings: mscSettings,
-			}
-			err = serviceProfileDAO.Insert(performanceProfile)
-			if err != nil {
-				log.Error("Error Storing Performance Profiles: %s",err.Error())
+		err = storePerformanceProfiles(servicePerformanceProfile, serviceProfileDAO)
+	}
+	return err
+}
+
+//Selects and stores the MSC settings of the profiles received for a service
+func storePerformanceProfiles(servicePerformanceProfile types.ServicePerformanceProfile, serviceProfileDAO storage.PerformanceProfileStorage) error {
+	var err error
+	for _,p := range servicePerformanceProfile.Profiles {
+		mscSettings := []types.MSCSimpleSetting{}
+		for _,msc := range p.MSCs {
+			setting := types.MSCSimpleSetting{
+				BootTimeSec: util.MillisecondsToSeconds(msc.BootTimeMs),
+				MSCPerSecond: msc.MSCPerSecond.RegBruteForce,
+				Replicas: msc.Replicas,
+				StandDevBootTimeSec: util.MillisecondsToSeconds(msc.StandDevBootTimeMS),
 			}
+			mscSettings = append(mscSettings, setting)
+		}
+		performanceProfile := types.PerformanceProfile {
+			ID: bson.NewObjectId(),Limit: p.Limits, MSCSettings: mscSettings,
+		}
+		err = serviceProfileDAO.Insert(performanceProfile)
+		if err != nil {
+			log.Error("Error Storing Performance Profiles: %s",err.Error())
 		}
 	}
 	return err
 }
 
-//Start Derivation of a new scaling policy for the specified scaling horizon and correspondent forecast
-func setNewPolicy(forecast types.Forecast,sysConfiguration util.SystemConfiguration, vmProfiles [] types.VmProfile) (types.Policy, error){
+//Start Derivation of a new scaling policy for the specified scaling horizon and correspondent forecast of each service
+func setNewPolicy(forecasts map[string]types.Forecast,sysConfiguration util.SystemConfiguration, vmProfiles [] types.VmProfile) (types.Policy, error){
 	//timeStart := forecast.TimeWindowStart
 	//timeEnd := forecast.TimeWindowEnd
 
@@ -231,7 +280,8 @@ func setNewPolicy(forecast types.Forecast,sysConfiguration util.SystemConfigurat
 
 	//Derive Strategies
 	log.Info("Start policies derivation")
-	policies,err = derivation.Policies(vmProfiles, sysConfiguration, forecast)
+	forecast := forecasts[sysConfiguration.MainServiceName]
+	policies,err = derivation.ApplicationPolicies(vmProfiles, sysConfiguration, forecasts)
 	if err != nil {
 		return selectedPolicy, err
 	}
@@ -252,19 +302,47 @@ func setNewPolicy(forecast types.Forecast,sysConfiguration util.SystemConfigurat
 				log.Error("The policy with ID = %s could not be stored. Error %s\n", p.ID, err)
 			}
 		}
+		//Record the expected spend of the selected policy
+		budgetLedgerDAO := storage.GetBudgetLedgerDAO(sysConfiguration.MainServiceName)
+		for _,e := range derivation.BudgetEntries(selectedPolicy, sysConfiguration.PricingModel, derivation.VMListToMap(vmProfiles)) {
+			err = budgetLedgerDAO.Insert(e)
+			if err != nil {
+				log.Errorf("The budget of month %s could not be stored. Error %s", e.Month, err)
+			}
+		}
 	}
 	return  selectedPolicy, err
 }
 
+//Schedule a policy in the background, storing its scheduling outcome once every attempt finished
 func ScheduleScaling(sysConfiguration util.SystemConfiguration, selectedPolicy types.Policy) {
 	log.Info("Start request Scheduler")
-	schedulerURL := sysConfiguration.SchedulerComponent.Endpoint + util.ENDPOINT_STATES
-	tset,err := execution.TriggerScheduler(selectedPolicy, schedulerURL)
-	testJSON = tset
-	if err != nil {
-		log.Error("The scheduler request failed with error %s\n", err)
-	} else {
-		log.Info("Finish request Scheduler")
-	}
+	executor := execution.GetExecutor(sysConfiguration.SchedulerComponent)
+	execution.Schedule(executor, selectedPolicy, sysConfiguration.SchedulerComponent, func(policy types.Policy, err error) {
+		if schedulerExecutor, ok := executor.(*execution.SchedulerExecutor); ok {
+			testJSON = schedulerExecutor.ScheduledStates
+		}
+		if err != nil {
+			log.Errorf("The scheduler request failed after %d attempts with error %s", policy.Scheduling.Attempts, err)
+			//The expected spend of a policy not scheduled is released
+			budgetLedgerDAO := storage.GetBudgetLedgerDAO(sysConfiguration.MainServiceName)
+			if err := budgetLedgerDAO.ReleaseByPolicyID(policy.ID.Hex(), time.Now()); err != nil {
+				log.Errorf("The budget of the policy with ID = %s could not be released. Error %s", policy.ID.Hex(), err)
+			}
+		} else {
+			log.Info("Finish request Scheduler")
+		}
+		//Only the outcome is stored, the policy may have been truncated meanwhile
+		policyDAO := storage.GetPolicyDAO(sysConfiguration.MainServiceName)
+		storedPolicy, err := policyDAO.FindByID(policy.ID.Hex())
+		if err == nil {
+			storedPolicy.Status = policy.Status
+			storedPolicy.Scheduling = policy.Scheduling
+			err = policyDAO.UpdateById(policy.ID, storedPolicy)
+		}
+		if err != nil {
+			log.Errorf("The scheduling outcome of the policy with ID = %s could not be stored. Error %s", policy.ID.Hex(), err)
+		}
+	})
 }
 
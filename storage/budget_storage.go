@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"gopkg.in/mgo.v2"
+	"github.com/Cloud-Pie/SPDT/types"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	"os"
+	"errors"
+)
+
+type BudgetLedgerDAO struct {
+	Server	string
+	Database	string
+	Collection  string
+	db *mgo.Database
+	session *mgo.Session
+}
+
+var BudgetLedgerDB *BudgetLedgerDAO
+
+const DEFAULT_DB_COLLECTION_BUDGET = "Budget"
+
+//Connect to the database, the ledger is stored in the database of the policies
+func (p *BudgetLedgerDAO) Connect() (*mgo.Database, error) {
+	var err error
+
+	if p.session == nil {
+		p.session,  err = mgo.DialWithInfo(&mgo.DialInfo{
+			Addrs: policyDBHost,
+			Username: os.Getenv("POLICIESDB_USER"),
+			Password: os.Getenv("POLICIESDB_PASS"),
+			Timeout:  60 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.session = p.session.Clone()
+	p.db = p.session.DB(p.Database)
+	return p.db,err
+}
+
+//Retrieve all the stored elements
+func (p *BudgetLedgerDAO) FindAll() ([]types.BudgetEntry, error) {
+	var entries []types.BudgetEntry
+	err := p.db.C(p.Collection).Find(bson.M{}).All(&entries)
+	return entries, err
+}
+
+//Retrieve the entries of a calendar month
+func (p *BudgetLedgerDAO) FindByMonth(month string) ([]types.BudgetEntry, error) {
+	var entries []types.BudgetEntry
+	err := p.db.C(p.Collection).Find(bson.M{"month": month}).All(&entries)
+	return entries, err
+}
+
+//Insert a new entry
+func (p *BudgetLedgerDAO) Insert(entry types.BudgetEntry) error {
+	err := p.db.C(p.Collection).Insert(&entry)
+	return err
+}
+
+//Release the spend expected by a policy from a time on, the spend expected before is kept
+func (p *BudgetLedgerDAO) ReleaseByPolicyID(id string, timeRelease time.Time) error {
+	if !bson.IsObjectIdHex(id) {
+		return errors.New("Invalid policy id " + id)
+	}
+	var entries []types.BudgetEntry
+	err := p.db.C(p.Collection).Find(bson.M{"policy_id": bson.ObjectIdHex(id)}).All(&entries)
+	if err != nil {
+		return err
+	}
+	for _,e := range entries {
+		if released, kept := releaseEntry(e, timeRelease); !kept {
+			err = p.db.C(p.Collection).RemoveId(e.ID)
+		} else if released.ExpectedSpend != e.ExpectedSpend {
+			err = p.db.C(p.Collection).UpdateId(e.ID, &released)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* Part of a ledger entry before a time. The expected spend is reduced proportionally to the time released
+	in:
+		@entry types.BudgetEntry
+		@timeRelease time.Time
+	out:
+		@types.BudgetEntry
+		@bool - false if the whole entry is released
+*/
+func releaseEntry(entry types.BudgetEntry, timeRelease time.Time) (types.BudgetEntry, bool) {
+	if !entry.TimeWindowStart.Before(timeRelease) {
+		return entry, false
+	}
+	if entry.TimeWindowEnd.After(timeRelease) {
+		duration := entry.TimeWindowEnd.Sub(entry.TimeWindowStart).Seconds()
+		entry.ExpectedSpend *= timeRelease.Sub(entry.TimeWindowStart).Seconds() / duration
+		entry.TimeWindowEnd = timeRelease
+	}
+	return entry, true
+}
+
+func getBudgetLedgerMongoDAO(serviceName string) *BudgetLedgerDAO{
+	if BudgetLedgerDB == nil || BudgetLedgerDB.Collection != DEFAULT_DB_COLLECTION_BUDGET + "_" + serviceName {
+		BudgetLedgerDB = &BudgetLedgerDAO {
+			Database:DEFAULT_DB_POLICIES,
+			Collection:DEFAULT_DB_COLLECTION_BUDGET + "_" + serviceName,
+		}
+		_,err := BudgetLedgerDB.Connect()
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}
+	return BudgetLedgerDB
+}
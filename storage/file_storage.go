@@ -0,0 +1,565 @@
+package storage
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"gopkg.in/mgo.v2/bson"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+	"os"
+)
+
+/*
+	Embedded storage backend. Each collection is kept as a JSON document in
+	<path>/<database>/<collection>.json, so SPDT can run without MongoDB.
+	The file is loaded into the in-memory DAO that evaluates the queries and
+	it is written back after every modification.
+*/
+
+//Serializes the access to the collection files
+var fileStorageMux sync.Mutex
+
+//Read a collection file into out. A missing file is an empty collection
+func readCollection(path string, out interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+//Write the collection into its file, replacing the previous content
+func writeCollection(path string, in interface{}) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func collectionFile(path string, database string, collection string) string {
+	return filepath.Join(path, database, collection + ".json")
+}
+
+/*_________________________________________
+		Policies
+___________________________________________
+*/
+
+type PolicyFileDAO struct {
+	Path       string
+	Database   string
+	Collection string
+}
+
+//Load the collection file. The caller must hold fileStorageMux
+func (p *PolicyFileDAO) open() (*PolicyMemoryDAO, error) {
+	collection := &PolicyMemoryDAO{}
+	err := readCollection(collectionFile(p.Path, p.Database, p.Collection), &collection.Policies)
+	return collection, err
+}
+
+func (p *PolicyFileDAO) save(collection *PolicyMemoryDAO) error {
+	return writeCollection(collectionFile(p.Path, p.Database, p.Collection), collection.Policies)
+}
+
+//Apply a modification to the collection and write it back if it succeeds
+func (p *PolicyFileDAO) modify(change func(collection *PolicyMemoryDAO) error) error {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	collection, err := p.open()
+	if err != nil {
+		return err
+	}
+	if err = change(collection); err != nil {
+		return err
+	}
+	return p.save(collection)
+}
+
+//Load the collection to evaluate a query
+func (p *PolicyFileDAO) query() (*PolicyMemoryDAO, error) {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	return p.open()
+}
+
+//Retrieve all the stored elements
+func (p *PolicyFileDAO) FindAll() ([]types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAll()
+}
+
+//Retrieve the item with the specified ID
+func (p *PolicyFileDAO) FindByID(id string) (types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.Policy{}, err
+	}
+	return collection.FindByID(id)
+}
+
+//Retrieve all policies for start time greater than or equal to time t
+func (p *PolicyFileDAO) FindByStartTime(time time.Time) ([]types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindByStartTime(time)
+}
+
+//Retrieve all policies for start time less than or equal to time t
+func (p *PolicyFileDAO) FindByEndTime(time time.Time) ([]types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindByEndTime(time)
+}
+
+//Retrieve all policies within the time window
+func (p *PolicyFileDAO) FindAllByTimeWindow(startTime time.Time, endTime time.Time) ([]types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAllByTimeWindow(startTime, endTime)
+}
+
+//Retrieve one policy for the exact time window
+func (p *PolicyFileDAO) FindOneByTimeWindow(startTime time.Time, endTime time.Time) (types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.Policy{}, err
+	}
+	return collection.FindOneByTimeWindow(startTime, endTime)
+}
+
+//Retrieve the policy selected for the given time window
+func (p *PolicyFileDAO) FindSelectedByTimeWindow(startTime time.Time, endTime time.Time) (types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.Policy{}, err
+	}
+	return collection.FindSelectedByTimeWindow(startTime, endTime)
+}
+
+//Retrieve the selected policy whose time window contains time t
+func (p *PolicyFileDAO) FindSelectedByTime(t time.Time) (types.Policy, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.Policy{}, err
+	}
+	return collection.FindSelectedByTime(t)
+}
+
+//Insert a new policy
+func (p *PolicyFileDAO) Insert(policy types.Policy) error {
+	return p.modify(func(collection *PolicyMemoryDAO) error { return collection.Insert(policy) })
+}
+
+//Delete policy by id
+func (p *PolicyFileDAO) DeleteById(id string) error {
+	return p.modify(func(collection *PolicyMemoryDAO) error { return collection.DeleteById(id) })
+}
+
+//Delete all policies for the time window
+func (p *PolicyFileDAO) DeleteAllByTimeWindow(startTime time.Time, endTime time.Time) error {
+	return p.modify(func(collection *PolicyMemoryDAO) error { return collection.DeleteAllByTimeWindow(startTime, endTime) })
+}
+
+//Update policy by id
+func (p *PolicyFileDAO) UpdateById(id bson.ObjectId, policy types.Policy) error {
+	return p.modify(func(collection *PolicyMemoryDAO) error { return collection.UpdateById(id, policy) })
+}
+
+/*_________________________________________
+		Budget Ledger
+___________________________________________
+*/
+
+type BudgetLedgerFileDAO struct {
+	Path       string
+	Database   string
+	Collection string
+}
+
+//Load the collection file. The caller must hold fileStorageMux
+func (p *BudgetLedgerFileDAO) open() (*BudgetLedgerMemoryDAO, error) {
+	collection := &BudgetLedgerMemoryDAO{}
+	err := readCollection(collectionFile(p.Path, p.Database, p.Collection), &collection.Entries)
+	return collection, err
+}
+
+func (p *BudgetLedgerFileDAO) save(collection *BudgetLedgerMemoryDAO) error {
+	return writeCollection(collectionFile(p.Path, p.Database, p.Collection), collection.Entries)
+}
+
+//Apply a modification to the collection and write it back if it succeeds
+func (p *BudgetLedgerFileDAO) modify(change func(collection *BudgetLedgerMemoryDAO) error) error {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	collection, err := p.open()
+	if err != nil {
+		return err
+	}
+	if err = change(collection); err != nil {
+		return err
+	}
+	return p.save(collection)
+}
+
+//Load the collection to evaluate a query
+func (p *BudgetLedgerFileDAO) query() (*BudgetLedgerMemoryDAO, error) {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	return p.open()
+}
+
+//Retrieve all the stored elements
+func (p *BudgetLedgerFileDAO) FindAll() ([]types.BudgetEntry, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAll()
+}
+
+//Retrieve the entries of a calendar month
+func (p *BudgetLedgerFileDAO) FindByMonth(month string) ([]types.BudgetEntry, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindByMonth(month)
+}
+
+//Insert a new entry
+func (p *BudgetLedgerFileDAO) Insert(entry types.BudgetEntry) error {
+	return p.modify(func(collection *BudgetLedgerMemoryDAO) error { return collection.Insert(entry) })
+}
+
+//Release the spend expected by a policy from a time on, the spend expected before is kept
+func (p *BudgetLedgerFileDAO) ReleaseByPolicyID(id string, timeRelease time.Time) error {
+	return p.modify(func(collection *BudgetLedgerMemoryDAO) error { return collection.ReleaseByPolicyID(id, timeRelease) })
+}
+
+/*_________________________________________
+		Forecasts
+___________________________________________
+*/
+
+type ForecastFileDAO struct {
+	Path       string
+	Database   string
+	Collection string
+}
+
+//Load the collection file. The caller must hold fileStorageMux
+func (p *ForecastFileDAO) open() (*ForecastMemoryDAO, error) {
+	collection := &ForecastMemoryDAO{}
+	err := readCollection(collectionFile(p.Path, p.Database, p.Collection), &collection.Forecasts)
+	return collection, err
+}
+
+func (p *ForecastFileDAO) save(collection *ForecastMemoryDAO) error {
+	return writeCollection(collectionFile(p.Path, p.Database, p.Collection), collection.Forecasts)
+}
+
+//Apply a modification to the collection and write it back if it succeeds
+func (p *ForecastFileDAO) modify(change func(collection *ForecastMemoryDAO) error) error {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	collection, err := p.open()
+	if err != nil {
+		return err
+	}
+	if err = change(collection); err != nil {
+		return err
+	}
+	return p.save(collection)
+}
+
+//Load the collection to evaluate a query
+func (p *ForecastFileDAO) query() (*ForecastMemoryDAO, error) {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	return p.open()
+}
+
+//Retrieve all the stored elements
+func (p *ForecastFileDAO) FindAll() ([]types.Forecast, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAll()
+}
+
+//Retrieve the item with the specified ID
+func (p *ForecastFileDAO) FindByID(id string) (types.Forecast, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.Forecast{}, err
+	}
+	return collection.FindByID(id)
+}
+
+//Insert a new forecast
+func (p *ForecastFileDAO) Insert(forecast types.Forecast) error {
+	return p.modify(func(collection *ForecastMemoryDAO) error { return collection.Insert(forecast) })
+}
+
+//Delete the specified item
+func (p *ForecastFileDAO) Delete(forecast types.Forecast) error {
+	return p.modify(func(collection *ForecastMemoryDAO) error { return collection.Delete(forecast) })
+}
+
+//Update the specified item
+func (p *ForecastFileDAO) Update(id bson.ObjectId, forecast types.Forecast) error {
+	return p.modify(func(collection *ForecastMemoryDAO) error { return collection.Update(id, forecast) })
+}
+
+//Delete all forecast older than a timestamp
+func (p *ForecastFileDAO) DeleteAllBeforeDate(timestamp time.Time) error {
+	return p.modify(func(collection *ForecastMemoryDAO) error { return collection.DeleteAllBeforeDate(timestamp) })
+}
+
+//Retrieve the forecast for the exact time window
+func (p *ForecastFileDAO) FindOneByTimeWindow(startTime time.Time, endTime time.Time) (types.Forecast, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.Forecast{}, err
+	}
+	return collection.FindOneByTimeWindow(startTime, endTime)
+}
+
+/*_________________________________________
+		Performance Profiles
+___________________________________________
+*/
+
+type PerformanceProfileFileDAO struct {
+	Path       string
+	Database   string
+	Collection string
+}
+
+//Load the collection file. The caller must hold fileStorageMux
+func (p *PerformanceProfileFileDAO) open() (*PerformanceProfileMemoryDAO, error) {
+	collection := &PerformanceProfileMemoryDAO{}
+	err := readCollection(collectionFile(p.Path, p.Database, p.Collection), &collection.PerformanceProfiles)
+	return collection, err
+}
+
+func (p *PerformanceProfileFileDAO) save(collection *PerformanceProfileMemoryDAO) error {
+	return writeCollection(collectionFile(p.Path, p.Database, p.Collection), collection.PerformanceProfiles)
+}
+
+//Apply a modification to the collection and write it back if it succeeds
+func (p *PerformanceProfileFileDAO) modify(change func(collection *PerformanceProfileMemoryDAO) error) error {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	collection, err := p.open()
+	if err != nil {
+		return err
+	}
+	if err = change(collection); err != nil {
+		return err
+	}
+	return p.save(collection)
+}
+
+//Load the collection to evaluate a query
+func (p *PerformanceProfileFileDAO) query() (*PerformanceProfileMemoryDAO, error) {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	return p.open()
+}
+
+//Retrieve all the stored elements
+func (p *PerformanceProfileFileDAO) FindAll() ([]types.PerformanceProfile, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAll()
+}
+
+//Retrieve the item with the specified ID
+func (p *PerformanceProfileFileDAO) FindByID(id string) (types.PerformanceProfile, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.PerformanceProfile{}, err
+	}
+	return collection.FindByID(id)
+}
+
+//Insert a new Performance Profile
+func (p *PerformanceProfileFileDAO) Insert(performanceProfile types.PerformanceProfile) error {
+	return p.modify(func(collection *PerformanceProfileMemoryDAO) error { return collection.Insert(performanceProfile) })
+}
+
+//Delete the specified item
+func (p *PerformanceProfileFileDAO) Delete(performanceProfile types.PerformanceProfile) error {
+	return p.modify(func(collection *PerformanceProfileMemoryDAO) error { return collection.Delete(performanceProfile) })
+}
+
+//Delete all the items
+func (p *PerformanceProfileFileDAO) DeleteAll() error {
+	return p.modify(func(collection *PerformanceProfileMemoryDAO) error { return collection.DeleteAll() })
+}
+
+//Update by id
+func (p *PerformanceProfileFileDAO) UpdateById(id bson.ObjectId, performanceProfile types.PerformanceProfile) error {
+	return p.modify(func(collection *PerformanceProfileMemoryDAO) error { return collection.UpdateById(id, performanceProfile) })
+}
+
+func (p *PerformanceProfileFileDAO) FindByLimitsAndReplicas(cores float64, memory float64, replicas int) (types.PerformanceProfile, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.PerformanceProfile{}, err
+	}
+	return collection.FindByLimitsAndReplicas(cores, memory, replicas)
+}
+
+//Matches the profiles which fit into the specified limits and provide a MSCPerSecond greater or equal than the requests
+func (p *PerformanceProfileFileDAO) MatchProfileFitLimitsOver(cores float64, memory float64, requests float64) ([]types.ContainersConfig, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.MatchProfileFitLimitsOver(cores, memory, requests)
+}
+
+//Bring limits for which are profiles available
+func (p *PerformanceProfileFileDAO) FindAllUnderLimits(cores float64, memory float64) ([]types.PerformanceProfile, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAllUnderLimits(cores, memory)
+}
+
+//Matches the profiles which fit into the specified limits and provide a MSCPerSecond less than the requests
+func (p *PerformanceProfileFileDAO) MatchProfileFitLimitsUnder(cores float64, memory float64, requests float64) ([]types.ContainersConfig, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.MatchProfileFitLimitsUnder(cores, memory, requests)
+}
+
+func (p *PerformanceProfileFileDAO) FindProfileByLimits(limit types.Limit) (types.PerformanceProfile, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.PerformanceProfile{}, err
+	}
+	return collection.FindProfileByLimits(limit)
+}
+
+/*_________________________________________
+		VM Booting Profiles
+___________________________________________
+*/
+
+type VMBootingProfileFileDAO struct {
+	Path       string
+	Database   string
+	Collection string
+}
+
+//Load the collection file. The caller must hold fileStorageMux
+func (p *VMBootingProfileFileDAO) open() (*VMBootingProfileMemoryDAO, error) {
+	collection := &VMBootingProfileMemoryDAO{}
+	err := readCollection(collectionFile(p.Path, p.Database, p.Collection), &collection.VMBootingProfiles)
+	return collection, err
+}
+
+func (p *VMBootingProfileFileDAO) save(collection *VMBootingProfileMemoryDAO) error {
+	return writeCollection(collectionFile(p.Path, p.Database, p.Collection), collection.VMBootingProfiles)
+}
+
+//Apply a modification to the collection and write it back if it succeeds
+func (p *VMBootingProfileFileDAO) modify(change func(collection *VMBootingProfileMemoryDAO) error) error {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	collection, err := p.open()
+	if err != nil {
+		return err
+	}
+	if err = change(collection); err != nil {
+		return err
+	}
+	return p.save(collection)
+}
+
+//Load the collection to evaluate a query
+func (p *VMBootingProfileFileDAO) query() (*VMBootingProfileMemoryDAO, error) {
+	fileStorageMux.Lock()
+	defer fileStorageMux.Unlock()
+	return p.open()
+}
+
+//Retrieve all the stored elements
+func (p *VMBootingProfileFileDAO) FindAll() ([]types.InstancesBootShutdownTime, error) {
+	collection, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return collection.FindAll()
+}
+
+//Retrieve the item with the specified type
+func (p *VMBootingProfileFileDAO) FindByType(vmType string) (types.InstancesBootShutdownTime, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.InstancesBootShutdownTime{}, err
+	}
+	return collection.FindByType(vmType)
+}
+
+//Insert a new VM booting profile
+func (p *VMBootingProfileFileDAO) Insert(vmBootingProfile types.InstancesBootShutdownTime) error {
+	return p.modify(func(collection *VMBootingProfileMemoryDAO) error { return collection.Insert(vmBootingProfile) })
+}
+
+//Update by type
+func (p *VMBootingProfileFileDAO) UpdateByType(vmType string, vmBootingProfile types.InstancesBootShutdownTime) error {
+	return p.modify(func(collection *VMBootingProfileMemoryDAO) error { return collection.UpdateByType(vmType, vmBootingProfile) })
+}
+
+//Search booting and shutdown time for a vm type and number of instances
+func (p *VMBootingProfileFileDAO) BootingShutdownTime(vmType string, numInstances int) (types.BootShutDownTime, error) {
+	collection, err := p.query()
+	if err != nil {
+		return types.BootShutDownTime{}, err
+	}
+	return collection.BootingShutdownTime(vmType, numInstances)
+}
+
+//Search booting and shutdown time for a vm type
+func (p *VMBootingProfileFileDAO) InstanceVMBootingShutdown(vmType string) (types.InstancesBootShutdownTime, error) {
+	return p.FindByType(vmType)
+}
+
+//Delete all the items
+func (p *VMBootingProfileFileDAO) DeleteAll() error {
+	return p.modify(func(collection *VMBootingProfileMemoryDAO) error { return collection.DeleteAll() })
+}
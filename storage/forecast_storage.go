@@ -116,7 +116,7 @@ func (p *ForecastDAO) FindOneByTimeWindow(startTime time.Time, endTime time.Time
 	return forecast,err
 }
 
-func GetForecastDAO(serviceName string) *ForecastDAO{
+func getForecastMongoDAO(serviceName string) *ForecastDAO{
 	if ForecastDB == nil {
 		ForecastDB = &ForecastDAO {
 			Database:DEFAULT_DB_FORECAST,
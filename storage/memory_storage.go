@@ -0,0 +1,467 @@
+package storage
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"gopkg.in/mgo.v2/bson"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+	In-memory storage backend. Data lives only while the process runs,
+	it is used for tests and dry runs of the derivation.
+*/
+
+//Collections kept in memory, identified by database and collection name
+var (
+	memoryStorageMux sync.Mutex
+	memoryCollections = make(map[string]interface{})
+)
+
+//Retrieve the collection registered for the key or register the new one
+func memoryCollection(key string, newCollection interface{}) interface{} {
+	memoryStorageMux.Lock()
+	defer memoryStorageMux.Unlock()
+	if c, ok := memoryCollections[key]; ok {
+		return c
+	}
+	memoryCollections[key] = newCollection
+	return newCollection
+}
+
+//Remove all the collections kept in memory
+func ResetMemoryStorage() {
+	memoryStorageMux.Lock()
+	defer memoryStorageMux.Unlock()
+	memoryCollections = make(map[string]interface{})
+}
+
+/*_________________________________________
+		Policies
+___________________________________________
+*/
+
+type PolicyMemoryDAO struct {
+	mux      sync.Mutex
+	Policies []types.Policy
+}
+
+func (p *PolicyMemoryDAO) find(match func(policy types.Policy) bool) ([]types.Policy, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return filterPolicies(p.Policies, match), nil
+}
+
+func (p *PolicyMemoryDAO) findOne(match func(policy types.Policy) bool) (types.Policy, error) {
+	policies, _ := p.find(match)
+	if len(policies) == 0 {
+		return types.Policy{}, ErrNotFound
+	}
+	return policies[0], nil
+}
+
+//Remove the policies that satisfy the condition
+func (p *PolicyMemoryDAO) remove(match func(policy types.Policy) bool) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	remaining := filterPolicies(p.Policies, func(policy types.Policy) bool { return !match(policy) })
+	if len(remaining) == len(p.Policies) {
+		return ErrNotFound
+	}
+	p.Policies = remaining
+	return nil
+}
+
+//Retrieve all the stored elements
+func (p *PolicyMemoryDAO) FindAll() ([]types.Policy, error) {
+	return p.find(func(policy types.Policy) bool { return true })
+}
+
+//Retrieve the item with the specified ID
+func (p *PolicyMemoryDAO) FindByID(id string) (types.Policy, error) {
+	return p.findOne(func(policy types.Policy) bool { return policy.ID.Hex() == id })
+}
+
+//Retrieve all policies for start time greater than or equal to time t
+func (p *PolicyMemoryDAO) FindByStartTime(time time.Time) ([]types.Policy, error) {
+	return p.find(func(policy types.Policy) bool { return !policy.TimeWindowStart.Before(time) })
+}
+
+//Retrieve all policies for start time less than or equal to time t
+func (p *PolicyMemoryDAO) FindByEndTime(time time.Time) ([]types.Policy, error) {
+	return p.find(func(policy types.Policy) bool { return !policy.TimeWindowEnd.After(time) })
+}
+
+//Retrieve all policies within the time window
+func (p *PolicyMemoryDAO) FindAllByTimeWindow(startTime time.Time, endTime time.Time) ([]types.Policy, error) {
+	return p.find(policyWithinWindow(startTime, endTime))
+}
+
+//Retrieve one policy for the exact time window
+func (p *PolicyMemoryDAO) FindOneByTimeWindow(startTime time.Time, endTime time.Time) (types.Policy, error) {
+	return p.findOne(policyExactWindow(startTime, endTime))
+}
+
+//Retrieve the policy selected for the given time window
+func (p *PolicyMemoryDAO) FindSelectedByTimeWindow(startTime time.Time, endTime time.Time) (types.Policy, error) {
+	exactWindow := policyExactWindow(startTime, endTime)
+	return p.findOne(func(policy types.Policy) bool { return exactWindow(policy) && isSelected(policy) })
+}
+
+//Retrieve the selected policy whose time window contains time t
+func (p *PolicyMemoryDAO) FindSelectedByTime(t time.Time) (types.Policy, error) {
+	return p.findOne(func(policy types.Policy) bool {
+		return isSelected(policy) && !policy.TimeWindowStart.After(t) && policy.TimeWindowEnd.After(t)
+	})
+}
+
+//The selected policy keeps being the selected one once it is scheduled
+func isSelected(policy types.Policy) bool {
+	return policy.Status == types.SELECTED || policy.Status == types.SCHEDULED
+}
+
+//Insert a new policy
+func (p *PolicyMemoryDAO) Insert(policy types.Policy) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.Policies = append(p.Policies, policy)
+	return nil
+}
+
+//Delete policy by id
+func (p *PolicyMemoryDAO) DeleteById(id string) error {
+	return p.remove(func(policy types.Policy) bool { return policy.ID.Hex() == id })
+}
+
+//Delete all policies for the time window
+func (p *PolicyMemoryDAO) DeleteAllByTimeWindow(startTime time.Time, endTime time.Time) error {
+	return p.remove(policyWithinWindow(startTime, endTime))
+}
+
+//Update policy by id
+func (p *PolicyMemoryDAO) UpdateById(id bson.ObjectId, policy types.Policy) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i := range p.Policies {
+		if p.Policies[i].ID == id {
+			p.Policies[i] = policy
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+/*_________________________________________
+		Budget Ledger
+___________________________________________
+*/
+
+type BudgetLedgerMemoryDAO struct {
+	mux     sync.Mutex
+	Entries []types.BudgetEntry
+}
+
+func (p *BudgetLedgerMemoryDAO) find(match func(entry types.BudgetEntry) bool) ([]types.BudgetEntry, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	var entries []types.BudgetEntry
+	for _,e := range p.Entries {
+		if match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+//Retrieve all the stored elements
+func (p *BudgetLedgerMemoryDAO) FindAll() ([]types.BudgetEntry, error) {
+	return p.find(func(entry types.BudgetEntry) bool { return true })
+}
+
+//Retrieve the entries of a calendar month
+func (p *BudgetLedgerMemoryDAO) FindByMonth(month string) ([]types.BudgetEntry, error) {
+	return p.find(func(entry types.BudgetEntry) bool { return entry.Month == month })
+}
+
+//Insert a new entry
+func (p *BudgetLedgerMemoryDAO) Insert(entry types.BudgetEntry) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.Entries = append(p.Entries, entry)
+	return nil
+}
+
+//Release the spend expected by a policy from a time on, the spend expected before is kept
+func (p *BudgetLedgerMemoryDAO) ReleaseByPolicyID(id string, timeRelease time.Time) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	var remaining []types.BudgetEntry
+	for _,e := range p.Entries {
+		if e.PolicyID.Hex() != id {
+			remaining = append(remaining, e)
+		} else if released, kept := releaseEntry(e, timeRelease); kept {
+			remaining = append(remaining, released)
+		}
+	}
+	p.Entries = remaining
+	return nil
+}
+
+/*_________________________________________
+		Forecasts
+___________________________________________
+*/
+
+type ForecastMemoryDAO struct {
+	mux       sync.Mutex
+	Forecasts []types.Forecast
+}
+
+//Keep the forecasts for which keep returns true
+func (p *ForecastMemoryDAO) retain(keep func(forecast types.Forecast) bool) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	var remaining []types.Forecast
+	for _,f := range p.Forecasts {
+		if keep(f) {
+			remaining = append(remaining, f)
+		}
+	}
+	p.Forecasts = remaining
+	return nil
+}
+
+//Retrieve all the stored elements
+func (p *ForecastMemoryDAO) FindAll() ([]types.Forecast, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]types.Forecast{}, p.Forecasts...), nil
+}
+
+//Retrieve the item with the specified ID
+func (p *ForecastMemoryDAO) FindByID(id string) (types.Forecast, error) {
+	forecasts, _ := p.FindAll()
+	for _,f := range forecasts {
+		if f.IDdb.Hex() == id {
+			return f, nil
+		}
+	}
+	return types.Forecast{}, ErrNotFound
+}
+
+//Insert a new forecast
+func (p *ForecastMemoryDAO) Insert(forecast types.Forecast) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.Forecasts = append(p.Forecasts, forecast)
+	return nil
+}
+
+//Delete the specified item
+func (p *ForecastMemoryDAO) Delete(forecast types.Forecast) error {
+	return p.retain(func(f types.Forecast) bool { return f.IDdb != forecast.IDdb })
+}
+
+//Update the specified item
+func (p *ForecastMemoryDAO) Update(id bson.ObjectId, forecast types.Forecast) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i := range p.Forecasts {
+		if p.Forecasts[i].IDdb == id {
+			p.Forecasts[i] = forecast
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+//Delete all forecast older than a timestamp
+func (p *ForecastMemoryDAO) DeleteAllBeforeDate(timestamp time.Time) error {
+	return p.retain(func(f types.Forecast) bool { return f.TimeWindowEnd.After(timestamp) })
+}
+
+//Retrieve the forecast for the exact time window
+func (p *ForecastMemoryDAO) FindOneByTimeWindow(startTime time.Time, endTime time.Time) (types.Forecast, error) {
+	forecasts, _ := p.FindAll()
+	for _,f := range forecasts {
+		if f.TimeWindowStart.Equal(startTime) && f.TimeWindowEnd.Equal(endTime) {
+			return f, nil
+		}
+	}
+	return types.Forecast{}, ErrNotFound
+}
+
+/*_________________________________________
+		Performance Profiles
+___________________________________________
+*/
+
+type PerformanceProfileMemoryDAO struct {
+	mux                 sync.Mutex
+	PerformanceProfiles []types.PerformanceProfile
+}
+
+//Retrieve all the stored elements
+func (p *PerformanceProfileMemoryDAO) FindAll() ([]types.PerformanceProfile, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]types.PerformanceProfile{}, p.PerformanceProfiles...), nil
+}
+
+//Retrieve the item with the specified ID
+func (p *PerformanceProfileMemoryDAO) FindByID(id string) (types.PerformanceProfile, error) {
+	performanceProfiles, _ := p.FindAll()
+	for _,pp := range performanceProfiles {
+		if pp.ID.Hex() == id {
+			return pp, nil
+		}
+	}
+	return types.PerformanceProfile{}, ErrNotFound
+}
+
+//Insert a new Performance Profile
+func (p *PerformanceProfileMemoryDAO) Insert(performanceProfile types.PerformanceProfile) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.PerformanceProfiles = append(p.PerformanceProfiles, performanceProfile)
+	return nil
+}
+
+//Delete the specified item
+func (p *PerformanceProfileMemoryDAO) Delete(performanceProfile types.PerformanceProfile) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	var remaining []types.PerformanceProfile
+	for _,pp := range p.PerformanceProfiles {
+		if pp.ID != performanceProfile.ID {
+			remaining = append(remaining, pp)
+		}
+	}
+	p.PerformanceProfiles = remaining
+	return nil
+}
+
+//Delete all the items
+func (p *PerformanceProfileMemoryDAO) DeleteAll() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.PerformanceProfiles = []types.PerformanceProfile{}
+	return nil
+}
+
+//Update by id
+func (p *PerformanceProfileMemoryDAO) UpdateById(id bson.ObjectId, performanceProfile types.PerformanceProfile) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i := range p.PerformanceProfiles {
+		if p.PerformanceProfiles[i].ID == id {
+			p.PerformanceProfiles[i] = performanceProfile
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (p *PerformanceProfileMemoryDAO) FindByLimitsAndReplicas(cores float64, memory float64, replicas int) (types.PerformanceProfile, error) {
+	performanceProfiles, _ := p.FindAll()
+	return profileByLimitsAndReplicas(performanceProfiles, cores, memory, replicas)
+}
+
+//Matches the profiles which fit into the specified limits and provide a MSCPerSecond greater or equal than the requests
+func (p *PerformanceProfileMemoryDAO) MatchProfileFitLimitsOver(cores float64, memory float64, requests float64) ([]types.ContainersConfig, error) {
+	performanceProfiles, _ := p.FindAll()
+	result := matchProfileFitLimitsOver(performanceProfiles, cores, memory, requests)
+	if len(result) == 0 {
+		return result, errors.New("No result found")
+	}
+	return result, nil
+}
+
+//Bring limits for which are profiles available
+func (p *PerformanceProfileMemoryDAO) FindAllUnderLimits(cores float64, memory float64) ([]types.PerformanceProfile, error) {
+	performanceProfiles, _ := p.FindAll()
+	result := profilesUnderLimits(performanceProfiles, cores, memory)
+	if len(result) == 0 {
+		return result, errors.New("No result found")
+	}
+	return result, nil
+}
+
+//Matches the profiles which fit into the specified limits and provide a MSCPerSecond less than the requests
+func (p *PerformanceProfileMemoryDAO) MatchProfileFitLimitsUnder(cores float64, memory float64, requests float64) ([]types.ContainersConfig, error) {
+	performanceProfiles, _ := p.FindAll()
+	result := matchProfileFitLimitsUnder(performanceProfiles, cores, memory, requests)
+	if len(result) == 0 {
+		return result, errors.New("No result found")
+	}
+	return result, nil
+}
+
+func (p *PerformanceProfileMemoryDAO) FindProfileByLimits(limit types.Limit) (types.PerformanceProfile, error) {
+	performanceProfiles, _ := p.FindAll()
+	return profileByLimits(performanceProfiles, limit)
+}
+
+/*_________________________________________
+		VM Booting Profiles
+___________________________________________
+*/
+
+type VMBootingProfileMemoryDAO struct {
+	mux               sync.Mutex
+	VMBootingProfiles []types.InstancesBootShutdownTime
+}
+
+//Retrieve all the stored elements
+func (p *VMBootingProfileMemoryDAO) FindAll() ([]types.InstancesBootShutdownTime, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]types.InstancesBootShutdownTime{}, p.VMBootingProfiles...), nil
+}
+
+//Retrieve the item with the specified type
+func (p *VMBootingProfileMemoryDAO) FindByType(vmType string) (types.InstancesBootShutdownTime, error) {
+	vmBootingProfiles, _ := p.FindAll()
+	return bootingProfileByType(vmBootingProfiles, vmType)
+}
+
+//Insert a new VM booting profile
+func (p *VMBootingProfileMemoryDAO) Insert(vmBootingProfile types.InstancesBootShutdownTime) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.VMBootingProfiles = append(p.VMBootingProfiles, vmBootingProfile)
+	return nil
+}
+
+//Update by type
+func (p *VMBootingProfileMemoryDAO) UpdateByType(vmType string, vmBootingProfile types.InstancesBootShutdownTime) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i := range p.VMBootingProfiles {
+		if p.VMBootingProfiles[i].VMType == vmType {
+			p.VMBootingProfiles[i] = vmBootingProfile
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+//Search booting and shutdown time for a vm type and number of instances
+func (p *VMBootingProfileMemoryDAO) BootingShutdownTime(vmType string, numInstances int) (types.BootShutDownTime, error) {
+	vmBootingProfiles, _ := p.FindAll()
+	return bootingShutdownTime(vmBootingProfiles, vmType, numInstances)
+}
+
+//Search booting and shutdown time for a vm type
+func (p *VMBootingProfileMemoryDAO) InstanceVMBootingShutdown(vmType string) (types.InstancesBootShutdownTime, error) {
+	return p.FindByType(vmType)
+}
+
+//Delete all the items
+func (p *VMBootingProfileMemoryDAO) DeleteAll() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.VMBootingProfiles = []types.InstancesBootShutdownTime{}
+	return nil
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testProfiles() []types.PerformanceProfile {
+	return []types.PerformanceProfile{
+		{ID:bson.NewObjectId(), Limit:types.Limit{CPUCores:0.2, MemoryGB:0.2}, MSCSettings:[]types.MSCSimpleSetting{
+			{Replicas:1, MSCPerSecond:12.9}, {Replicas:2, MSCPerSecond:28.5}, {Replicas:3, MSCPerSecond:43.9}}},
+		{ID:bson.NewObjectId(), Limit:types.Limit{CPUCores:1, MemoryGB:1}, MSCSettings:[]types.MSCSimpleSetting{
+			{Replicas:1, MSCPerSecond:74.9}, {Replicas:2, MSCPerSecond:153.4}}},
+	}
+}
+
+func TestPerformanceProfileQueries(t *testing.T) {
+	dao := &PerformanceProfileMemoryDAO{PerformanceProfiles:testProfiles()}
+
+	profile, err := dao.FindByLimitsAndReplicas(0.2, 0.2, 2)
+	if err != nil || len(profile.MSCSettings) != 1 || profile.MSCSettings[0].MSCPerSecond != 28.5 {
+		t.Error("FindByLimitsAndReplicas expected: ", 28.5, "got: ", profile.MSCSettings, err)
+	}
+	if _, err = dao.FindByLimitsAndReplicas(0.2, 0.2, 7); err == nil {
+		t.Error("FindByLimitsAndReplicas expected an error for a missing number of replicas")
+	}
+
+	over, err := dao.MatchProfileFitLimitsOver(2, 2, 40)
+	if err != nil || len(over) != 3 {
+		t.Fatal("MatchProfileFitLimitsOver expected: ", 3, "got: ", len(over), err)
+	}
+	if over[0].Limits.CPUCores != 0.2 || over[0].MSCSetting.Replicas != 3 {
+		t.Error("MatchProfileFitLimitsOver expected first: ", "0.2 cores 3 replicas", "got: ", over[0])
+	}
+	if _, err = dao.MatchProfileFitLimitsOver(1, 1, 40); err != nil {
+		t.Error("MatchProfileFitLimitsOver expected the profiles strictly under the limits", err)
+	}
+
+	under, err := dao.MatchProfileFitLimitsUnder(1, 1, 100)
+	if err != nil || len(under) != 4 {
+		t.Fatal("MatchProfileFitLimitsUnder expected: ", 4, "got: ", len(under), err)
+	}
+	if under[0].MSCSetting.Replicas != 1 || under[len(under)-1].Limits.CPUCores != 1 {
+		t.Error("MatchProfileFitLimitsUnder unexpected order", under)
+	}
+
+	limits, err := dao.FindAllUnderLimits(1, 1)
+	if err != nil || len(limits) != 1 || len(limits[0].MSCSettings) != 0 {
+		t.Error("FindAllUnderLimits expected: ", 1, "got: ", limits, err)
+	}
+}
+
+func TestBootingShutdownTime(t *testing.T) {
+	dao := &VMBootingProfileMemoryDAO{}
+	dao.Insert(types.InstancesBootShutdownTime{VMType:"t2.nano", InstancesValues:[]types.BootShutDownTime{
+		{NumInstances:1, BootTime:240, ShutDownTime:200}, {NumInstances:2, BootTime:300, ShutDownTime:240}}})
+
+	times, err := dao.BootingShutdownTime("t2.nano", 2)
+	if err != nil || times.BootTime != 300 {
+		t.Error("BootingShutdownTime expected: ", 300, "got: ", times.BootTime, err)
+	}
+	if _, err = dao.BootingShutdownTime("t2.micro", 1); err == nil {
+		t.Error("BootingShutdownTime expected an error for a missing VM type")
+	}
+}
+
+func TestPolicyTimeWindowQueries(t *testing.T) {
+	start := time.Date(2018, 11, 1, 7, 0, 0, 0, time.UTC)
+	end := start.Add(47 * time.Hour)
+	selected := types.Policy{ID:bson.NewObjectId(), Status:types.SELECTED, TimeWindowStart:start, TimeWindowEnd:end}
+	discarted := types.Policy{ID:bson.NewObjectId(), Status:types.DISCARTED, TimeWindowStart:start, TimeWindowEnd:end}
+	later := types.Policy{ID:bson.NewObjectId(), Status:types.SCHEDULED, TimeWindowStart:end, TimeWindowEnd:end.Add(time.Hour)}
+
+	dir, err := ioutil.TempDir("", "spdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, backend := range []string{util.STORAGE_MEMORY, util.STORAGE_FILE} {
+		ResetMemoryStorage()
+		SetUpStorage(util.StorageConfiguration{Type:backend, Path:dir})
+		dao := GetPolicyDAO("test")
+		for _, p := range []types.Policy{selected, discarted, later} {
+			dao.Insert(p)
+		}
+
+		policy, err := dao.FindSelectedByTimeWindow(start, end)
+		if err != nil || policy.ID != selected.ID {
+			t.Error(backend, " FindSelectedByTimeWindow expected: ", selected.ID, "got: ", policy.ID, err)
+		}
+		policy, err = dao.FindSelectedByTime(end)
+		if err != nil || policy.ID != later.ID {
+			t.Error(backend, " FindSelectedByTime expected: ", later.ID, "got: ", policy.ID, err)
+		}
+		policies, _ := dao.FindAllByTimeWindow(start, end)
+		if len(policies) != 2 {
+			t.Error(backend, " FindAllByTimeWindow expected: ", 2, "got: ", len(policies))
+		}
+		policies, _ = dao.FindByStartTime(end)
+		if len(policies) != 1 {
+			t.Error(backend, " FindByStartTime expected: ", 1, "got: ", len(policies))
+		}
+		dao.DeleteAllByTimeWindow(start, end)
+		policies, _ = dao.FindAll()
+		if len(policies) != 1 || policies[0].ID != later.ID {
+			t.Error(backend, " DeleteAllByTimeWindow expected remaining: ", later.ID, "got: ", policies)
+		}
+	}
+	SetUpStorage(util.StorageConfiguration{})
+}
+
+func TestBudgetLedgerQueries(t *testing.T) {
+	policyID := bson.NewObjectId()
+	start := time.Date(2018, 11, 30, 20, 0, 0, 0, time.UTC)
+	monthEnd := time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)
+	entries := []types.BudgetEntry{
+		{ID:bson.NewObjectId(), PolicyID:policyID, Month:"2018-11", ExpectedSpend:10, TimeWindowStart:start, TimeWindowEnd:monthEnd},
+		{ID:bson.NewObjectId(), PolicyID:policyID, Month:"2018-12", ExpectedSpend:4, TimeWindowStart:monthEnd, TimeWindowEnd:monthEnd.Add(4 * time.Hour)},
+		{ID:bson.NewObjectId(), PolicyID:bson.NewObjectId(), Month:"2018-11", ExpectedSpend:6, TimeWindowStart:start, TimeWindowEnd:monthEnd},
+	}
+
+	dir, err := ioutil.TempDir("", "spdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, backend := range []string{util.STORAGE_MEMORY, util.STORAGE_FILE} {
+		ResetMemoryStorage()
+		SetUpStorage(util.StorageConfiguration{Type:backend, Path:dir})
+		dao := GetBudgetLedgerDAO("test")
+		for _, e := range entries {
+			dao.Insert(e)
+		}
+
+		month, err := dao.FindByMonth("2018-11")
+		if err != nil || len(month) != 2 {
+			t.Error(backend, " FindByMonth expected: ", 2, "got: ", len(month), err)
+		}
+		//The spend expected after the release time is released, the spend before is kept
+		dao.ReleaseByPolicyID(policyID.Hex(), start.Add(time.Hour))
+		remaining, _ := dao.FindAll()
+		if len(remaining) != 2 || remaining[0].ExpectedSpend != 2.5 || !remaining[0].TimeWindowEnd.Equal(start.Add(time.Hour)) ||
+			remaining[1].ExpectedSpend != 6 {
+			t.Error(backend, " ReleaseByPolicyID expected remaining spend: ", 2.5, 6, "got: ", remaining)
+		}
+	}
+	SetUpStorage(util.StorageConfiguration{})
+}
@@ -101,7 +101,17 @@ func (p *PolicyDAO) FindSelectedByTimeWindow(startTime time.Time, endTime time.T
 	err := p.db.C(p.Collection).
 		Find(bson.M{"window_time_start": bson.M{"$eq":startTime},
 		"window_time_end": bson.M{"$eq":endTime},
-		"status": "selected" }).One(&policy)
+		"status": bson.M{"$in":[]string{types.SELECTED, types.SCHEDULED}} }).One(&policy)
+	return policy,err
+}
+
+//Retrieve the selected policy whose time window contains time t
+func (p *PolicyDAO) FindSelectedByTime(t time.Time) (types.Policy, error) {
+	var policy types.Policy
+	err := p.db.C(p.Collection).
+		Find(bson.M{"window_time_start": bson.M{"$lte":t},
+		"window_time_end": bson.M{"$gt":t},
+		"status": bson.M{"$in":[]string{types.SELECTED, types.SCHEDULED}} }).One(&policy)
 	return policy,err
 }
 
@@ -119,8 +129,8 @@ func (p *PolicyDAO) DeleteById(id string) error {
 
 //Delete all policies for the time window
 func (p *PolicyDAO) DeleteAllByTimeWindow(startTime time.Time, endTime time.Time) error {
-	err := p.db.C(p.Collection).
-		Remove(bson.M{"window_time_start": bson.M{"$gte":startTime},
+	_,err := p.db.C(p.Collection).
+		RemoveAll(bson.M{"window_time_start": bson.M{"$gte":startTime},
 		              "window_time_end": bson.M{"$lte":endTime}})
 	return err
 }
@@ -132,7 +142,7 @@ func (p *PolicyDAO) UpdateById(id bson.ObjectId, policy types.Policy) error {
 	return err
 }
 
-func GetPolicyDAO(serviceName string) *PolicyDAO{
+func getPolicyMongoDAO(serviceName string) *PolicyDAO{
 	if PolicyDB == nil {
 		PolicyDB = &PolicyDAO {
 			Database:DEFAULT_DB_POLICIES,
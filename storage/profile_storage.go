@@ -173,7 +173,7 @@ func (p *PerformanceProfileDAO) FindProfileByLimits(limit types.Limit) (types.Pe
 }
 
 
-func GetPerformanceProfileDAO(serviceName string) *PerformanceProfileDAO {
+func getPerformanceProfileMongoDAO(serviceName string) *PerformanceProfileDAO {
 	if PerformanceProfileDB == nil {
 		PerformanceProfileDB = &PerformanceProfileDAO {
 			Database:DEFAULT_DB_PROFILES,
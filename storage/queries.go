@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"sort"
+	"time"
+)
+
+/*
+	Queries evaluated in memory by the backends that do not rely on MongoDB.
+	They reproduce the filters and aggregation pipelines used by the Mongo DAOs.
+*/
+
+//Select the policies that satisfy the condition
+func filterPolicies(policies []types.Policy, match func(policy types.Policy) bool) []types.Policy {
+	var result []types.Policy
+	for _,p := range policies {
+		if match(p) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+//Condition for policies whose window starts and ends within the given times
+func policyWithinWindow(startTime time.Time, endTime time.Time) func(policy types.Policy) bool {
+	return func(policy types.Policy) bool {
+		return !policy.TimeWindowStart.Before(startTime) && !policy.TimeWindowEnd.After(endTime)
+	}
+}
+
+//Condition for policies whose window is exactly the given one
+func policyExactWindow(startTime time.Time, endTime time.Time) func(policy types.Policy) bool {
+	return func(policy types.Policy) bool {
+		return policy.TimeWindowStart.Equal(startTime) && policy.TimeWindowEnd.Equal(endTime)
+	}
+}
+
+/*
+	Find the profile with the given limits and keep only the MSC setting for the number of replicas
+	in:
+		@profiles []types.PerformanceProfile
+		@cores float64
+		@memory float64
+		@replicas int
+	out:
+		@PerformanceProfile
+		@error
+*/
+func profileByLimitsAndReplicas(profiles []types.PerformanceProfile, cores float64, memory float64, replicas int) (types.PerformanceProfile, error) {
+	for _,p := range profiles {
+		if p.Limit.CPUCores != cores || p.Limit.MemoryGB != memory {
+			continue
+		}
+		for _,msc := range p.MSCSettings {
+			if msc.Replicas == replicas {
+				return types.PerformanceProfile{ID:p.ID, Limit:p.Limit, MSCSettings:[]types.MSCSimpleSetting{msc}}, nil
+			}
+		}
+	}
+	return types.PerformanceProfile{}, ErrNotFound
+}
+
+/*
+	Unwind the MSC settings of the profiles that pass the limits filter and the MSC filter
+	in:
+		@profiles []types.PerformanceProfile
+		@fitLimits func(types.Limit) bool
+		@fitMSC func(types.MSCSimpleSetting) bool
+	out:
+		@[]types.ContainersConfig
+*/
+func unwindProfiles(profiles []types.PerformanceProfile, fitLimits func(limit types.Limit) bool,
+	fitMSC func(msc types.MSCSimpleSetting) bool) []types.ContainersConfig {
+	var result []types.ContainersConfig
+	for _,p := range profiles {
+		if !fitLimits(p.Limit) {
+			continue
+		}
+		for _,msc := range p.MSCSettings {
+			if fitMSC(msc) {
+				result = append(result, types.ContainersConfig{Limits:p.Limit, MSCSetting:msc})
+			}
+		}
+	}
+	return result
+}
+
+//Sort containers configurations by cpu, memory, replicas and MSC (ascending or descending)
+func sortContainersConfig(configs []types.ContainersConfig, ascendingMSC bool) {
+	sort.SliceStable(configs, func(i, j int) bool {
+		ci, cj := configs[i], configs[j]
+		if ci.Limits.CPUCores != cj.Limits.CPUCores {
+			return ci.Limits.CPUCores < cj.Limits.CPUCores
+		}
+		if ci.Limits.MemoryGB != cj.Limits.MemoryGB {
+			return ci.Limits.MemoryGB < cj.Limits.MemoryGB
+		}
+		if ci.MSCSetting.Replicas != cj.MSCSetting.Replicas {
+			return ci.MSCSetting.Replicas < cj.MSCSetting.Replicas
+		}
+		if ascendingMSC {
+			return ci.MSCSetting.MSCPerSecond < cj.MSCSetting.MSCPerSecond
+		}
+		return ci.MSCSetting.MSCPerSecond > cj.MSCSetting.MSCPerSecond
+	})
+}
+
+//Profiles that fit strictly into the limits and provide at least the number of requests
+func matchProfileFitLimitsOver(profiles []types.PerformanceProfile, cores float64, memory float64, requests float64) []types.ContainersConfig {
+	result := unwindProfiles(profiles,
+		func(limit types.Limit) bool { return limit.CPUCores < cores && limit.MemoryGB < memory },
+		func(msc types.MSCSimpleSetting) bool { return msc.MSCPerSecond >= requests })
+	sortContainersConfig(result, true)
+	return result
+}
+
+//Profiles that fit into the limits and provide less than the number of requests
+func matchProfileFitLimitsUnder(profiles []types.PerformanceProfile, cores float64, memory float64, requests float64) []types.ContainersConfig {
+	result := unwindProfiles(profiles,
+		func(limit types.Limit) bool { return limit.CPUCores <= cores && limit.MemoryGB <= memory },
+		func(msc types.MSCSimpleSetting) bool { return msc.MSCPerSecond < requests })
+	sortContainersConfig(result, false)
+	return result
+}
+
+//Limits of the profiles that fit strictly into the given cores and memory
+func profilesUnderLimits(profiles []types.PerformanceProfile, cores float64, memory float64) []types.PerformanceProfile {
+	var result []types.PerformanceProfile
+	for _,p := range profiles {
+		if p.Limit.CPUCores < cores && p.Limit.MemoryGB < memory {
+			result = append(result, types.PerformanceProfile{Limit:p.Limit})
+		}
+	}
+	return result
+}
+
+//Profile configured with exactly the given limits
+func profileByLimits(profiles []types.PerformanceProfile, limit types.Limit) (types.PerformanceProfile, error) {
+	for _,p := range profiles {
+		if p.Limit.CPUCores == limit.CPUCores && p.Limit.MemoryGB == limit.MemoryGB {
+			return p, nil
+		}
+	}
+	return types.PerformanceProfile{}, ErrNotFound
+}
+
+//Booting profile for the given VM type
+func bootingProfileByType(profiles []types.InstancesBootShutdownTime, vmType string) (types.InstancesBootShutdownTime, error) {
+	for _,p := range profiles {
+		if p.VMType == vmType {
+			return p, nil
+		}
+	}
+	return types.InstancesBootShutdownTime{}, ErrNotFound
+}
+
+//Booting and shutdown times for a VM type and number of instances
+func bootingShutdownTime(profiles []types.InstancesBootShutdownTime, vmType string, numInstances int) (types.BootShutDownTime, error) {
+	for _,p := range profiles {
+		if p.VMType != vmType {
+			continue
+		}
+		for _,v := range p.InstancesValues {
+			if v.NumInstances == numInstances {
+				return v, nil
+			}
+		}
+	}
+	return types.BootShutDownTime{}, ErrNotFound
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"github.com/Cloud-Pie/SPDT/types"
+	"github.com/Cloud-Pie/SPDT/util"
+	"gopkg.in/mgo.v2/bson"
+	"errors"
+	"time"
+)
+
+//Error returned by the backends when a query does not match any stored element
+var ErrNotFound = errors.New("not found")
+
+//Storage backend selected in the configuration file
+var storageConfiguration = util.StorageConfiguration {
+	Type:util.STORAGE_MONGODB,
+	Path:util.DEFAULT_STORAGE_PATH,
+}
+
+//Interface to access the stored scaling policies
+type PolicyStorage interface {
+	FindAll() ([]types.Policy, error)
+	FindByID(id string) (types.Policy, error)
+	FindByStartTime(time time.Time) ([]types.Policy, error)
+	FindByEndTime(time time.Time) ([]types.Policy, error)
+	FindAllByTimeWindow(startTime time.Time, endTime time.Time) ([]types.Policy, error)
+	FindOneByTimeWindow(startTime time.Time, endTime time.Time) (types.Policy, error)
+	FindSelectedByTimeWindow(startTime time.Time, endTime time.Time) (types.Policy, error)
+	FindSelectedByTime(t time.Time) (types.Policy, error)
+	Insert(policy types.Policy) error
+	DeleteById(id string) error
+	DeleteAllByTimeWindow(startTime time.Time, endTime time.Time) error
+	UpdateById(id bson.ObjectId, policy types.Policy) error
+}
+
+//Interface to access the ledger with the expected spend of the selected policies
+type BudgetLedgerStorage interface {
+	FindAll() ([]types.BudgetEntry, error)
+	FindByMonth(month string) ([]types.BudgetEntry, error)
+	Insert(entry types.BudgetEntry) error
+	ReleaseByPolicyID(id string, timeRelease time.Time) error
+}
+
+//Interface to access the stored forecasts
+type ForecastStorage interface {
+	FindAll() ([]types.Forecast, error)
+	FindByID(id string) (types.Forecast, error)
+	Insert(forecast types.Forecast) error
+	Delete(forecast types.Forecast) error
+	Update(id bson.ObjectId, forecast types.Forecast) error
+	DeleteAllBeforeDate(timestamp time.Time) error
+	FindOneByTimeWindow(startTime time.Time, endTime time.Time) (types.Forecast, error)
+}
+
+//Interface to access the stored performance profiles of a service
+type PerformanceProfileStorage interface {
+	FindAll() ([]types.PerformanceProfile, error)
+	FindByID(id string) (types.PerformanceProfile, error)
+	Insert(performanceProfile types.PerformanceProfile) error
+	Delete(performanceProfile types.PerformanceProfile) error
+	DeleteAll() error
+	UpdateById(id bson.ObjectId, performanceProfile types.PerformanceProfile) error
+	FindByLimitsAndReplicas(cores float64, memory float64, replicas int) (types.PerformanceProfile, error)
+	MatchProfileFitLimitsOver(cores float64, memory float64, requests float64) ([]types.ContainersConfig, error)
+	FindAllUnderLimits(cores float64, memory float64) ([]types.PerformanceProfile, error)
+	MatchProfileFitLimitsUnder(cores float64, memory float64, requests float64) ([]types.ContainersConfig, error)
+	FindProfileByLimits(limit types.Limit) (types.PerformanceProfile, error)
+}
+
+//Interface to access the stored booting and shutdown times of the VM types
+type VMBootingProfileStorage interface {
+	FindAll() ([]types.InstancesBootShutdownTime, error)
+	FindByType(vmType string) (types.InstancesBootShutdownTime, error)
+	Insert(vmBootingProfile types.InstancesBootShutdownTime) error
+	UpdateByType(vmType string, vmBootingProfile types.InstancesBootShutdownTime) error
+	BootingShutdownTime(vmType string, numInstances int) (types.BootShutDownTime, error)
+	InstanceVMBootingShutdown(vmType string) (types.InstancesBootShutdownTime, error)
+	DeleteAll() error
+}
+
+/* Select the storage backend used by the DAO factories
+	in:
+		@config util.StorageConfiguration
+*/
+func SetUpStorage(config util.StorageConfiguration) {
+	if config.Type == "" {
+		config.Type = util.STORAGE_MONGODB
+	}
+	if config.Path == "" {
+		config.Path = util.DEFAULT_STORAGE_PATH
+	}
+	if config.Type != util.STORAGE_MONGODB && config.Type != util.STORAGE_FILE && config.Type != util.STORAGE_MEMORY {
+		log.Warning("Storage type %s not supported, %s is used instead", config.Type, util.STORAGE_MONGODB)
+		config.Type = util.STORAGE_MONGODB
+	}
+	storageConfiguration = config
+}
+
+//Retrieve the data access object for the policies of a service
+func GetPolicyDAO(serviceName string) PolicyStorage {
+	if storageConfiguration.Type == util.STORAGE_FILE {
+		return &PolicyFileDAO{
+			Path:storageConfiguration.Path,
+			Database:DEFAULT_DB_POLICIES,
+			Collection:DEFAULT_DB_COLLECTION_POLICIES + "_" + serviceName,
+		}
+	} else if storageConfiguration.Type == util.STORAGE_MEMORY {
+		key := DEFAULT_DB_POLICIES + "/" + DEFAULT_DB_COLLECTION_POLICIES + "_" + serviceName
+		return memoryCollection(key, &PolicyMemoryDAO{}).(*PolicyMemoryDAO)
+	}
+	return getPolicyMongoDAO(serviceName)
+}
+
+//Retrieve the data access object for the budget ledger of a service, stored alongside its policies
+func GetBudgetLedgerDAO(serviceName string) BudgetLedgerStorage {
+	if storageConfiguration.Type == util.STORAGE_FILE {
+		return &BudgetLedgerFileDAO{
+			Path:storageConfiguration.Path,
+			Database:DEFAULT_DB_POLICIES,
+			Collection:DEFAULT_DB_COLLECTION_BUDGET + "_" + serviceName,
+		}
+	} else if storageConfiguration.Type == util.STORAGE_MEMORY {
+		key := DEFAULT_DB_POLICIES + "/" + DEFAULT_DB_COLLECTION_BUDGET + "_" + serviceName
+		return memoryCollection(key, &BudgetLedgerMemoryDAO{}).(*BudgetLedgerMemoryDAO)
+	}
+	return getBudgetLedgerMongoDAO(serviceName)
+}
+
+//Retrieve the data access object for the forecasts of a service
+func GetForecastDAO(serviceName string) ForecastStorage {
+	if storageConfiguration.Type == util.STORAGE_FILE {
+		return &ForecastFileDAO{
+			Path:storageConfiguration.Path,
+			Database:DEFAULT_DB_FORECAST,
+			Collection:DEFAULT_DB_COLLECTION_FORECAST + "_" + serviceName,
+		}
+	} else if storageConfiguration.Type == util.STORAGE_MEMORY {
+		key := DEFAULT_DB_FORECAST + "/" + DEFAULT_DB_COLLECTION_FORECAST + "_" + serviceName
+		return memoryCollection(key, &ForecastMemoryDAO{}).(*ForecastMemoryDAO)
+	}
+	return getForecastMongoDAO(serviceName)
+}
+
+//Retrieve the data access object for the performance profiles of a service
+func GetPerformanceProfileDAO(serviceName string) PerformanceProfileStorage {
+	if storageConfiguration.Type == util.STORAGE_FILE {
+		return &PerformanceProfileFileDAO{
+			Path:storageConfiguration.Path,
+			Database:DEFAULT_DB_PROFILES,
+			Collection:DEFAULT_DB_COLLECTION_PROFILES + "_" + serviceName,
+		}
+	} else if storageConfiguration.Type == util.STORAGE_MEMORY {
+		key := DEFAULT_DB_PROFILES + "/" + DEFAULT_DB_COLLECTION_PROFILES + "_" + serviceName
+		return memoryCollection(key, &PerformanceProfileMemoryDAO{}).(*PerformanceProfileMemoryDAO)
+	}
+	return getPerformanceProfileMongoDAO(serviceName)
+}
+
+//Retrieve the data access object for the VM booting profiles
+func GetVMBootingProfileDAO() VMBootingProfileStorage {
+	if storageConfiguration.Type == util.STORAGE_FILE {
+		return &VMBootingProfileFileDAO{
+			Path:storageConfiguration.Path,
+			Database:DEFAULT_DB_PROFILES,
+			Collection:DEFAULT_DB_COLLECTION_VM_PROFILES,
+		}
+	} else if storageConfiguration.Type == util.STORAGE_MEMORY {
+		key := DEFAULT_DB_PROFILES + "/" + DEFAULT_DB_COLLECTION_VM_PROFILES
+		return memoryCollection(key, &VMBootingProfileMemoryDAO{}).(*VMBootingProfileMemoryDAO)
+	}
+	return getVMBootingProfileMongoDAO()
+}
@@ -102,7 +102,7 @@ func (p *VMBootingProfileDAO) DeleteAll() error {
 	return err
 }
 
-func GetVMBootingProfileDAO() *VMBootingProfileDAO {
+func getVMBootingProfileMongoDAO() *VMBootingProfileDAO {
 	if VMBootingProfileDB == nil {
 		VMBootingProfileDB = &VMBootingProfileDAO {
 			Database:DEFAULT_DB_PROFILES,
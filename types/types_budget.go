@@ -0,0 +1,24 @@
+package types
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+//Expected spend of a selected policy in a calendar month
+type BudgetEntry struct {
+	ID              bson.ObjectId	`json:"id" bson:"_id"`
+	PolicyID        bson.ObjectId	`json:"policy_id" bson:"policy_id"`
+	Month           string		`json:"month" bson:"month"`
+	ExpectedSpend   float64		`json:"expected_spend" bson:"expected_spend"`
+	TimeWindowStart time.Time	`json:"window_time_start" bson:"window_time_start"`
+	TimeWindowEnd   time.Time	`json:"window_time_end" bson:"window_time_end"`
+}
+
+//Budget of a calendar month and the spend expected by the selected policies
+type MonthlyBudget struct {
+	Month         string	`json:"month"`
+	Budget        float64	`json:"budget"`
+	ExpectedSpend float64	`json:"expected_spend"`
+	Remaining     float64	`json:"remaining"`
+}
@@ -0,0 +1,17 @@
+package types
+
+//VM profiles of a provider and region, with their prices and booting times
+type Catalog struct {
+	CSP             string
+	Region          string
+	VMProfiles      []VmProfile
+	BootingProfiles []InstancesBootShutdownTime
+}
+
+//Policy selected with the VM profiles of a catalog, compared side by side with the other catalogs
+type CatalogPolicy struct {
+	CSP    string	`json:"csp"`
+	Region string	`json:"region"`
+	Policy Policy	`json:"policy"`
+	Error  string	`json:"error,omitempty"`
+}
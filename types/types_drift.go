@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+//Drift between the state that the selected policy expects at a time and the actual state of the infrastructure
+type StateDrift struct {
+	Time           time.Time      `json:"time"`
+	PolicyID       string         `json:"policy_id"`
+	ExpectedState  State          `json:"expected_state"`
+	ActualState    State          `json:"actual_state"`
+	MissingVMs     VMScale        `json:"missing_vms"`
+	ExtraVMs       VMScale        `json:"extra_vms"`
+	WrongReplicas  map[string]int `json:"wrong_replicas"`  //Actual minus expected replicas of each service
+	LateTransition bool           `json:"late_transition"` //The expected state should have started but it was not reached
+	Magnitude      float64        `json:"magnitude"`       //Fraction of the expected VMs or replicas not matched
+	Rederived      bool           `json:"rederived"`       //A new policy was derived from the actual state
+}
@@ -13,10 +13,12 @@ type CriticalInterval struct {
 	TimePeak time.Time
 }
 
-/*Represent the number of requests for a time T*/
+/*Represent the number of requests for a time T, optionally with the bounds of its prediction interval*/
 type ForecastedValue struct {
 	TimeStamp   time.Time	`json:"timestamp"`
 	Requests	float64         `json:"requests"`
+	UpperBound	float64         `json:"upper_bound,omitempty" bson:"upper_bound,omitempty"`
+	LowerBound	float64         `json:"lower_bound,omitempty" bson:"lower_bound,omitempty"`
 }
 
 /*Set of values received from the Forecasting component*/
@@ -27,6 +29,14 @@ type Forecast struct {
 	TimeWindowStart  time.Time         `json:"start_time"  bson:"start_time"`
 	TimeWindowEnd    time.Time         `json:"end_time"  bson:"end_time"`
 	IDPrediction     string            `json:"id"  bson:"id_predictions"`
+	ObservedValues   []ForecastedValue `json:"observed_values,omitempty"  bson:"observed_values,omitempty"`	//Requests observed in the time window
+}
+
+/*Error of a forecast measured with the observed requests*/
+type ForecastError struct {
+	MAPE	float64	`json:"mape"`	//Mean absolute percentage error
+	Bias	float64	`json:"bias"`	//Percentage by which the observed requests exceed (positive) or fall short of (negative) the forecast
+	Samples	int	`json:"samples"`
 }
 
 /*ProcessedForecast metadata after processing the time serie*/
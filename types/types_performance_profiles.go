@@ -1,10 +1,43 @@
 package types
 
-import "gopkg.in/mgo.v2/bson"
+import (
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
 
 type Pricing struct {
 	Price float64	`json:"price" bson:"price"`
 	Unit string		`json:"unit" bson:"unit"`
+	SpotPrice float64	`json:"spot_price,omitempty" bson:"spot_price,omitempty"`
+	InterruptionRate float64	`json:"interruption_rate,omitempty" bson:"interruption_rate,omitempty"`	//Probability per hour that a spot VM is interrupted
+}
+
+//Suffix that identifies the spot VMs of a type in a VM set
+const SPOT_SUFFIX = "-spot"
+
+//Key of the spot VMs of a type in a VM set
+func SpotVMType(vmType string) string {
+	return vmType + SPOT_SUFFIX
+}
+
+//Check if the key of a VM set refers to spot VMs
+func IsSpotVMType(vmType string) bool {
+	return strings.HasSuffix(vmType, SPOT_SUFFIX)
+}
+
+//VM type of the key of a VM set, either spot or on-demand
+func OnDemandVMType(vmType string) string {
+	return strings.TrimSuffix(vmType, SPOT_SUFFIX)
+}
+
+//Profile of the key of a VM set. Spot VMs take the profile of their type with the spot price
+func VMProfileByType(mapVMProfiles map[string] VmProfile, vmType string) VmProfile {
+	profile := mapVMProfiles[OnDemandVMType(vmType)]
+	if IsSpotVMType(vmType) {
+		profile.Type = vmType
+		profile.Pricing.Price = profile.Pricing.SpotPrice
+	}
+	return profile
 }
 
 type VmProfile struct {
@@ -34,7 +34,7 @@ func (vmSetTarget VMScale) Merge(vmSource VMScale){
 func (vmSet VMScale) Cost(mapVMProfiles map[string] VmProfile) float64{
 	cost := float64(0.0)
 	for k,v := range vmSet {
-		cost += mapVMProfiles[k].Pricing.Price * float64(v)
+		cost += VMProfileByType(mapVMProfiles, k).Pricing.Price * float64(v)
 	}
 	return cost
 }
@@ -43,7 +43,7 @@ func (vmSet VMScale) Cost(mapVMProfiles map[string] VmProfile) float64{
 func (vmSet VMScale) ReplicasCapacity(mapVMProfiles map[string] VmProfile) int{
 	totalCapacity :=0
 	for k,v := range vmSet {
-		totalCapacity += mapVMProfiles[k].ReplicasCapacity * v
+		totalCapacity += VMProfileByType(mapVMProfiles, k).ReplicasCapacity * v
 	}
 	return totalCapacity
 }
@@ -58,6 +58,41 @@ func (vmSet VMScale) TotalVMs() int{
 }
 
 
+/*Function that returns the VM set with the spot VMs counted as on-demand VMs of their type*/
+func (vmSet VMScale) OnDemandVMSet() VMScale {
+	onDemandVMSet := make(VMScale)
+	for k,v := range vmSet {
+		onDemandVMSet[OnDemandVMType(k)] += v
+	}
+	return onDemandVMSet
+}
+
+/*Function that splits the VM set into its on-demand VMs and its spot VMs, both keyed by their VM type*/
+func (vmSet VMScale) SplitByMarket() (VMScale, VMScale) {
+	onDemandVMs := make(VMScale)
+	spotVMs := make(VMScale)
+	for k,v := range vmSet {
+		if IsSpotVMType(k) {
+			spotVMs[OnDemandVMType(k)] += v
+		} else {
+			onDemandVMs[k] += v
+		}
+	}
+	return onDemandVMs, spotVMs
+}
+
+/*Function that joins on-demand VMs and spot VMs keyed by their VM type into one VM set*/
+func JoinByMarket(onDemandVMs VMScale, spotVMs VMScale) VMScale {
+	vmSet := make(VMScale)
+	for k,v := range onDemandVMs {
+		vmSet[k] += v
+	}
+	for k,v := range spotVMs {
+		vmSet[SpotVMType(k)] += v
+	}
+	return vmSet
+}
+
 /*Function that compares if two vmSets are equal*/
 func (vmSet VMScale) Equal(vmSet2 VMScale) bool {
 	if len(vmSet) != len(vmSet2) {
@@ -151,6 +186,8 @@ type ConfigMetrics struct {
 	ShadowTimeSec      float64 `json:"shadow_time_sec" bson:"shadow_time_sec"`
 	TransitionTimeSec  float64 `json:"transition_time_sec" bson:"transition_time_sec"`
 	ElapsedTimeSec     float64 `json:"elapsed_time_sec" bson:"elapsed_time_sec"`
+	BudgetLimited      bool    `json:"budget_limited" bson:"budget_limited"`
+	ServicesCapacity   map[string]float64 `json:"services_capacity,omitempty" bson:"services_capacity,omitempty"`	//Requests served by the replicas of each service
 }
 
 type PolicyMetrics struct {
@@ -166,6 +203,11 @@ type PolicyMetrics struct {
 	AvgShadowTime 				  float64		`json:"avg_shadow_time_sec" bson:"avg_shadow_time_sec"`
 	AvgTransitionTime 			  float64		`json:"avg_transition_time_sec" bson:"avg_transition_time_sec"`
 	AvgElapsedTime 			      float64		`json:"avg_time_between_scaling_sec" bson:"avg_time_between_scaling_sec"`
+	Score 			              float64		`json:"score,omitempty" bson:"score,omitempty"`
+	ExpectedCost                  float64		`json:"expected_cost" bson:"expected_cost"`
+	ExpectedCapacityLoss          float64		`json:"expected_capacity_loss" bson:"expected_capacity_loss"`
+	ServicesOverProvision         map[string]float64	`json:"services_over_provision,omitempty" bson:"services_over_provision,omitempty"`
+	ServicesUnderProvision        map[string]float64	`json:"services_under_provision,omitempty" bson:"services_under_provision,omitempty"`
 }
 
 /*Resource configuration*/
@@ -176,6 +218,7 @@ type ScalingAction struct {
 	TimeStart        time.Time     `json:"time_start" bson:"time_start"`
 	TimeEnd          time.Time     `json:"time_end" bson:"time_end"`
 	Metrics          ConfigMetrics `json:"metrics" bson:"metrics"`
+	Invalidated      bool          `json:"invalidated" bson:"invalidated"`	//Replaced by a policy derived later
 }
 
 
@@ -187,6 +230,12 @@ const (
 	ISHETEREOGENEOUS= "heterogeneous-vms-allowed"
 	ISRESIZEPODS= "pods-resize-allowed"
 	VMTYPES= "vm-types"
+	SERVICES= "services"
+	ISSPOTINSTANCES= "spot-instances-allowed"
+	ONDEMANDBASELINE= "on-demand-baseline"
+	ISBUDGETLIMITED= "budget-limited"
+	ISOVERBUDGET= "over-budget"
+	SIZINGQUANTILE= "sizing-quantile"
 
 )
 
@@ -195,6 +244,8 @@ const (
 	DISCARTED = "discarted"
 	SCHEDULED = "scheduled"
 	SELECTED = "selected"
+	CANDIDATE = "candidate"
+	FAILED = "failed"
 	)
 
 //Policy states the scaling transitions
@@ -207,7 +258,14 @@ type Policy struct {
 	ScalingActions  []ScalingAction   `json:"scaling_actions" bson:"scaling_actions"`
 	TimeWindowStart time.Time         `json:"window_time_start"  bson:"window_time_start"`
 	TimeWindowEnd   time.Time         `json:"window_time_end"  bson:"window_time_end"`
+	Scheduling      SchedulingOutcome `json:"scheduling" bson:"scheduling"`
+}
 
+//Outcome of scheduling the selected policy
+type SchedulingOutcome struct {
+	Attempts   int       `json:"attempts" bson:"attempts"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	FinishTime time.Time `json:"finish_time" bson:"finish_time"`
 }
 
 //Utility struct to represent a key value object
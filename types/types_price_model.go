@@ -1,11 +1,16 @@
 package types
 
+//Prices of the VM types offered by a CSP in a region
 type PriceModel struct{
-	VMPrices []VMPrice	`yaml:"vm-prices"`
+	CSP string	`yaml:"CSP" json:"CSP"`
+	Region string	`yaml:"region" json:"region"`
+	VMPrices []VMPrice	`yaml:"vm-prices" json:"vm-prices"`
 }
 
 type VMPrice struct{
-	VmType string	`yaml:"type"`
-	Price float64	`yaml:"price"`
-	Unit string	`yaml:"unit"`
+	VmType string	`yaml:"type" json:"type"`
+	Price float64	`yaml:"price" json:"price"`
+	Unit string	`yaml:"unit" json:"unit"`
+	SpotPrice float64	`yaml:"spot-price" json:"spot-price"`
+	InterruptionRate float64	`yaml:"interruption-rate" json:"interruption-rate"`
 }
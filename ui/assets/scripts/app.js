@@ -1,4 +1,5 @@
 var policiesEndpoint = ''
+var policiesQuery = ''
 var forecastRequestsEndpoint = ''
 
 var allPolicies = []
@@ -454,6 +455,7 @@ function searchByTimestamp() {
 
     appName = document.getElementById("appNameid").value;
     policiesEndpoint = '/api/'+appName+'/policies'
+    policiesQuery = query
     policiesRequest = policiesEndpoint +"?" + query
     fetch(policiesRequest)
         .then((response) => response.json())
@@ -480,6 +482,8 @@ function fillCandidateTable(policyCandidates) {
         label = "label-warning"
         if (policyCandidates[i].status == "selected") {
             label = "label-success"
+        } else if (policyCandidates[i].status == "candidate") {
+            label = "label-info"
         }
 
         $("#tCandidates > tbody").append("<tr>" +
@@ -546,8 +550,27 @@ function fillDetailsTable(policy) {
 }
 
 function clickedCompareAll(){
+    comparePolicies(allPolicies)
+}
+
+function clickedCompareParetoFront(){
+    appName = document.getElementById("appNameid").value;
+    fetch('/api/'+appName+'/pareto-front?' + policiesQuery)
+        .then((response) => response.json())
+        .then(function (data){
+            if(data.length > 0) {
+                fillCandidateTable(data)
+                comparePolicies(data)
+            }
+        })
+        .catch(function(err) {
+            console.log('Fetch Error :-S', err);
+        });
+}
+
+function comparePolicies(policies){
     showMultiplePolicyPanels()
-    units = getVirtualUnitsAll(allPolicies)
+    units = getVirtualUnitsAll(policies)
     plotCapacityAll(requestDemand, units.trnAll, units.timesAll, units.tracesAll)
     plotReplicasAll(units.replicasAll,units.timesAll, units.tracesAll)
     plotAccumulatedCostAll(units.time, units.accumulatedCostAll, units.tracesAll)
@@ -13,7 +13,38 @@ const SCALE_METHOD_HORIZONTAL = "horizontal"
 const SCALE_METHOD_VERTICAL = "vertical"
 const SCALE_METHOD_HYBRID = "hybrid"
 
+//Native forecaster
+const NATIVE_FORECASTER_PRIMARY = "primary"
+const NATIVE_FORECASTER_FALLBACK = "fallback"
+const SEASONAL_NAIVE = "seasonal-naive"
+const HOLT_WINTERS = "holt-winters"
+const MOVING_AVERAGE = "moving-average"
+const DEFAULT_SEASON_LENGTH = 24
+const DEFAULT_MOVING_AVERAGE_WINDOW = 24
+const DEFAULT_HOLT_WINTERS_ALPHA = 0.5
+const DEFAULT_HOLT_WINTERS_BETA = 0.1
+const DEFAULT_HOLT_WINTERS_GAMMA = 0.3
+
+//Quantiles of the forecast used to size the scaling intervals
+const QUANTILE_MEAN = "mean"
+const QUANTILE_P90 = "p90"
+const QUANTILE_UPPER_BOUND = "upper"
+const DEFAULT_BOUNDS_CONFIDENCE = 95.0
+
+//critical intervals
+const INTERVALS_WINDOWING = "windowing"
+const INTERVALS_POI = "poi"
+const AGGREGATION_MAX = "max"
+const AGGREGATION_MEAN = "mean"
+const AGGREGATION_PERCENTILE = "percentile"
+const DEFAULT_INTERVALS_COOLDOWN = 300.0
+const DEFAULT_AGGREGATION_PERCENTILE = 90.0
+
 //metrics
 const COST = "cost"
 const DERIVATION_TIME = "derivation-time"
-const TRANSITION_TIME = "transition-time"
\ No newline at end of file
+const TRANSITION_TIME = "transition-time"
+const UNDER_PROVISION = "under-provision"
+const OVER_PROVISION = "over-provision"
+const NUMBER_SCALING_ACTIONS = "scaling-actions"
+const WEIGHTED_METRICS = "weighted"
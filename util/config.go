@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"gopkg.in/yaml.v2"
 	"log"
+	"errors"
 )
 
 //Struct that models the external components to which SPDT should be connected
@@ -13,12 +14,55 @@ type Component struct {
 	Username string	`yaml:"username"`
 	Password string	`yaml:"password"`
 	ApiKey string	`yaml:"api-key"`
+	Type string	`yaml:"type"`	//Backend of the scheduler component: spdt (default), kubernetes or file
+	Kubernetes KubernetesConfiguration	`yaml:"kubernetes"`
+	File FileExecutorConfiguration	`yaml:"file"`
+	Retries int	`yaml:"retries"`	//Number of times the scheduling of a policy is retried, none if negative
+	RetryBackoff float64	`yaml:"retry-backoff"`	//Seconds before the first retry, doubled for each retry
+}
+
+//Plan written by the file backend of the scheduler component
+type FileExecutorConfiguration struct {
+	Path             string `yaml:"path"`               //./plan.json by default, - for the standard output
+	CurrentStatePath string `yaml:"current-state-file"` //Current state used until a state of the plan is launched
+}
+
+//Cluster scaled by the kubernetes backend of the scheduler component
+type KubernetesConfiguration struct {
+	Namespace           string            `yaml:"namespace"`             //Namespace of the deployments of the services
+	NodeGroupsNamespace string            `yaml:"node-groups-namespace"` //Namespace of the machine deployments of the node groups
+	NodeGroups          map[string]string `yaml:"node-groups"`           //Machine deployment of each VM type, named as the VM type by default
+	SpotNodeGroups      map[string]string `yaml:"spot-node-groups"`      //Machine deployment of the spot VMs of each VM type, named as the VM type with the -spot suffix by default
+	Containers          map[string]string `yaml:"containers"`            //Container of the deployment of each service, named as the service or the only container by default
 }
 
 //Struct that models the external components to which SPDT should be connected
 type ForecastComponent struct {
 	Endpoint string	`yaml:"endpoint"`
 	Granularity string	`yaml:"granularity"`
+	NativeForecaster NativeForecaster	`yaml:"native-forecaster"`
+	BoundsConfidence float64	`yaml:"bounds-confidence"`	//Confidence level in percentage of the prediction bounds
+	Intervals IntervalSettings	`yaml:"intervals"`
+}
+
+//Extraction of the critical intervals from the forecast
+type IntervalSettings struct {
+	Strategy    string  `yaml:"strategy"`    //windowing or poi
+	Cooldown    float64 `yaml:"cooldown"`    //Minimum seconds between the start of two intervals
+	Aggregation string  `yaml:"aggregation"` //max, mean or percentile of the values in an interval
+	Percentile  float64 `yaml:"percentile"`
+	MinLength   float64 `yaml:"min-length"`  //Minimum seconds of an interval
+}
+
+//Forecaster built in SPDT that predicts the load from the stored history of each service
+type NativeForecaster struct {
+	Mode         string  `yaml:"mode"`          //primary, fallback or disabled when empty
+	Method       string  `yaml:"method"`
+	SeasonLength int     `yaml:"season-length"` //Number of values in a season
+	Window       int     `yaml:"window"`        //Number of values averaged by the moving average
+	Alpha        float64 `yaml:"alpha"`         //Smoothing of the level
+	Beta         float64 `yaml:"beta"`          //Smoothing of the trend
+	Gamma        float64 `yaml:"gamma"`         //Smoothing of the seasonality
 }
 
 //The future timespan for which the autoscaling policy is derived
@@ -31,11 +75,63 @@ type ScalingHorizon struct {
 type PricingModel struct {
 	Budget      float64 `yaml:"monthly-budget"`
 	BillingUnit string  `yaml:"billing-unit"`
+	ReservedInstances []ReservedInstance `yaml:"reserved-instances"`
+	PricesFile  string  `yaml:"vm-prices-file"`
+	MinimumBilledSeconds int `yaml:"minimum-billed-seconds"`
+	MonthlyCapHours float64 `yaml:"monthly-cap-hours"`	//Maximum hours billed per VM and month, 0 without cap
+}
+
+//VMs of a type reserved for a term, charged at their committed rate even if they are not used
+type ReservedInstance struct {
+	VMType       string  `yaml:"type"`
+	Number       int     `yaml:"number"`
+	Price        float64 `yaml:"price"`         //Price per hour of each VM
+	UpfrontPrice float64 `yaml:"upfront-price"` //Price paid at the beginning of the term for each VM
+	TermMonths   int     `yaml:"term-months"`
+}
+
+//Committed price per hour of each reserved VM, with the upfront price amortized over the term
+func (reserved ReservedInstance) HourlyRate() float64 {
+	termMonths := reserved.TermMonths
+	if termMonths <= 0 {
+		termMonths = DEFAULT_RESERVATION_TERM_MONTHS
+	}
+	return reserved.Price + reserved.UpfrontPrice / (float64(termMonths) * HOURS_PER_MONTH)
+}
+
+//Backend used to store policies, forecasts and profiles
+type StorageConfiguration struct {
+	Type string	`yaml:"type"`
+	Path string	`yaml:"path"`
 }
 
 type PolicySettings struct{
 	ScalingMethod            string  `yaml:"vm-scaling-method"`
 	PreferredMetric        string    `yaml:"preferred-metric"`
+	MetricWeights          map[string]float64 `yaml:"metric-weights"`
+	UnderprovisioningAllowed bool    `yaml:"underprovisioning-allowed"`
+	MaxUnderprovision      float64   `yaml:"max-percentage-underprovision"`
+	SpotInstancesAllowed   bool      `yaml:"spot-instances-allowed"`
+	OnDemandBaseline       float64   `yaml:"on-demand-baseline"`
+	SizingQuantile         string    `yaml:"sizing-quantile"`
+	MinimumHold            float64   `yaml:"minimum-hold"`       //Minimum seconds that a scaling action lasts
+	MinimumVMScalingGap    float64   `yaml:"minimum-vm-scaling-gap"` //Minimum seconds between two scaling actions that change the VMs
+}
+
+//Service of the application scaled together with the others. Its forecast is requested
+//to its own forecast endpoint, or to the forecasting component when it is empty
+type ServiceConfiguration struct {
+	Name             string `yaml:"name"`
+	ForecastEndpoint string `yaml:"forecast-endpoint"`
+}
+
+//Catalog of VM profiles of a provider and region, policies are derived for each catalog to compare them
+type CatalogConfiguration struct {
+	CSP            string `yaml:"CSP"`
+	Region         string `yaml:"region"`
+	VMProfilesFile string `yaml:"vm-profiles-file"` //./vm_profiles.json by default
+	PricesFile     string `yaml:"vm-prices-file"`
+	BootTimesFile  string `yaml:"boot-times-file"`  //Booting and shutdown times of the VM types
 }
 
 //Struct that models the system configuration to derive the scaling policies
@@ -45,6 +141,7 @@ type SystemConfiguration struct {
 	Region                       string            `yaml:"region"`
 	AppName                      string            `yaml:"app-name"`
 	MainServiceName              string            `yaml:"main-service-name"`
+	Services                     []ServiceConfiguration `yaml:"services"`
 	AppType                      string            `yaml:"app-type"`
 	PricingModel                 PricingModel      `yaml:"pricing-model"`
 	ForecastComponent            ForecastComponent `yaml:"forecasting-component"`
@@ -55,6 +152,27 @@ type SystemConfiguration struct {
 	PolicySettings               PolicySettings    `yaml:"policy-settings"`
 	PullingInterval              int               `yaml:"pulling-interval"`
 	StorageInterval              string            `yaml:"storage-interval"`
+	Storage                      StorageConfiguration `yaml:"storage"`
+	Catalogs                     []CatalogConfiguration `yaml:"catalogs"`
+	Reconciliation               ReconciliationSettings `yaml:"reconciliation"`
+	ObservedLoadComponent        ObservedLoadComponent  `yaml:"observed-load-component"`
+}
+
+//Prometheus compatible API from which the observed requests of the services are pulled
+type ObservedLoadComponent struct {
+	Endpoint   string  `yaml:"endpoint"`   //Requests are only received through the observed load endpoint if empty
+	Query      string  `yaml:"query"`      //Query of the requests per second, {service} is replaced by the name of each service
+	Interval   float64 `yaml:"interval"`   //Seconds between two pulls
+	Step       float64 `yaml:"step"`       //Seconds between two observed values
+	Violations int     `yaml:"violations"` //Consecutive observed values out of the capacity bounds that trigger a new derivation
+}
+
+//Periodic comparison of the actual state of the infrastructure with the state expected by the selected policy
+type ReconciliationSettings struct {
+	Interval       float64 `yaml:"interval"`        //Seconds between two comparisons, disabled if negative
+	Tolerance      float64 `yaml:"tolerance"`       //Seconds allowed after the expected start of a state to reach it
+	DriftThreshold float64 `yaml:"drift-threshold"` //Fraction of VMs or replicas not matched that triggers a new derivation
+	MaxBackoff     float64 `yaml:"max-backoff"`     //Maximum seconds between two derivations while the drift persists
 }
 
 //Method that parses the configuration file into a struct type
@@ -70,5 +188,74 @@ func ReadConfigFile(configFile string) (SystemConfiguration, error) {
 		log.Fatalf("There was a problem parsing the configuration file. Please review the parameters: %v", err)
 		return systemConfig,err
 	}
+	if systemConfig.MainServiceName == "" && len(systemConfig.Services) > 0 {
+		systemConfig.MainServiceName = systemConfig.Services[0].Name
+	}
+	err = systemConfig.PolicySettings.ValidateMetrics()
+	if err != nil {
+		log.Fatalf("There was a problem parsing the configuration file. Please review the parameters: %v", err)
+		return systemConfig,err
+	}
 	return systemConfig,err
-}
\ No newline at end of file
+}
+
+//Check that the preferred metric and the metrics of the weights are known, so a typo does not change the ranking
+func (policySettings PolicySettings) ValidateMetrics() error {
+	known := map[string]bool{COST:true, DERIVATION_TIME:true, TRANSITION_TIME:true, UNDER_PROVISION:true,
+		OVER_PROVISION:true, NUMBER_SCALING_ACTIONS:true}
+	preferredMetric := policySettings.PreferredMetric
+	if preferredMetric != "" && preferredMetric != WEIGHTED_METRICS && !known[preferredMetric] {
+		return errors.New("Unknown preferred metric " + preferredMetric)
+	}
+	for metric := range policySettings.MetricWeights {
+		if !known[metric] {
+			return errors.New("Unknown metric " + metric + " in the metric weights")
+		}
+	}
+	return nil
+}
+//Names of the services whose scaling is derived, only the main service if no list is configured
+func (systemConfig SystemConfiguration) ServiceNames() []string {
+	if len(systemConfig.Services) == 0 {
+		return []string{systemConfig.MainServiceName}
+	}
+	names := []string{}
+	for _,s := range systemConfig.Services {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+//Catalogs compared by the derivation, only the configured provider and region if no list is configured
+func (systemConfig SystemConfiguration) CatalogConfigurations() []CatalogConfiguration {
+	if len(systemConfig.Catalogs) == 0 {
+		return []CatalogConfiguration{{
+			CSP:systemConfig.CSP,
+			Region:systemConfig.Region,
+			PricesFile:systemConfig.PricingModel.PricesFile,
+		}}
+	}
+	return systemConfig.Catalogs
+}
+
+//Configuration to derive the policies with the VM profiles of a catalog.
+//The reserved instances only apply to the configured provider and region
+func (systemConfig SystemConfiguration) ForCatalog(catalog CatalogConfiguration) SystemConfiguration {
+	if catalog.CSP != systemConfig.CSP || catalog.Region != systemConfig.Region {
+		systemConfig.PricingModel.ReservedInstances = nil
+	}
+	systemConfig.CSP = catalog.CSP
+	systemConfig.Region = catalog.Region
+	systemConfig.PricingModel.PricesFile = catalog.PricesFile
+	return systemConfig
+}
+
+//Endpoint of the forecasting component that predicts the load of a service
+func (systemConfig SystemConfiguration) ForecastEndpoint(serviceName string) string {
+	for _,s := range systemConfig.Services {
+		if s.Name == serviceName && s.ForecastEndpoint != "" {
+			return s.ForecastEndpoint
+		}
+	}
+	return systemConfig.ForecastComponent.Endpoint
+}
@@ -14,3 +14,35 @@ func TestFileFormat(t *testing.T) {
 		)
 	}
 }
+
+func TestServiceNames(t *testing.T) {
+	sysConfiguration := SystemConfiguration{MainServiceName:"movieapp", ForecastComponent:ForecastComponent{Endpoint:"http://forecast"}}
+	if names := sysConfiguration.ServiceNames(); len(names) != 1 || names[0] != "movieapp" {
+		t.Error("Without services expected: ", "[movieapp]", "got: ", names)
+	}
+	sysConfiguration.Services = []ServiceConfiguration{{Name:"movieapp"}, {Name:"ratings", ForecastEndpoint:"http://ratings"}}
+	if names := sysConfiguration.ServiceNames(); len(names) != 2 || names[1] != "ratings" {
+		t.Error("With services expected: ", "[movieapp ratings]", "got: ", names)
+	}
+	if endpoint := sysConfiguration.ForecastEndpoint("movieapp"); endpoint != "http://forecast" {
+		t.Error("For service: ", "movieapp", "expected: ", "http://forecast", "got: ", endpoint)
+	}
+	if endpoint := sysConfiguration.ForecastEndpoint("ratings"); endpoint != "http://ratings" {
+		t.Error("For service: ", "ratings", "expected: ", "http://ratings", "got: ", endpoint)
+	}
+}
+
+func TestValidateMetrics(t *testing.T) {
+	valid := PolicySettings{PreferredMetric:WEIGHTED_METRICS, MetricWeights:map[string]float64{COST:1, UNDER_PROVISION:2}}
+	if err := valid.ValidateMetrics(); err != nil {
+		t.Error("Expected known metrics to be valid, got: ", err)
+	}
+	for _, settings := range []PolicySettings{
+		{PreferredMetric:"costs"},
+		{PreferredMetric:WEIGHTED_METRICS, MetricWeights:map[string]float64{"under-provisioning":1}},
+	} {
+		if err := settings.ValidateMetrics(); err == nil {
+			t.Error("Expected an error for unknown metrics in: ", settings)
+		}
+	}
+}
@@ -18,4 +18,31 @@ const PERCENTAGE_REQUIRED_k8S_INSTALLATION_CPU = 0.06
 const PERCENTAGE_REQUIRED_k8S_INSTALLATION_MEM = 0.25
 const TIME_ADD_NODE_TO_K8S = 120
 const TIME_CONTAINER_START = 10
+const MAX_VM_SET_SEARCH_TIME = 500 //Milliseconds
+const HOURS_PER_MONTH = 720.0
+const DEFAULT_RESERVATION_TERM_MONTHS = 12
+const DEFAULT_MINIMUM_BILLED_SECONDS = 60
+const BUDGET_MONTH_FORMAT = "2006-01"
 
+//Storage backends
+const STORAGE_MONGODB = "mongodb"
+const STORAGE_FILE = "file"
+const STORAGE_MEMORY = "memory"
+const DEFAULT_STORAGE_PATH = "./data"
+const DEFAULT_VM_PROFILES_FILE = "./vm_profiles.json"
+
+//Scheduler backends
+const SCHEDULER_SPDT = "spdt"
+const SCHEDULER_KUBERNETES = "kubernetes"
+const SCHEDULER_FILE = "file"
+const DEFAULT_PLAN_FILE = "./plan.json"
+const DEFAULT_SCHEDULING_RETRIES = 3
+const DEFAULT_SCHEDULING_RETRY_BACKOFF = 1.0 //Seconds
+const DEFAULT_RECONCILIATION_INTERVAL = 300.0 //Seconds
+const DEFAULT_RECONCILIATION_TOLERANCE = 600.0 //Seconds
+const DEFAULT_DRIFT_THRESHOLD = 0.2
+const DEFAULT_DRIFT_MAX_BACKOFF = 21600.0 //Seconds
+const DEFAULT_OBSERVED_LOAD_INTERVAL = 300.0 //Seconds
+const DEFAULT_OBSERVED_LOAD_STEP = 60.0 //Seconds
+const DEFAULT_OBSERVED_LOAD_VIOLATIONS = 3
+const DEFAULT_KUBERNETES_NAMESPACE = "default"
@@ -18,3 +18,4 @@ const ENDPOINT_SERVICE_PROFILE_BY_REPLICAS = "/getPredictedRegressionTRN/{apptyp
 const ENDPOINT_SUBSCRIBE_NOTIFICATIONS = "/subscribe"
 const ENDPOINT_RECIVE_NOTIFICATIONS = "/api/forecast"
 
+const ENDPOINT_PROMETHEUS_QUERY_RANGE = "/api/v1/query_range"
@@ -43,6 +43,16 @@ func RoundN(value float64, decimals float64) float64 {
 	return roundedValue
 }
 
+//Seconds in a unit of the granularity of the forecasts, by which the requests per second are multiplied
+func GranularityFactor(granularity string) float64 {
+	switch granularity {
+		case HOUR: return 3600
+		case MINUTE: return 60
+		case SECOND: return 1
+	}
+	return 3600
+}
+
 func ParseIntervalToSeconds(interval string) int64 {
 	l := len(interval)
 	granularity := string(interval[l-1])